@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/tmacro/sysctr/pkg/runner"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+type ApplyCmd struct {
+	Dir        string `short:"d" type:"existingdir" placeholder:"PATH" help:"Directory of container specifications." required:"true"`
+	NoPrune    bool   `help:"Keep containers that have no specification in the directory."`
+	AllowEmpty bool   `help:"Apply a directory without specifications, removing every container."`
+	Format     string `short:"f" enum:"table,json" default:"table" help:"Output format. (table, json)"`
+}
+
+func (a *ApplyCmd) Run(appCtx *AppContext) error {
+	specs, err := readSpecsFromDir(a.Dir)
+	if err != nil {
+		return err
+	}
+
+	results, applyErr := runner.Apply(appCtx.Context, appCtx.Driver, specs, runner.ApplyOptions{
+		NoPrune:    a.NoPrune,
+		AllowEmpty: a.AllowEmpty,
+		StateDir:   appCtx.StateDir,
+	})
+
+	// Results are printed even if some containers failed to converge.
+	if results != nil {
+		if err := a.print(results); err != nil {
+			return errors.Join(applyErr, err)
+		}
+	}
+
+	return applyErr
+}
+
+func (a *ApplyCmd) print(results []runner.ApplyResult) error {
+	if a.Format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(results)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tACTION\tID\tERROR")
+
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			r.Name,
+			r.Action,
+			orDash(truncateID(r.ID)),
+			orDash(r.Error),
+		)
+	}
+
+	return w.Flush()
+}
+
+// readSpecsFromDir reads every YAML and JSON spec in dir, sorted by file name.
+// Specs of the same container name are rejected.
+func readSpecsFromDir(dir string) ([]*types.Spec, error) {
+	var paths []string
+	for _, pattern := range []string{"*.yaml", "*.yml", "*.json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, matches...)
+	}
+
+	sort.Strings(paths)
+
+	specs := make([]*types.Spec, 0, len(paths))
+	names := make(map[string]string, len(paths))
+	for _, path := range paths {
+		spec, err := readSpec(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		if other, ok := names[spec.Name]; ok {
+			return nil, fmt.Errorf("%s: %w", path, &types.SpecError{
+				Field: "name",
+				Err:   fmt.Errorf("container name %q is also used by %s", spec.Name, other),
+			})
+		}
+
+		names[spec.Name] = path
+		specs = append(specs, spec)
+	}
+
+	return specs, nil
+}
+
+func truncateID(id string) string {
+	if len(id) <= 12 {
+		return id
+	}
+
+	return id[:12]
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
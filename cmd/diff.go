@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tmacro/sysctr/pkg/runner"
+)
+
+type DiffCmd struct {
+	Spec   string `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification." required:"true"`
+	Format string `short:"f" enum:"text,json" default:"text" help:"Output format. (text, json)"`
+	Check  bool   `help:"Exit with status 79 if the container does not match the spec."`
+}
+
+func (d *DiffCmd) Run(appCtx *AppContext) error {
+	spec, err := readSpec(d.Spec)
+	if err != nil {
+		return err
+	}
+
+	plan, err := runner.PlanRun(appCtx.Context, appCtx.Driver, spec, runner.PlanOptions{StateDir: appCtx.StateDir})
+	if err != nil {
+		return err
+	}
+
+	if plan.ID == "" {
+		return runner.ErrContainerNotFound
+	}
+
+	if d.Format == "json" {
+		err = json.NewEncoder(os.Stdout).Encode(plan)
+	} else {
+		err = printChanges(os.Stdout, plan)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if d.Check && plan.Drifted {
+		return runner.ErrSpecDrifted
+	}
+
+	return nil
+}
+
+// printChanges prints the changes of plan, one per line.
+func printChanges(w io.Writer, plan *runner.Plan) error {
+	switch {
+	case plan.Drifted && !plan.Recorded:
+		_, err := fmt.Fprintln(w, "# the spec of the container is not recorded, it was created by an older release of sysctr")
+		return err
+	case plan.Drifted && len(plan.Changes) == 0 && plan.ImageChanged:
+		_, err := fmt.Fprintln(w, "# the spec is unchanged, the image was updated")
+		return err
+	case plan.Drifted && len(plan.Changes) == 0 && plan.SecretsChanged:
+		_, err := fmt.Fprintln(w, "# the spec is unchanged, the value of a secret changed")
+		return err
+	case plan.Drifted && len(plan.Changes) == 0:
+		_, err := fmt.Fprintln(w, "# the spec is unchanged, the container was created with a different driver")
+		return err
+	}
+
+	for _, change := range plan.Changes {
+		if _, err := fmt.Fprintln(w, change); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printPlan describes what run would do.
+func printPlan(w io.Writer, plan *runner.Plan) error {
+	var err error
+
+	switch plan.Action {
+	case runner.ActionCreated:
+		_, err = fmt.Fprintf(w, "would create container %s\n", plan.Name)
+	case runner.ActionRecreated:
+		_, err = fmt.Fprintf(w, "would recreate container %s (%s): %s\n", plan.Name, truncateID(plan.ID), plan.Reason)
+	default:
+		_, err = fmt.Fprintf(w, "would attach to running container %s (%s)\n", plan.Name, truncateID(plan.ID))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return printChanges(w, plan)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/moby/term"
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/runner"
+)
+
+type ExecCmd struct {
+	Spec        string   `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification." required:"true"`
+	Interactive bool     `short:"i" help:"Pass standard input to the command."`
+	TTY         bool     `short:"t" name:"tty" help:"Run the command in a terminal."`
+	Command     []string `arg:"" passthrough:"" help:"Command to run in the container."`
+}
+
+func (e *ExecCmd) Run(appCtx *AppContext) error {
+	spec, err := readSpec(e.Spec)
+	if err != nil {
+		return err
+	}
+
+	opts := driver.ExecOptions{
+		Command: e.Command,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+		TTY:     e.TTY,
+	}
+
+	if e.Interactive {
+		opts.Stdin = os.Stdin
+	}
+
+	if e.TTY {
+		resize, restore, err := setupTerminal(e.Interactive)
+		if err != nil {
+			return err
+		}
+
+		defer restore()
+		opts.Resize = resize
+	}
+
+	code, err := runner.Exec(appCtx.Context, appCtx.Driver, spec, opts)
+	if err != nil {
+		return err
+	}
+
+	if code != 0 {
+		return exitStatus(code)
+	}
+
+	return nil
+}
+
+// setupTerminal reports the size of the terminal sysctr runs in and its
+// changes, and puts it into raw mode when the command reads its input. The
+// returned function restores the terminal.
+func setupTerminal(raw bool) (<-chan driver.TerminalSize, func(), error) {
+	outFd, isTerminal := term.GetFdInfo(os.Stdout)
+	if !isTerminal {
+		return nil, func() {}, nil
+	}
+
+	resize := make(chan driver.TerminalSize, 1)
+	sendSize := func() {
+		ws, err := term.GetWinsize(outFd)
+		if err != nil {
+			return
+		}
+
+		// Only the latest size matters.
+		select {
+		case <-resize:
+		default:
+		}
+
+		resize <- driver.TerminalSize{Width: uint(ws.Width), Height: uint(ws.Height)}
+	}
+
+	sendSize()
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			sendSize()
+		}
+	}()
+
+	restore := func() {
+		signal.Stop(winch)
+		close(winch)
+	}
+
+	if !raw {
+		return resize, restore, nil
+	}
+
+	inFd, isTerminal := term.GetFdInfo(os.Stdin)
+	if !isTerminal {
+		restore()
+		return nil, nil, errors.New("standard input is not a terminal")
+	}
+
+	state, err := term.SetRawTerminal(inFd)
+	if err != nil {
+		restore()
+		return nil, nil, err
+	}
+
+	return resize, func() {
+		term.RestoreTerminal(inFd, state)
+		restore()
+	}, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/runner"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+// Exit codes of sysctr. They are part of its interface, systemd units rely on
+// them in SuccessExitStatus and RestartPreventExitStatus, so they must not
+// change. Where possible they follow sysexits.h.
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	// ExitInvalidSpec is returned when the container spec can not be loaded
+	// or is invalid, or apply found no specs.
+	ExitInvalidSpec = 65
+	// ExitNotFound is returned when the container does not exist, or its
+	// image does not and may not be pulled.
+	ExitNotFound = 66
+	// ExitDriverUnavailable is returned when the driver fails to connect to
+	// its container runtime.
+	ExitDriverUnavailable = 69
+	// ExitUnhealthy is returned by run when the container became unhealthy
+	// and its healthcheck's on_failure is exit.
+	ExitUnhealthy = 75
+	// ExitRolledBack is returned by update when the updated container failed
+	// its health window and was rolled back to the previous image.
+	ExitRolledBack = 76
+	// ExitInvalidConfig is returned when the sysctr configuration is invalid.
+	ExitInvalidConfig = 78
+	// ExitSpecDrifted is returned by status --check and diff --check when
+	// the container does not match the spec.
+	ExitSpecDrifted = 79
+	// ExitImageMismatch is returned when the image of a spec pinned to a
+	// digest has a different digest.
+	ExitImageMismatch = 80
+)
+
+// exitStatus is returned by commands that exit with a status of their own,
+// such as run exiting with the status of the container.
+type exitStatus int
+
+func (e exitStatus) Error() string {
+	return "exit status"
+}
+
+// exitCode returns the exit code reporting err.
+func exitCode(err error) int {
+	var status exitStatus
+	var specErr *types.SpecError
+
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &status):
+		return int(status)
+	case errors.As(err, &specErr), errors.Is(err, runner.ErrNoSpecs):
+		return ExitInvalidSpec
+	case errors.Is(err, runner.ErrContainerNotFound), errors.Is(err, runner.ErrImageNotFound):
+		return ExitNotFound
+	case errors.Is(err, runner.ErrImageDigestMismatch):
+		return ExitImageMismatch
+	case errors.Is(err, runner.ErrSpecDrifted):
+		return ExitSpecDrifted
+	// A rollback wraps the error that caused it, which may be ErrUnhealthy.
+	case errors.Is(err, runner.ErrRolledBack):
+		return ExitRolledBack
+	case errors.Is(err, runner.ErrUnhealthy):
+		return ExitUnhealthy
+	case errors.Is(err, driver.ErrDriverUnavailable):
+		return ExitDriverUnavailable
+	case errors.Is(err, driver.ErrDriverNotFound), errors.Is(err, driver.ErrInvalidConfig):
+		return ExitInvalidConfig
+	default:
+		return ExitFailure
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/runner"
+	"github.com/tmacro/sysctr/pkg/systemd"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+type GenerateCmd struct {
+	Systemd GenerateSystemdCmd `cmd:"" help:"Generate a systemd service unit running a container."`
+}
+
+type GenerateSystemdCmd struct {
+	Spec       string `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification." required:"true"`
+	Executable string `placeholder:"PATH" help:"Path to the sysctr binary used by the unit. Defaults to the running binary."`
+	NoNotify   bool   `help:"Generate a Type=simple unit, started as soon as sysctr runs."`
+	Watchdog   int    `placeholder:"SECONDS" help:"Enable the service watchdog with the given interval."`
+}
+
+// NoDriver allows generating units on hosts without the container runtime.
+func (g *GenerateSystemdCmd) NoDriver() {}
+
+func (g *GenerateSystemdCmd) Run(appCtx *AppContext) error {
+	spec, err := readSpec(g.Spec)
+	if err != nil {
+		return err
+	}
+
+	specPath, err := filepath.Abs(g.Spec)
+	if err != nil {
+		return err
+	}
+
+	opts := systemd.UnitOptions{
+		Name:       spec.Name,
+		Executable: g.Executable,
+		SpecPath:   specPath,
+		// run pulls missing images itself, pulling them beforehand only
+		// matters to refresh them on every start.
+		Pull:        spec.PullPolicy != nil && *spec.PullPolicy == types.SpecPullPolicyAlways,
+		Notify:      !g.NoNotify,
+		Watchdog:    time.Duration(g.Watchdog) * time.Second,
+		StopTimeout: runner.StopTimeout(spec),
+		RestartPreventExitStatus: []int{
+			ExitInvalidSpec,
+			ExitInvalidConfig,
+			ExitImageMismatch,
+		},
+	}
+
+	if opts.Executable == "" {
+		opts.Executable, err = os.Executable()
+		if err != nil {
+			return err
+		}
+	}
+
+	if CLI.Config != "" {
+		opts.ConfigPath, err = filepath.Abs(CLI.Config)
+		if err != nil {
+			return err
+		}
+	}
+
+	driverID, err := appCtx.Config.selectDriver("")
+	if err != nil {
+		return err
+	}
+
+	info, err := driver.GetDriverInfo(driverID)
+	if err != nil {
+		return err
+	}
+
+	if d, ok := info.New().(driver.ServiceDependent); ok {
+		opts.Dependencies = d.ServiceDependencies()
+	}
+
+	seen := make(map[string]bool, len(spec.VolumeMounts))
+	addMounts := func(mounts []types.VolumeMount) {
+		for _, v := range mounts {
+			if !seen[v.Source] {
+				seen[v.Source] = true
+				opts.Mounts = append(opts.Mounts, v.Source)
+			}
+		}
+	}
+
+	// Sidecars start with the primary container, so the unit also waits for
+	// the paths they mount.
+	addMounts(spec.VolumeMounts)
+	for _, sidecar := range spec.Sidecars {
+		addMounts(sidecar.VolumeMounts)
+	}
+
+	return systemd.WriteUnit(os.Stdout, opts)
+}
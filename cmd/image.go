@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+)
+
+type ImageCmd struct {
+	Load ImageLoadCmd `cmd:"" help:"Load images from an archive."`
+	Save ImageSaveCmd `cmd:"" help:"Save the images of containers to an archive."`
+}
+
+type ImageLoadCmd struct {
+	Archive string `arg:"" type:"existingfile" placeholder:"PATH" help:"Docker image archive or OCI image layout tarball."`
+}
+
+func (l *ImageLoadCmd) Run(appCtx *AppContext) error {
+	f, err := os.Open(l.Archive)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	names, err := appCtx.Driver.LoadImages(appCtx.Context, f)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		appCtx.Logger.Info().Str("image", name).Msg("loaded")
+	}
+
+	return nil
+}
+
+type ImageSaveCmd struct {
+	Spec   []string `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification. May be repeated." required:"true"`
+	Output string   `short:"o" type:"path" placeholder:"PATH" help:"Path of the archive to write." required:"true"`
+}
+
+func (s *ImageSaveCmd) Run(appCtx *AppContext) error {
+	images := make([]string, 0, len(s.Spec))
+	for _, path := range s.Spec {
+		spec, err := readSpec(path)
+		if err != nil {
+			return err
+		}
+
+		images = append(images, spec.Image)
+	}
+
+	f, err := os.Create(s.Output)
+	if err != nil {
+		return err
+	}
+
+	err = appCtx.Driver.SaveImages(appCtx.Context, f, images)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	// Do not leave a partial archive behind.
+	if err != nil {
+		os.Remove(s.Output)
+		return err
+	}
+
+	appCtx.Logger.Info().Strs("images", images).Str("path", s.Output).Msg("saved")
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	containerd "github.com/tmacro/sysctr/pkg/driver/containerd"
+)
+
+// ContainerdLoggerCmd is started by the containerd shim to capture the output
+// of a task. It is not meant to be run by hand.
+type ContainerdLoggerCmd struct {
+	Path string `arg:"" help:"Path to the log file."`
+}
+
+func (c *ContainerdLoggerCmd) NoDriver() {}
+
+func (c *ContainerdLoggerCmd) Run(appCtx *AppContext) error {
+	containerd.RunLogger(c.Path)
+	return nil
+}
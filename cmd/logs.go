@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/runner"
+)
+
+type LogsCmd struct {
+	Spec       string `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification." required:"true"`
+	Follow     bool   `short:"f" help:"Follow the output until the container exits."`
+	Since      string `placeholder:"TIME" help:"Show output written since a timestamp (e.g. 2024-08-01T10:15:00Z) or a duration ago (e.g. 10m)."`
+	Until      string `placeholder:"TIME" help:"Show output written before a timestamp (e.g. 2024-08-01T10:15:00Z) or a duration ago (e.g. 10m)."`
+	Tail       int    `short:"n" placeholder:"N" default:"-1" help:"Number of lines to show from the end of the output, all when negative."`
+	Timestamps bool   `short:"t" help:"Prefix each line with the time it was written."`
+}
+
+func (l *LogsCmd) Run(appCtx *AppContext) error {
+	spec, err := readSpec(l.Spec)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	since, err := parseLogTime(l.Since, now)
+	if err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+
+	until, err := parseLogTime(l.Until, now)
+	if err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+
+	tail := l.Tail
+	if tail < 0 {
+		tail = driver.TailAll
+	}
+
+	ctx, stop := signal.NotifyContext(appCtx.Context, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err = runner.Logs(ctx, appCtx.Driver, spec, driver.LogOptions{
+		Stdout:     os.Stdout,
+		Stderr:     os.Stderr,
+		Follow:     l.Follow,
+		Since:      since,
+		Until:      until,
+		Tail:       tail,
+		Timestamps: l.Timestamps,
+	})
+
+	// Following the output is ended by a signal.
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+// parseLogTime parses an RFC 3339 timestamp or a duration before now. An
+// empty string is the zero time.
+func parseLogTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	return time.Parse(time.RFC3339Nano, s)
+}
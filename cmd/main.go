@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 
@@ -13,23 +14,49 @@ import (
 	"github.com/tmacro/sysctr/pkg/driver"
 	_ "github.com/tmacro/sysctr/pkg/driver/containerd"
 	_ "github.com/tmacro/sysctr/pkg/driver/docker"
+	_ "github.com/tmacro/sysctr/pkg/driver/oci"
+	_ "github.com/tmacro/sysctr/pkg/driver/podman"
+	"github.com/tmacro/sysctr/pkg/registry"
+	"github.com/tmacro/sysctr/pkg/runner"
+	"github.com/tmacro/sysctr/pkg/types"
 )
 
 var CLI struct {
 	LogLevel  string    `help:"Set the log level." enum:"trace,debug,info,warn,error" default:"debug"`
 	LogFormat string    `enum:"json,text" default:"text" help:"Set the log format. (json, text)"`
 	Config    string    `short:"c" help:"Path to sysctr configuration." type:"existingfile" placeholder:"PATH"`
+	StrictEnv bool      `env:"SYSCTR_STRICT_ENV" help:"Fail if a spec references an environment variable that is not set."`
 	Pull      PullCmd   `cmd:"" help:"Pull a container's image."`
 	Run       RunCmd    `cmd:"" help:"Run a container."`
 	Status    StatusCmd `cmd:"" help:"Get the status of a container."`
 	Stop      StopCmd   `cmd:"" help:"Stop a container."`
 	Rm        RmCmd     `cmd:"" help:"Remove a container."`
+	Ps        PsCmd     `cmd:"" help:"List containers managed by sysctr."`
+	Apply     ApplyCmd  `cmd:"" help:"Converge containers to a directory of specifications."`
+	Update    UpdateCmd `cmd:"" help:"Update containers to the latest version of their image."`
+	Diff      DiffCmd   `cmd:"" help:"Show how a container differs from its specification."`
+	Logs      LogsCmd   `cmd:"" help:"Show the output of a container."`
+	Exec      ExecCmd   `cmd:"" help:"Run a command in a running container."`
+
+	Image    ImageCmd    `cmd:"" help:"Load and save images for hosts without registry access."`
+	Generate GenerateCmd `cmd:"" help:"Generate configuration for running containers."`
+
+	ContainerdLogger ContainerdLoggerCmd `cmd:"" hidden:"" name:"containerd-logger" help:"Capture the output of a containerd task."`
+	OCIMonitor       OCIMonitorCmd       `cmd:"" hidden:"" name:"oci-monitor" help:"Run a container of the oci driver."`
+}
+
+// driverlessCmd is implemented by commands that run without loading a driver.
+type driverlessCmd interface {
+	NoDriver()
 }
 
 type AppContext struct {
 	Logger  zerolog.Logger
 	Driver  driver.Driver
 	Context context.Context
+	// StateDir holds the runtime state of containers.
+	StateDir string
+	Config   *sysctrConfig
 }
 
 func main() {
@@ -48,21 +75,44 @@ func main() {
 
 	ctx = logger.WithContext(ctx)
 
-	drv, err := loadDriver(ctx, CLI.Config, "")
+	config, err := loadConfig(CLI.Config)
 	if err != nil {
-		logger.Fatal().Err(err).Msg("error loading driver")
+		logger.Error().Err(err).Msg("error loading configuration")
+		os.Exit(exitCode(err))
+	}
+
+	var drv driver.Driver
+
+	if _, ok := cmd.Selected().Target.Addr().Interface().(driverlessCmd); !ok {
+		drv, err = loadDriver(ctx, config, "")
+		if err != nil {
+			logger.Error().Err(err).Msg("error loading driver")
+			os.Exit(exitCode(err))
+		}
 	}
 
 	appCtx := AppContext{
-		Logger:  logger,
-		Driver:  drv,
-		Context: ctx,
+		Logger:   logger,
+		Driver:   drv,
+		Context:  ctx,
+		StateDir: config.StateDir,
+		Config:   config,
 	}
 
 	err = cmd.Run(&appCtx)
-	if err != nil {
-		logger.Fatal().Err(err).Msg("error running command")
+
+	if d, ok := drv.(driver.Destructor); ok {
+		if destErr := d.Destroy(ctx); destErr != nil {
+			logger.Warn().Err(destErr).Msg("error destroying driver")
+		}
 	}
+
+	var status exitStatus
+	if err != nil && !errors.As(err, &status) {
+		logger.Error().Err(err).Msg("error running command")
+	}
+
+	os.Exit(exitCode(err))
 }
 
 func setupLogger(level, format string) zerolog.Logger {
@@ -90,46 +140,77 @@ func setupLogger(level, format string) zerolog.Logger {
 	return zerolog.New(writer).Level(lvl).With().Timestamp().Logger()
 }
 
+// readSpec reads the spec at path, interpolating environment variables.
+func readSpec(path string) (*types.Spec, error) {
+	return types.ReadSpecFromFileWithOptions(path, types.LoadOptions{
+		Strict: CLI.StrictEnv,
+	})
+}
+
 type sysctrConfig struct {
-	Driver map[string]json.RawMessage `json:"driver"`
+	Driver   map[string]json.RawMessage `json:"driver"`
+	StateDir string                     `json:"state_dir"`
+	// Registries holds the credentials of registries images are pulled
+	// from, by host.
+	Registries registry.Config `json:"registries"`
 }
 
-func loadDriver(ctx context.Context, configPath string, driverID string) (driver.Driver, error) {
-	var config sysctrConfig
-	if configPath != "" {
-		file, err := os.Open(configPath)
-		if err != nil {
-			return nil, err
-		}
+func loadConfig(configPath string) (*sysctrConfig, error) {
+	config := &sysctrConfig{
+		StateDir: runner.DefaultStateDir,
+	}
 
-		defer file.Close()
+	if configPath == "" {
+		return config, nil
+	}
 
-		err = json.NewDecoder(file).Decode(&config)
-		if err != nil {
-			return nil, err
-		}
+	file, err := os.Open(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", driver.ErrInvalidConfig, err)
+	}
+
+	defer file.Close()
+
+	err = json.NewDecoder(file).Decode(config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", driver.ErrInvalidConfig, err)
+	}
+
+	if err := config.Registries.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", driver.ErrInvalidConfig, err)
+	}
+
+	return config, nil
+}
+
+// selectDriver returns the ID of the driver to use, the only configured one
+// unless driverID is set.
+func (c *sysctrConfig) selectDriver(driverID string) (string, error) {
+	if driverID != "" {
+		return driverID, nil
 	}
 
 	availableDriverConfigs := []string{}
-	if config.Driver != nil {
-		for k := range config.Driver {
-			availableDriverConfigs = append(availableDriverConfigs, k)
-		}
+	for k := range c.Driver {
+		availableDriverConfigs = append(availableDriverConfigs, k)
 	}
 
-	if driverID == "" && len(availableDriverConfigs) == 1 {
-		driverID = availableDriverConfigs[0]
-	} else if driverID == "" && len(availableDriverConfigs) > 1 {
-		return nil, errors.New("multiple drivers configured, must specify driver ID")
+	if len(availableDriverConfigs) > 1 {
+		return "", fmt.Errorf("%w: multiple drivers configured, must specify driver ID", driver.ErrInvalidConfig)
 	}
 
-	driverConf := []byte{}
-	if config.Driver != nil {
-		dc, ok := config.Driver[driverID]
-		if ok {
-			driverConf = dc
-		}
+	if len(availableDriverConfigs) == 0 {
+		return "", fmt.Errorf("%w: no driver configured", driver.ErrInvalidConfig)
+	}
+
+	return availableDriverConfigs[0], nil
+}
+
+func loadDriver(ctx context.Context, config *sysctrConfig, driverID string) (driver.Driver, error) {
+	driverID, err := config.selectDriver(driverID)
+	if err != nil {
+		return nil, err
 	}
 
-	return driver.LoadDriver(ctx, driverID, driverConf)
+	return driver.LoadDriver(ctx, driverID, config.Driver[driverID], config.Registries)
 }
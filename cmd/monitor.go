@@ -0,0 +1,19 @@
+package main
+
+import (
+	"github.com/tmacro/sysctr/pkg/driver/oci"
+)
+
+// OCIMonitorCmd is started by the oci driver to run a container. It is not
+// meant to be run by hand.
+type OCIMonitorCmd struct {
+	Runtime     string `required:"" help:"Path to the OCI runtime."`
+	RuntimeRoot string `required:"" help:"State directory of the OCI runtime."`
+	Bundle      string `arg:"" help:"Path to the bundle of the container."`
+}
+
+func (c *OCIMonitorCmd) NoDriver() {}
+
+func (c *OCIMonitorCmd) Run(appCtx *AppContext) error {
+	return oci.RunMonitor(c.Runtime, c.RuntimeRoot, c.Bundle)
+}
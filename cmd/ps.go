@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/tmacro/sysctr/pkg/runner"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+type PsCmd struct {
+	Format  string `short:"f" enum:"table,json" default:"table" help:"Output format. (table, json)"`
+	NoTrunc bool   `help:"Do not truncate container IDs and spec hashes."`
+}
+
+func (p *PsCmd) Run(appCtx *AppContext) error {
+	states, err := runner.List(appCtx.Context, appCtx.Driver)
+	if err != nil {
+		return err
+	}
+
+	if p.Format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(states)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tID\tIMAGE\tSTATUS\tEXIT CODE\tUPTIME\tSPEC HASH")
+
+	for _, s := range states {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Name,
+			p.truncate(s.Id, 12),
+			s.Image,
+			s.Status,
+			formatExitCode(s),
+			formatUptime(s),
+			p.truncateHash(s.ConfigHash),
+		)
+	}
+
+	return w.Flush()
+}
+
+func (p *PsCmd) truncate(s string, n int) string {
+	if p.NoTrunc || len(s) <= n {
+		return s
+	}
+
+	return s[:n]
+}
+
+// truncateHash keeps the version prefix of a spec hash.
+func (p *PsCmd) truncateHash(hash string) string {
+	version, sum, ok := strings.Cut(hash, ":")
+	if !ok {
+		return p.truncate(hash, 12)
+	}
+
+	return version + ":" + p.truncate(sum, 12)
+}
+
+func formatExitCode(s types.ContainerState) string {
+	if s.ExitCode == nil {
+		return "-"
+	}
+
+	return strconv.Itoa(*s.ExitCode)
+}
+
+func formatUptime(s types.ContainerState) string {
+	if s.StartedAt == nil {
+		return "-"
+	}
+
+	return units.HumanDuration(time.Since(*s.StartedAt))
+}
@@ -1,23 +1,19 @@
 package main
 
 import (
-	"github.com/tmacro/sysctr/pkg/types"
+	"github.com/tmacro/sysctr/pkg/runner"
 )
 
 type PullCmd struct {
-	Spec string `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification." required:"true"`
+	Spec  string `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification." required:"true"`
+	Force bool   `help:"Pull images that are already present, unless their pull policy is never."`
 }
 
 func (p *PullCmd) Run(appCtx *AppContext) error {
-	spec, err := types.ReadSpecFromFile(p.Spec)
+	spec, err := readSpec(p.Spec)
 	if err != nil {
 		return err
 	}
 
-	err = appCtx.Driver.PullImage(appCtx.Context, spec.Image)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return runner.Pull(appCtx.Context, appCtx.Driver, spec, runner.PullOptions{Force: p.Force})
 }
@@ -2,20 +2,25 @@ package main
 
 import (
 	"github.com/tmacro/sysctr/pkg/runner"
-	"github.com/tmacro/sysctr/pkg/types"
 )
 
 type RmCmd struct {
-	Spec string `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification." required:"true"`
+	Spec    string `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification." required:"true"`
+	Force   bool   `short:"f" help:"Remove a running container without stopping it first."`
+	Timeout int    `short:"t" placeholder:"SECONDS" help:"Seconds to wait before killing the container. Overrides the spec's stop_timeout."`
 }
 
 func (r *RmCmd) Run(appCtx *AppContext) error {
-	spec, err := types.ReadSpecFromFile(r.Spec)
+	spec, err := readSpec(r.Spec)
 	if err != nil {
 		return err
 	}
 
-	err = runner.Remove(appCtx.Context, appCtx.Driver, spec, runner.RemoveOptions{})
+	err = runner.Remove(appCtx.Context, appCtx.Driver, spec, runner.RemoveOptions{
+		Force:    r.Force,
+		Timeout:  r.Timeout,
+		StateDir: appCtx.StateDir,
+	})
 	if err != nil {
 		return err
 	}
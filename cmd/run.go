@@ -6,25 +6,43 @@ import (
 	"syscall"
 
 	"github.com/tmacro/sysctr/pkg/runner"
-	"github.com/tmacro/sysctr/pkg/types"
+	"github.com/tmacro/sysctr/pkg/sdnotify"
 )
 
 type RunCmd struct {
 	Spec      string `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification." required:"true"`
 	NoCleanup bool   `short:"n" help:"Do not remove container after it exits." default:"false"`
+	DryRun    bool   `help:"Report what would be done to the container without doing it."`
 }
 
 func (r *RunCmd) Run(appCtx *AppContext) error {
-	spec, err := types.ReadSpecFromFile(r.Spec)
+	spec, err := readSpec(r.Spec)
 	if err != nil {
 		return err
 	}
 
+	if r.DryRun {
+		plan, err := runner.PlanRun(appCtx.Context, appCtx.Driver, spec, runner.PlanOptions{StateDir: appCtx.StateDir})
+		if err != nil {
+			return err
+		}
+
+		return printPlan(os.Stdout, plan)
+	}
+
 	ctx, stop := signal.NotifyContext(appCtx.Context, syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	watchdogInterval, err := sdnotify.WatchdogInterval()
+	if err != nil {
+		return err
+	}
+
 	runOpts := runner.RunOptions{
-		Cleanup: !r.NoCleanup,
+		Cleanup:          !r.NoCleanup,
+		StateDir:         appCtx.StateDir,
+		Notifier:         sdnotify.FromEnv(),
+		WatchdogInterval: watchdogInterval,
 	}
 
 	exitCode, err := runner.Run(ctx, appCtx.Driver, spec, runOpts)
@@ -32,7 +50,9 @@ func (r *RunCmd) Run(appCtx *AppContext) error {
 		return err
 	}
 
-	os.Exit(exitCode)
+	if exitCode != 0 {
+		return exitStatus(exitCode)
+	}
 
 	return nil
 }
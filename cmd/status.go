@@ -5,20 +5,22 @@ import (
 	"fmt"
 
 	"github.com/tmacro/sysctr/pkg/runner"
-	"github.com/tmacro/sysctr/pkg/types"
 )
 
 type StatusCmd struct {
-	Spec string `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification." required:"true"`
+	Spec  string `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification." required:"true"`
+	Check bool   `help:"Exit with status 79 if the container does not match the spec."`
 }
 
 func (p *StatusCmd) Run(appCtx *AppContext) error {
-	spec, err := types.ReadSpecFromFile(p.Spec)
+	spec, err := readSpec(p.Spec)
 	if err != nil {
 		return err
 	}
 
-	status, err := runner.Status(appCtx.Context, appCtx.Driver, spec)
+	status, err := runner.Status(appCtx.Context, appCtx.Driver, spec, runner.StatusOptions{
+		StateDir: appCtx.StateDir,
+	})
 	if err != nil {
 		return err
 	}
@@ -30,5 +32,9 @@ func (p *StatusCmd) Run(appCtx *AppContext) error {
 
 	fmt.Println(string(statusJson))
 
+	if p.Check && status.Drifted != nil && *status.Drifted {
+		return runner.ErrSpecDrifted
+	}
+
 	return nil
 }
@@ -2,20 +2,22 @@ package main
 
 import (
 	"github.com/tmacro/sysctr/pkg/runner"
-	"github.com/tmacro/sysctr/pkg/types"
 )
 
 type StopCmd struct {
-	Spec string `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification." required:"true"`
+	Spec    string `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification." required:"true"`
+	Timeout int    `short:"t" placeholder:"SECONDS" help:"Seconds to wait before killing the container. Overrides the spec's stop_timeout."`
 }
 
 func (s *StopCmd) Run(appCtx *AppContext) error {
-	spec, err := types.ReadSpecFromFile(s.Spec)
+	spec, err := readSpec(s.Spec)
 	if err != nil {
 		return err
 	}
 
-	err = runner.Stop(appCtx.Context, appCtx.Driver, spec, runner.StopOptions{})
+	err = runner.Stop(appCtx.Context, appCtx.Driver, spec, runner.StopOptions{
+		Timeout: s.Timeout,
+	})
 	if err != nil {
 		return err
 	}
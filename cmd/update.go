@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/runner"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+type UpdateCmd struct {
+	Spec   string        `short:"s" type:"existingfile" placeholder:"PATH" help:"Path to container specification." xor:"target" required:"true"`
+	All    string        `type:"existingdir" placeholder:"PATH" help:"Update the containers of every specification in the directory." xor:"target" required:"true"`
+	Window time.Duration `default:"10s" help:"How long a container without a healthcheck must keep running before the update succeeds."`
+	Format string        `short:"f" enum:"table,json" default:"table" help:"Output format. (table, json)"`
+}
+
+func (u *UpdateCmd) Run(appCtx *AppContext) error {
+	var specs []*types.Spec
+
+	if u.All != "" {
+		var err error
+		specs, err = readSpecsFromDir(u.All)
+		if err != nil {
+			return err
+		}
+	} else {
+		spec, err := readSpec(u.Spec)
+		if err != nil {
+			return err
+		}
+
+		specs = []*types.Spec{spec}
+	}
+
+	results, updateErr := runner.UpdateAll(appCtx.Context, appCtx.Driver, specs, runner.UpdateOptions{
+		StateDir: appCtx.StateDir,
+		Window:   u.Window,
+	})
+
+	// Results are printed even if some containers failed to update.
+	if results != nil {
+		if err := u.print(results); err != nil {
+			return errors.Join(updateErr, err)
+		}
+	}
+
+	return updateErr
+}
+
+func (u *UpdateCmd) print(results []runner.UpdateResult) error {
+	if u.Format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(results)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tACTION\tID\tDIGEST\tERROR")
+
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			r.Name,
+			r.Action,
+			orDash(truncateID(r.ID)),
+			orDash(truncateID(strings.TrimPrefix(r.Digest, "sha256:"))),
+			orDash(r.Error),
+		)
+	}
+
+	return w.Flush()
+}
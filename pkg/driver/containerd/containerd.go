@@ -2,18 +2,32 @@ package driver
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/images/archive"
 	"github.com/containerd/containerd/namespaces"
 	"github.com/containerd/containerd/oci"
+	"github.com/containerd/containerd/platforms"
 	"github.com/containerd/errdefs"
+	gocni "github.com/containerd/go-cni"
+	"github.com/distribution/reference"
+	"github.com/moby/sys/signal"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/logfile"
+	"github.com/tmacro/sysctr/pkg/registry"
 )
 
 func init() {
@@ -23,14 +37,26 @@ func init() {
 const (
 	defaultEndpoint    = "/run/containerd/containerd.sock"
 	defaultNamespace   = "sysctr"
+	defaultLogDir      = "/var/log/sysctr"
 	containerNameLabel = "sysctr.driver.containerd.name"
+	startedAtLabel     = "sysctr.driver.containerd.startedAt"
 )
 
 type ContainerdDriver struct {
 	Namespace string `json:"namespace"`
 	Endpoint  string `json:"endpoint"`
+	LogDir    string `json:"log_dir"`
 
-	client *containerd.Client
+	CNIConfDir string `json:"cni_conf_dir"`
+	CNIBinDir  string `json:"cni_bin_dir"`
+
+	client     *containerd.Client
+	logger     string
+	registries registry.Config
+
+	cni     gocni.CNI
+	cniErr  error
+	cniOnce sync.Once
 }
 
 func (d *ContainerdDriver) DriverInfo() driver.DriverInfo {
@@ -40,6 +66,10 @@ func (d *ContainerdDriver) DriverInfo() driver.DriverInfo {
 	}
 }
 
+func (d *ContainerdDriver) ServiceDependencies() []string {
+	return []string{"containerd.service"}
+}
+
 func (d *ContainerdDriver) Provision(ctx context.Context) error {
 	var err error
 
@@ -51,6 +81,29 @@ func (d *ContainerdDriver) Provision(ctx context.Context) error {
 		d.Namespace = defaultNamespace
 	}
 
+	if d.LogDir == "" {
+		d.LogDir = defaultLogDir
+	}
+
+	if d.CNIConfDir == "" {
+		d.CNIConfDir = defaultCNIConfDir
+	}
+
+	if d.CNIBinDir == "" {
+		d.CNIBinDir = defaultCNIBinDir
+	}
+
+	// Task output is captured by sysctr itself, see RunLogger.
+	d.logger, err = os.Executable()
+	if err != nil {
+		return err
+	}
+
+	d.logger, err = filepath.EvalSymlinks(d.logger)
+	if err != nil {
+		return err
+	}
+
 	d.client, err = containerd.New(d.Endpoint)
 	if err != nil {
 		return err
@@ -67,36 +120,153 @@ func (d *ContainerdDriver) Destroy(ctx context.Context) error {
 	return nil
 }
 
-func resolveImageRef(imageRef string) string {
-	if !strings.Contains(imageRef, ":") {
-		imageRef = imageRef + ":latest"
+// resolveImageRef returns the fully qualified reference of imageRef, which
+// containerd stores images by and resolves registries from.
+func resolveImageRef(imageRef string) (string, error) {
+	named, err := reference.ParseDockerRef(imageRef)
+	if err != nil {
+		return "", err
 	}
 
-	slashes := strings.Count(imageRef, "/")
-	if slashes == 0 {
-		imageRef = "docker.io/library/" + imageRef
-	} else if slashes == 1 {
-		imageRef = "docker.io/" + imageRef
-	}
+	return named.String(), nil
+}
 
-	return imageRef
+func (d *ContainerdDriver) ConfigureRegistries(registries registry.Config) {
+	d.registries = registries
 }
 
 func (d *ContainerdDriver) PullImage(ctx context.Context, imageRef string) error {
 	ctx = namespaces.WithNamespace(ctx, d.Namespace)
 
-	imageRef = resolveImageRef(imageRef)
+	imageRef, err := resolveImageRef(imageRef)
+	if err != nil {
+		return err
+	}
 
-	_, err := d.client.Pull(ctx, imageRef, containerd.WithPullUnpack)
+	_, err = d.client.Pull(ctx, imageRef, containerd.WithPullUnpack, containerd.WithResolver(d.registries.Resolver()))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// ImageDigest returns the digest of the manifest, or index, the image was
+// pulled by.
+func (d *ContainerdDriver) ImageDigest(ctx context.Context, imageRef string) (string, error) {
+	ctx = namespaces.WithNamespace(ctx, d.Namespace)
+
+	name, err := resolveImageRef(imageRef)
+	if err != nil {
+		return "", err
+	}
+
+	img, err := d.client.ImageService().Get(ctx, name)
+	if errdefs.IsNotFound(err) {
+		return "", fmt.Errorf("%w: %s", driver.ErrImageNotFound, imageRef)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return img.Target.Digest.String(), nil
+}
+
+// TagImage stores the image under the name of target, replacing the image
+// previously stored under it.
+func (d *ContainerdDriver) TagImage(ctx context.Context, imageRef, target string) error {
+	ctx = namespaces.WithNamespace(ctx, d.Namespace)
+
+	name, err := resolveImageRef(imageRef)
+	if err != nil {
+		return err
+	}
+
+	targetName, err := resolveImageRef(target)
+	if err != nil {
+		return err
+	}
+
+	is := d.client.ImageService()
+
+	img, err := is.Get(ctx, name)
+	if errdefs.IsNotFound(err) {
+		return fmt.Errorf("%w: %s", driver.ErrImageNotFound, imageRef)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	img.Name = targetName
+
+	_, err = is.Create(ctx, img)
+	if errdefs.IsAlreadyExists(err) {
+		_, err = is.Update(ctx, img)
+	}
+
+	return err
+}
+
+// LoadImages imports the images of the archive and unpacks them into the
+// default snapshotter, so containers may be created from them.
+func (d *ContainerdDriver) LoadImages(ctx context.Context, r io.Reader) ([]string, error) {
+	ctx = namespaces.WithNamespace(ctx, d.Namespace)
+
+	imgs, err := d.client.Import(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(imgs))
+	for _, img := range imgs {
+		if err := containerd.NewImage(d.client, img).Unpack(ctx, ""); err != nil {
+			return nil, fmt.Errorf("failed to unpack image %s: %w", img.Name, err)
+		}
+
+		names = append(names, img.Name)
+	}
+
+	return names, nil
+}
+
+// SaveImages writes the images for the platform of the host. Content of
+// other platforms, which is not pulled, is skipped.
+func (d *ContainerdDriver) SaveImages(ctx context.Context, w io.Writer, imageRefs []string) error {
+	ctx = namespaces.WithNamespace(ctx, d.Namespace)
+
+	is := d.client.ImageService()
+	opts := []archive.ExportOpt{
+		archive.WithPlatform(platforms.DefaultStrict()),
+		archive.WithSkipMissing(d.client.ContentStore()),
+	}
+
+	for _, ref := range imageRefs {
+		name, err := resolveImageRef(ref)
+		if err != nil {
+			return err
+		}
+
+		if _, err := is.Get(ctx, name); errdefs.IsNotFound(err) {
+			return fmt.Errorf("%w: %s", driver.ErrImageNotFound, ref)
+		} else if err != nil {
+			return err
+		}
+
+		opts = append(opts, archive.WithImage(is, name))
+	}
+
+	return d.client.Export(ctx, w, opts...)
+}
+
 func (d *ContainerdDriver) CreateContainer(ctx context.Context, spec *driver.Spec) (string, error) {
 	ctx = namespaces.WithNamespace(ctx, d.Namespace)
-	img, err := d.client.GetImage(ctx, resolveImageRef(spec.Image))
+	imageRef, err := resolveImageRef(spec.Image)
+	if err != nil {
+		return "", err
+	}
+
+	img, err := d.client.GetImage(ctx, imageRef)
 	if err != nil {
 		return "", err
 	}
@@ -129,18 +299,48 @@ func (d *ContainerdDriver) CreateContainer(ctx context.Context, spec *driver.Spe
 	for k, v := range spec.Labels {
 		labels[k] = v
 	}
+	labels[containerNameLabel] = spec.Name
+
+	for k, v := range namespaceLabels(spec.Namespaces) {
+		labels[k] = v
+	}
+
+	switch {
+	case spec.Namespaces.Join != "":
+		// The network namespace is joined when the container is started.
+	case spec.Network.Mode == driver.NetworkBridge:
+		network, err := json.Marshal(spec.Network)
+		if err != nil {
+			return "", err
+		}
+
+		labels[networkLabel] = string(network)
+	case len(spec.Network.Ports) > 0:
+		return "", fmt.Errorf("ports can only be published in %s network mode", driver.NetworkBridge)
+	}
+
+	specOpts := []oci.SpecOpts{
+		oci.WithImageConfig(img),
+		oci.WithProcessArgs(args...),
+		oci.WithEnv(env),
+		oci.WithMounts(mounts),
+		// Labels are limited in size, annotations are stored in the OCI spec.
+		oci.WithAnnotations(spec.Annotations),
+	}
+
+	if spec.Namespaces.Join != "" {
+		specOpts = append(specOpts, oci.WithHostHostsFile, oci.WithHostResolvconf)
+	} else {
+		specOpts = append(specOpts, networkSpecOpts(spec.Network)...)
+	}
+	specOpts = append(specOpts, resourceSpecOpts(spec.Resources)...)
 
 	container, err := d.client.NewContainer(
 		ctx,
 		spec.Name,
 		containerd.WithNewSnapshot(spec.Name+"-snapshot", img),
-		containerd.WithNewSpec(
-			oci.WithImageConfig(img),
-			oci.WithProcessArgs(args...),
-			oci.WithEnv(env),
-			oci.WithMounts(mounts),
-		),
-		containerd.WithAdditionalContainerLabels(spec.Labels),
+		containerd.WithNewSpec(specOpts...),
+		containerd.WithAdditionalContainerLabels(labels),
 	)
 
 	if err != nil {
@@ -157,8 +357,49 @@ func (d *ContainerdDriver) StartContainer(ctx context.Context, id string) error
 		return err
 	}
 
-	task, err := container.NewTask(ctx, cio.NewCreator(cio.WithStdio))
+	// The task of a previous start is kept once it exits, a new task can
+	// only be created after it was deleted.
+	previous, err := container.Task(ctx, nil)
+	if err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+
+	if err == nil {
+		status, err := previous.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		if status.Status == containerd.Running || status.Status == containerd.Pausing {
+			return nil
+		}
+
+		_, err = previous.Delete(ctx, containerd.WithProcessKill)
+		if err != nil && !errdefs.IsNotFound(err) {
+			return err
+		}
+
+		err = d.teardownNetwork(ctx, container)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := d.joinNamespaces(ctx, container); err != nil {
+		return err
+	}
+
+	task, err := container.NewTask(ctx, cio.BinaryIO(d.logger, map[string]string{
+		loggerCommand: d.logPath(id),
+	}))
+	if err != nil {
+		return err
+	}
+
+	err = d.setupNetwork(ctx, container, task)
 	if err != nil {
+		task.Delete(ctx, containerd.WithProcessKill)
+		d.teardownNetwork(ctx, container)
 		return err
 	}
 
@@ -167,16 +408,32 @@ func (d *ContainerdDriver) StartContainer(ctx context.Context, id string) error
 		return err
 	}
 
+	// Containerd does not record when a task was started.
+	_, err = container.SetLabels(ctx, map[string]string{
+		startedAtLabel: time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func (d *ContainerdDriver) StopContainer(ctx context.Context, id string) error {
+func (d *ContainerdDriver) StopContainer(ctx context.Context, id string, opts driver.StopOptions) error {
 	ctx = namespaces.WithNamespace(ctx, d.Namespace)
 	container, err := d.client.LoadContainer(ctx, id)
 	if err != nil {
 		return err
 	}
 
+	sig := syscall.SIGTERM
+	if opts.Signal != "" {
+		sig, err = signal.ParseSignal(opts.Signal)
+		if err != nil {
+			return err
+		}
+	}
+
 	task, err := container.Task(ctx, nil)
 	if err != nil && !errdefs.IsNotFound(err) {
 		return err
@@ -184,7 +441,52 @@ func (d *ContainerdDriver) StopContainer(ctx context.Context, id string) error {
 		return nil
 	}
 
-	return task.Kill(ctx, syscall.SIGTERM, containerd.WithKillAll)
+	status, err := task.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	if status.Status == containerd.Stopped {
+		return nil
+	}
+
+	// Wait must be called before Kill to not miss the exit.
+	statusC, err := task.Wait(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = task.Kill(ctx, sig, containerd.WithKillAll)
+	if errdefs.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(opts.Timeout)
+	defer timer.Stop()
+
+	select {
+	case <-statusC:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+
+	err = task.Kill(ctx, syscall.SIGKILL, containerd.WithKillAll)
+	if errdefs.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	select {
+	case <-statusC:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func getNameFromLabels(ctx context.Context, container containerd.Container) string {
@@ -209,12 +511,18 @@ func (d *ContainerdDriver) RemoveContainer(ctx context.Context, id string) error
 	}
 
 	if err == nil {
-		_, err = task.Delete(ctx)
+		// Kill the task if it is still running, as when removing with --force.
+		_, err = task.Delete(ctx, containerd.WithProcessKill)
 		if err != nil {
 			return err
 		}
 	}
 
+	err = d.teardownNetwork(ctx, container)
+	if err != nil {
+		return err
+	}
+
 	name := getNameFromLabels(ctx, container)
 	err = d.client.SnapshotService(containerd.DefaultSnapshotter).Remove(ctx, name+"-snapshot")
 	if err != nil {
@@ -226,6 +534,11 @@ func (d *ContainerdDriver) RemoveContainer(ctx context.Context, id string) error
 		return err
 	}
 
+	err = os.Remove(d.logPath(id))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
 	return nil
 }
 
@@ -246,23 +559,54 @@ func (d *ContainerdDriver) WaitForExit(ctx context.Context, id string) error {
 		return err
 	}
 
-	<-statusC
-	return nil
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case status := <-statusC:
+		return status.Error()
+	}
 }
 
-func (d *ContainerdDriver) GetLogs(ctx context.Context, id string, stdout, stderr io.Writer) error {
-	return d.WaitForExit(ctx, id)
+func (d *ContainerdDriver) GetLogs(ctx context.Context, id string, opts driver.LogOptions) error {
+	ctx = namespaces.WithNamespace(ctx, d.Namespace)
+	container, err := d.client.LoadContainer(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	readOpts := logfile.ReadOptions{
+		Stdout:     opts.Stdout,
+		Stderr:     opts.Stderr,
+		Since:      opts.Since,
+		Until:      opts.Until,
+		Tail:       opts.Tail,
+		Timestamps: opts.Timestamps,
+	}
+
+	if opts.Follow {
+		readOpts.Running = func(ctx context.Context) (bool, error) {
+			_, status, err := getTaskStatus(ctx, container)
+			if err != nil {
+				return false, err
+			}
+
+			return status == driver.Running, nil
+		}
+	}
+
+	return logfile.Read(ctx, d.logPath(id), readOpts)
 }
 
 func (d *ContainerdDriver) FindContainer(ctx context.Context, name string, labels map[string]string) (*driver.Status, error) {
 	ctx = namespaces.WithNamespace(ctx, d.Namespace)
 
-	filters := []string{"name==" + name}
-	for k, v := range labels {
-		filters = append(filters, "labels."+k+"=="+v)
+	// Container IDs are the container names, see CreateContainer.
+	filter := "id==" + strconv.Quote(name)
+	if len(labels) > 0 {
+		filter += "," + labelFilter(labels)
 	}
 
-	containers, err := d.client.Containers(ctx, filters...)
+	containers, err := d.client.Containers(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -275,26 +619,38 @@ func (d *ContainerdDriver) FindContainer(ctx context.Context, name string, label
 		return nil, fmt.Errorf("found multiple containers with name %s", name)
 	}
 
-	container := containers[0]
+	return containerStatus(ctx, containers[0])
+}
 
-	containerLabels, err := container.Labels(ctx)
-	if err != nil {
-		return nil, err
+func (d *ContainerdDriver) ListContainers(ctx context.Context, labels map[string]string) ([]driver.Status, error) {
+	ctx = namespaces.WithNamespace(ctx, d.Namespace)
+
+	var filters []string
+	if len(labels) > 0 {
+		filters = append(filters, labelFilter(labels))
 	}
 
-	ec, taskStatus, err := getTaskStatus(ctx, container)
+	containers, err := d.client.Containers(ctx, filters...)
 	if err != nil {
 		return nil, err
 	}
 
-	status := driver.Status{
-		ID:       container.ID(),
-		Status:   taskStatus,
-		Labels:   containerLabels,
-		ExitCode: ec,
+	statuses := make([]driver.Status, 0, len(containers))
+	for _, container := range containers {
+		status, err := containerStatus(ctx, container)
+		if errdefs.IsNotFound(err) {
+			// Removed since it was listed.
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, *status)
 	}
 
-	return &status, nil
+	return statuses, nil
 }
 
 func (d *ContainerdDriver) ContainerStatus(ctx context.Context, id string) (*driver.Status, error) {
@@ -305,7 +661,23 @@ func (d *ContainerdDriver) ContainerStatus(ctx context.Context, id string) (*dri
 		return nil, err
 	}
 
-	containerLabels, err := container.Labels(ctx)
+	return containerStatus(ctx, container)
+}
+
+// labelFilter returns a filter matching containers with every label. Filters
+// passed separately to the client are ORed, the selectors of a single filter
+// are ANDed.
+func labelFilter(labels map[string]string) string {
+	selectors := make([]string, 0, len(labels))
+	for k, v := range labels {
+		selectors = append(selectors, "labels."+strconv.Quote(k)+"=="+strconv.Quote(v))
+	}
+
+	return strings.Join(selectors, ",")
+}
+
+func containerStatus(ctx context.Context, container containerd.Container) (*driver.Status, error) {
+	info, err := container.Info(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -315,11 +687,25 @@ func (d *ContainerdDriver) ContainerStatus(ctx context.Context, id string) (*dri
 		return nil, err
 	}
 
+	var spec oci.Spec
+	if info.Spec != nil {
+		if err := json.Unmarshal(info.Spec.GetValue(), &spec); err != nil {
+			return nil, fmt.Errorf("failed to decode container spec: %w", err)
+		}
+	}
+
 	status := driver.Status{
-		ID:       container.ID(),
-		Status:   taskStatus,
-		Labels:   containerLabels,
-		ExitCode: ec,
+		ID:          container.ID(),
+		Name:        info.Labels[containerNameLabel],
+		Image:       info.Image,
+		Status:      taskStatus,
+		Labels:      info.Labels,
+		Annotations: spec.Annotations,
+		ExitCode:    ec,
+	}
+
+	if startedAt, ok := info.Labels[startedAtLabel]; ok {
+		status.StartedAt, _ = time.Parse(time.RFC3339Nano, startedAt)
 	}
 
 	return &status, nil
@@ -331,8 +717,9 @@ func getTaskStatus(ctx context.Context, container containerd.Container) (int, dr
 		return 0, driver.UnknownStatus, err
 	}
 
+	// Tasks only exist once a container has been started.
 	if errdefs.IsNotFound(err) {
-		return 0, driver.Stopped, nil
+		return 0, driver.Created, nil
 	}
 
 	status, err := task.Status(ctx)
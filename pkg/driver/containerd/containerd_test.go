@@ -0,0 +1,152 @@
+package driver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/filters"
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/driver/drivertest"
+	"github.com/tmacro/sysctr/pkg/registry"
+)
+
+// TestConformance runs against the local containerd daemon. It is skipped
+// unless SYSCTR_TEST_CONTAINERD is set.
+func TestConformance(t *testing.T) {
+	if os.Getenv("SYSCTR_TEST_CONTAINERD") == "" {
+		t.Skip("SYSCTR_TEST_CONTAINERD not set")
+	}
+
+	drivertest.Run(t, drivertest.Config{
+		New: func(t *testing.T) driver.Driver {
+			d := &ContainerdDriver{Namespace: "sysctr-test"}
+			if err := d.Provision(context.Background()); err != nil {
+				t.Fatalf("Provision: %v", err)
+			}
+
+			t.Cleanup(func() { d.Destroy(context.Background()) })
+
+			return d
+		},
+		Image: "busybox:latest",
+	})
+}
+
+func TestLabelFilter(t *testing.T) {
+	labels := map[string]string{
+		"sh.tmacro.sysctr":      "true",
+		"sh.tmacro.sysctr.name": "my-app",
+	}
+
+	filter, err := filters.Parse(labelFilter(labels))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{"All", map[string]string{"sh.tmacro.sysctr": "true", "sh.tmacro.sysctr.name": "my-app", "other": "x"}, true},
+		{"Partial", map[string]string{"sh.tmacro.sysctr": "true"}, false},
+		{"Mismatch", map[string]string{"sh.tmacro.sysctr": "true", "sh.tmacro.sysctr.name": "other"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adaptor := filters.AdapterFunc(func(fieldpath []string) (string, bool) {
+				if len(fieldpath) != 2 || fieldpath[0] != "labels" {
+					return "", false
+				}
+
+				v, ok := tt.labels[fieldpath[1]]
+				return v, ok
+			})
+
+			if got := filter.Match(adaptor); got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestResolveImageRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"busybox", "docker.io/library/busybox:latest"},
+		{"library/busybox:1.36", "docker.io/library/busybox:1.36"},
+		{"team/app", "docker.io/team/app:latest"},
+		{"registry.internal/app:1.0", "registry.internal/app:1.0"},
+		{"reg:5000/team/app", "reg:5000/team/app:latest"},
+		{"localhost/app", "localhost/app:latest"},
+	}
+
+	for _, tt := range tests {
+		got, err := resolveImageRef(tt.ref)
+		if err != nil {
+			t.Errorf("resolveImageRef(%s): %v", tt.ref, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("resolveImageRef(%s): want %s, got %s", tt.ref, tt.want, got)
+		}
+	}
+
+	if _, err := resolveImageRef("Invalid//ref"); err == nil {
+		t.Error("resolveImageRef of an invalid reference: expected an error")
+	}
+}
+
+// TestResolveImageRefRegistry checks that references of a private registry
+// with a port are resolved by that registry, with its credentials.
+func TestResolveImageRefRegistry(t *testing.T) {
+	const digest = "sha256:2d0f4b2f8b7e0e1f3d6b6d7b1c4f9a8e5c3b2a1d0e9f8a7b6c5d4e3f2a1b0c9d"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "user" || pass != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path != "/v2/team/app/manifests/latest" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Header().Set("Content-Length", "2")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	// The test server listens on 127.0.0.1 with a port, which is served
+	// over plain HTTP like other local registries.
+	host := strings.TrimPrefix(srv.URL, "http://")
+	d := &ContainerdDriver{}
+	d.ConfigureRegistries(registry.Config{host: {Username: "user", Password: "pass", Insecure: true}})
+
+	name, err := resolveImageRef(host + "/team/app")
+	if err != nil {
+		t.Fatalf("resolveImageRef: %v", err)
+	}
+
+	_, desc, err := d.registries.Resolver().Resolve(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Resolve(%s): %v", name, err)
+	}
+
+	if desc.Digest.String() != digest {
+		t.Errorf("digest: want %s, got %s", digest, desc.Digest)
+	}
+}
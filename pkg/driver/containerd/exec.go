@@ -0,0 +1,171 @@
+package driver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"syscall"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+func (d *ContainerdDriver) Exec(ctx context.Context, id string, opts driver.ExecOptions) (int, error) {
+	ctx = namespaces.WithNamespace(ctx, d.Namespace)
+
+	container, err := d.client.LoadContainer(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	task, err := container.Task(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load task: %w", err)
+	}
+
+	spec, err := container.Spec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if spec.Process == nil {
+		return 0, errors.New("container spec has no process")
+	}
+
+	// The command inherits the environment, user and working directory of
+	// the container's main process.
+	pspec := *spec.Process
+	pspec.Args = opts.Command
+	pspec.Terminal = opts.TTY
+
+	execID, err := newExecID()
+	if err != nil {
+		return 0, err
+	}
+
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	var stdin *stdinCloser
+	ioOpts := []cio.Opt{cio.WithStreams(nil, stdout, stderr)}
+	if opts.Stdin != nil {
+		stdin = &stdinCloser{r: opts.Stdin}
+		ioOpts = []cio.Opt{cio.WithStreams(stdin, stdout, stderr)}
+	}
+
+	if opts.TTY {
+		ioOpts = append(ioOpts, cio.WithTerminal)
+	}
+
+	process, err := task.Exec(ctx, execID, &pspec, cio.NewCreator(ioOpts...))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	if stdin != nil {
+		// The command reads its input until the FIFO is closed.
+		stdin.setCloser(func() {
+			process.CloseIO(ctx, containerd.WithStdinCloser)
+		})
+	}
+
+	defer process.Delete(namespaces.WithNamespace(context.Background(), d.Namespace), containerd.WithProcessKill)
+
+	statusC, err := process.Wait(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := process.Start(ctx); err != nil {
+		return 0, fmt.Errorf("failed to start exec: %w", err)
+	}
+
+	if opts.Resize != nil {
+		go func() {
+			for {
+				select {
+				case size := <-opts.Resize:
+					process.Resize(ctx, uint32(size.Width), uint32(size.Height))
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	select {
+	case status := <-statusC:
+		code, _, err := status.Result()
+		if err != nil {
+			return 0, err
+		}
+
+		// Wait for the remaining output to be copied.
+		process.IO().Wait()
+
+		return int(code), nil
+	case <-ctx.Done():
+		process.Kill(namespaces.WithNamespace(context.Background(), d.Namespace), syscall.SIGKILL)
+		return 0, ctx.Err()
+	}
+}
+
+func newExecID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return "exec-" + hex.EncodeToString(b), nil
+}
+
+// stdinCloser closes the input of a process once r returns EOF.
+type stdinCloser struct {
+	r io.Reader
+
+	mu     sync.Mutex
+	eof    bool
+	closer func()
+	once   sync.Once
+}
+
+func (s *stdinCloser) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if errors.Is(err, io.EOF) {
+		s.mu.Lock()
+		s.eof = true
+		closer := s.closer
+		s.mu.Unlock()
+
+		if closer != nil {
+			s.once.Do(closer)
+		}
+	}
+
+	return n, err
+}
+
+// setCloser sets the function closing the input of the process, calling it
+// right away if r already returned EOF.
+func (s *stdinCloser) setCloser(closer func()) {
+	s.mu.Lock()
+	s.closer = closer
+	eof := s.eof
+	s.mu.Unlock()
+
+	if eof {
+		s.once.Do(closer)
+	}
+}
@@ -0,0 +1,60 @@
+package driver
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+
+	"github.com/containerd/containerd/runtime/v2/logging"
+	"github.com/tmacro/sysctr/pkg/logfile"
+)
+
+// loggerCommand is the sysctr subcommand started by the containerd shim to
+// capture the output of a task, see RunLogger.
+const loggerCommand = "containerd-logger"
+
+func (d *ContainerdDriver) logPath(id string) string {
+	return filepath.Join(d.LogDir, d.Namespace, id+".log")
+}
+
+// RunLogger implements the containerd logging binary protocol. The shim
+// passes the task's stdout and stderr as file descriptors and the output is
+// appended to the log file at path. It does not return.
+func RunLogger(path string) {
+	logging.Run(func(ctx context.Context, config *logging.Config, ready func() error) error {
+		w, err := logfile.Create(path)
+		if err != nil {
+			return err
+		}
+
+		defer w.Close()
+
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs[0] = w.Copy(logfile.Stdout, config.Stdout)
+		}()
+
+		go func() {
+			defer wg.Done()
+			errs[1] = w.Copy(logfile.Stderr, config.Stderr)
+		}()
+
+		if err := ready(); err != nil {
+			return err
+		}
+
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/oci"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+const (
+	joinLabel     = "sysctr.driver.containerd.join"
+	sharePIDLabel = "sysctr.driver.containerd.sharePID"
+)
+
+// namespaceFiles are the files under /proc/<pid>/ns of the namespaces
+// joined by the containers of a pod.
+var namespaceFiles = map[specs.LinuxNamespaceType]string{
+	specs.NetworkNamespace: "net",
+	specs.IPCNamespace:     "ipc",
+	specs.PIDNamespace:     "pid",
+}
+
+// namespaceLabels returns the labels recording the container whose
+// namespaces are joined, which are resolved when the container is started.
+func namespaceLabels(ns driver.Namespaces) map[string]string {
+	if ns.Join == "" {
+		return nil
+	}
+
+	labels := map[string]string{joinLabel: ns.Join}
+	if ns.SharePID {
+		labels[sharePIDLabel] = "true"
+	}
+
+	return labels
+}
+
+// joinNamespaces points the namespaces of the spec of container at those of
+// the task of the container it joins. The task may have been restarted
+// since the container was created, so they are updated on every start.
+func (d *ContainerdDriver) joinNamespaces(ctx context.Context, container containerd.Container) error {
+	labels, err := container.Labels(ctx)
+	if err != nil {
+		return err
+	}
+
+	join := labels[joinLabel]
+	if join == "" {
+		return nil
+	}
+
+	joined, err := d.client.LoadContainer(ctx, join)
+	if err != nil {
+		return fmt.Errorf("failed to load joined container %s: %w", join, err)
+	}
+
+	_, status, err := getTaskStatus(ctx, joined)
+	if err != nil {
+		return err
+	}
+
+	if status != driver.Running {
+		return fmt.Errorf("joined container %s is not running", join)
+	}
+
+	task, err := joined.Task(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	nsTypes := []specs.LinuxNamespaceType{specs.NetworkNamespace, specs.IPCNamespace}
+	if labels[sharePIDLabel] == "true" {
+		nsTypes = append(nsTypes, specs.PIDNamespace)
+	}
+
+	opts := make([]oci.SpecOpts, 0, len(nsTypes))
+	for _, t := range nsTypes {
+		opts = append(opts, oci.WithLinuxNamespace(specs.LinuxNamespace{
+			Type: t,
+			Path: fmt.Sprintf("/proc/%d/ns/%s", task.Pid(), namespaceFiles[t]),
+		}))
+	}
+
+	spec, err := container.Spec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return container.Update(ctx, containerd.UpdateContainerOpts(containerd.WithSpec(spec, opts...)))
+}
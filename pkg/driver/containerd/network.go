@@ -0,0 +1,172 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/oci"
+	gocni "github.com/containerd/go-cni"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+const (
+	defaultCNIConfDir = "/etc/cni/net.d"
+	defaultCNIBinDir  = "/opt/cni/bin"
+	networkLabel      = "sysctr.driver.containerd.network"
+)
+
+// defaultCNIConfList is used for bridge networking when no configuration is
+// found in the CNI configuration directory.
+const defaultCNIConfList = `{
+  "cniVersion": "1.0.0",
+  "name": "sysctr",
+  "plugins": [
+    {
+      "type": "bridge",
+      "bridge": "sysctr0",
+      "isGateway": true,
+      "ipMasq": true,
+      "hairpinMode": true,
+      "ipam": {
+        "type": "host-local",
+        "ranges": [[{ "subnet": "10.89.0.0/16" }]],
+        "routes": [{ "dst": "0.0.0.0/0" }]
+      }
+    },
+    {
+      "type": "portmap",
+      "capabilities": { "portMappings": true }
+    }
+  ]
+}`
+
+// networkSpecOpts returns the OCI spec options setting up the network
+// namespace of a container. Bridge networking is attached to the namespace
+// once the task exists, see setupNetwork.
+func networkSpecOpts(network driver.Network) []oci.SpecOpts {
+	switch network.Mode {
+	case driver.NetworkNone:
+		return nil
+	case driver.NetworkBridge:
+		return []oci.SpecOpts{oci.WithHostResolvconf}
+	default:
+		return []oci.SpecOpts{
+			oci.WithHostNamespace(specs.NetworkNamespace),
+			oci.WithHostHostsFile,
+			oci.WithHostResolvconf,
+		}
+	}
+}
+
+func networkFromLabels(labels map[string]string) (driver.Network, error) {
+	var network driver.Network
+
+	raw, ok := labels[networkLabel]
+	if !ok {
+		return driver.Network{Mode: driver.NetworkHost}, nil
+	}
+
+	err := json.Unmarshal([]byte(raw), &network)
+	return network, err
+}
+
+func (d *ContainerdDriver) loadCNI() (gocni.CNI, error) {
+	d.cniOnce.Do(func() {
+		d.cni, d.cniErr = gocni.New(
+			gocni.WithMinNetworkCount(2),
+			gocni.WithPluginConfDir(d.CNIConfDir),
+			gocni.WithPluginDir([]string{d.CNIBinDir}),
+			gocni.WithInterfacePrefix("eth"),
+		)
+		if d.cniErr != nil {
+			return
+		}
+
+		d.cniErr = d.cni.Load(gocni.WithLoNetwork, gocni.WithDefaultConf)
+		if errors.Is(d.cniErr, gocni.ErrCNINotInitialized) {
+			d.cniErr = d.cni.Load(gocni.WithLoNetwork, gocni.WithConfListBytes([]byte(defaultCNIConfList)))
+		}
+	})
+
+	return d.cni, d.cniErr
+}
+
+func cniPortMappings(ports []driver.Port) []gocni.PortMapping {
+	mappings := make([]gocni.PortMapping, len(ports))
+	for i, p := range ports {
+		mappings[i] = gocni.PortMapping{
+			HostPort:      int32(p.HostPort),
+			ContainerPort: int32(p.ContainerPort),
+			Protocol:      p.Protocol,
+			HostIP:        p.HostIP,
+		}
+	}
+
+	return mappings
+}
+
+// setupNetwork attaches the network namespace of a created task to the CNI
+// network, publishing the container's ports.
+func (d *ContainerdDriver) setupNetwork(ctx context.Context, container containerd.Container, task containerd.Task) error {
+	labels, err := container.Labels(ctx)
+	if err != nil {
+		return err
+	}
+
+	network, err := networkFromLabels(labels)
+	if err != nil {
+		return err
+	}
+
+	if network.Mode != driver.NetworkBridge {
+		return nil
+	}
+
+	cni, err := d.loadCNI()
+	if err != nil {
+		return fmt.Errorf("failed to load cni configuration: %w", err)
+	}
+
+	portMap := gocni.WithCapabilityPortMap(cniPortMappings(network.Ports))
+	netns := fmt.Sprintf("/proc/%d/ns/net", task.Pid())
+
+	// Release anything left behind by a previous task of the container.
+	_ = cni.Remove(ctx, container.ID(), "", portMap)
+
+	_, err = cni.Setup(ctx, container.ID(), netns, portMap)
+	if err != nil {
+		return fmt.Errorf("failed to setup network: %w", err)
+	}
+
+	return nil
+}
+
+// teardownNetwork releases the CNI network resources held by a container.
+func (d *ContainerdDriver) teardownNetwork(ctx context.Context, container containerd.Container) error {
+	labels, err := container.Labels(ctx)
+	if err != nil {
+		return err
+	}
+
+	network, err := networkFromLabels(labels)
+	if err != nil {
+		return err
+	}
+
+	if network.Mode != driver.NetworkBridge {
+		return nil
+	}
+
+	cni, err := d.loadCNI()
+	if err != nil {
+		return fmt.Errorf("failed to load cni configuration: %w", err)
+	}
+
+	// The network namespace is gone with the task, the plugins only need
+	// to release the resources allocated to the container.
+	return cni.Remove(ctx, container.ID(), "", gocni.WithCapabilityPortMap(cniPortMappings(network.Ports)))
+}
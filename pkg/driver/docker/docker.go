@@ -6,7 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 
@@ -16,7 +19,9 @@ import (
 	dockerMounts "github.com/docker/docker/api/types/mount"
 	dockerClient "github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
 	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/registry"
 )
 
 func init() {
@@ -24,7 +29,8 @@ func init() {
 }
 
 type DockerDriver struct {
-	client *dockerClient.Client
+	client     *dockerClient.Client
+	registries registry.Config
 }
 
 func (d *DockerDriver) DriverInfo() driver.DriverInfo {
@@ -39,6 +45,10 @@ type pullLogLine struct {
 	Status string `json:"status"`
 }
 
+func (d *DockerDriver) ServiceDependencies() []string {
+	return []string{"docker.service"}
+}
+
 func (d *DockerDriver) Provision(ctx context.Context) error {
 	var err error
 	d.client, err = dockerClient.NewClientWithOpts(dockerClient.WithAPIVersionNegotiation())
@@ -49,8 +59,20 @@ func (d *DockerDriver) Provision(ctx context.Context) error {
 	return nil
 }
 
+// ConfigureRegistries sets the credentials sent to registries. Their
+// certificate authorities and insecure option are configured in the Docker
+// daemon.
+func (d *DockerDriver) ConfigureRegistries(registries registry.Config) {
+	d.registries = registries
+}
+
 func (d *DockerDriver) PullImage(ctx context.Context, imageRef string) error {
-	resp, err := d.client.ImagePull(ctx, imageRef, dockerImage.PullOptions{})
+	auth, err := d.registries.EncodeAuth(imageRef)
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.client.ImagePull(ctx, imageRef, dockerImage.PullOptions{RegistryAuth: auth})
 	if err != nil {
 		return err
 	}
@@ -88,9 +110,102 @@ func (d *DockerDriver) PullImage(ctx context.Context, imageRef string) error {
 	return scanner.Err()
 }
 
+// ImageDigest returns the repository digest of the image, or its ID if it
+// was not pulled from a registry.
+func (d *DockerDriver) ImageDigest(ctx context.Context, imageRef string) (string, error) {
+	inspect, _, err := d.client.ImageInspectWithRaw(ctx, imageRef)
+	if dockerClient.IsErrNotFound(err) {
+		return "", fmt.Errorf("%w: %s", driver.ErrImageNotFound, imageRef)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if digest := driver.RepoDigest(imageRef, inspect.RepoDigests); digest != "" {
+		return digest, nil
+	}
+
+	return inspect.ID, nil
+}
+
+func (d *DockerDriver) TagImage(ctx context.Context, imageRef, target string) error {
+	err := d.client.ImageTag(ctx, imageRef, target)
+	if dockerClient.IsErrNotFound(err) {
+		return fmt.Errorf("%w: %s", driver.ErrImageNotFound, imageRef)
+	}
+
+	return err
+}
+
+type loadLogLine struct {
+	Stream string `json:"stream"`
+	Error  string `json:"error"`
+}
+
+func (d *DockerDriver) LoadImages(ctx context.Context, r io.Reader) ([]string, error) {
+	resp, err := d.client.ImageLoad(ctx, r, true)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	// The daemon reports each image loaded, such as
+	// "Loaded image: busybox:latest" or "Loaded image ID: sha256:..." for
+	// images without a name.
+	var names []string
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var line loadLogLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, err
+		}
+
+		if line.Error != "" {
+			return nil, fmt.Errorf("failed to load images: %s", line.Error)
+		}
+
+		stream := strings.TrimSpace(line.Stream)
+		if name, ok := strings.CutPrefix(stream, "Loaded image: "); ok {
+			names = append(names, name)
+		} else if id, ok := strings.CutPrefix(stream, "Loaded image ID: "); ok {
+			names = append(names, id)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+func (d *DockerDriver) SaveImages(ctx context.Context, w io.Writer, imageRefs []string) error {
+	for _, ref := range imageRefs {
+		if _, _, err := d.client.ImageInspectWithRaw(ctx, ref); dockerClient.IsErrNotFound(err) {
+			return fmt.Errorf("%w: %s", driver.ErrImageNotFound, ref)
+		}
+	}
+
+	rc, err := d.client.ImageSave(ctx, imageRefs)
+	if err != nil {
+		return err
+	}
+
+	defer rc.Close()
+
+	_, err = io.Copy(w, rc)
+
+	return err
+}
+
 func (d *DockerDriver) FindContainer(ctx context.Context, name string, labels map[string]string) (*driver.Status, error) {
+	// The name filter is a regular expression matched against names with
+	// a leading slash, anchor it to match the name only.
 	filter := dockerFilters.NewArgs()
-	filter.Add("name", name)
+	filter.Add("name", "^/"+regexp.QuoteMeta(name)+"$")
 	for k, v := range labels {
 		filter.Add("label", fmt.Sprintf("%s=%s", k, v))
 	}
@@ -112,13 +227,49 @@ func (d *DockerDriver) FindContainer(ctx context.Context, name string, labels ma
 		return nil, fmt.Errorf("found multiple containers with name %s", name)
 	}
 
-	container := containers[0]
+	// The exit code and start time are only available by inspecting the
+	// container.
+	status, err := d.ContainerStatus(ctx, containers[0].ID)
+	if dockerClient.IsErrNotFound(err) {
+		// Removed since it was listed.
+		return nil, driver.ErrContainerNotFound
+	}
+
+	return status, err
+}
+
+func (d *DockerDriver) ListContainers(ctx context.Context, labels map[string]string) ([]driver.Status, error) {
+	filter := dockerFilters.NewArgs()
+	for k, v := range labels {
+		filter.Add("label", fmt.Sprintf("%s=%s", k, v))
+	}
+
+	containers, err := d.client.ContainerList(ctx, dockerContainer.ListOptions{
+		All:     true,
+		Filters: filter,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
 
-	return &driver.Status{
-		ID:     container.ID,
-		Status: convertDockerStatus(container.State),
-		Labels: container.Labels,
-	}, nil
+	// The exit code and start time are only available by inspecting each
+	// container.
+	statuses := make([]driver.Status, 0, len(containers))
+	for _, c := range containers {
+		status, err := d.ContainerStatus(ctx, c.ID)
+		if dockerClient.IsErrNotFound(err) {
+			// Removed since it was listed.
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, *status)
+	}
+
+	return statuses, nil
 }
 
 func convertDockerStatus(status string) driver.ContainerStatus {
@@ -150,9 +301,17 @@ func (d *DockerDriver) ContainerStatus(ctx context.Context, id string) (*driver.
 	}
 
 	status := driver.Status{
-		ID:     id,
-		Status: containerStatus,
-		Labels: container.Config.Labels,
+		ID:          id,
+		Name:        strings.TrimPrefix(container.Name, "/"),
+		Image:       container.Config.Image,
+		Status:      containerStatus,
+		Labels:      container.Config.Labels,
+		Annotations: container.Config.Labels,
+	}
+
+	startedAt, err := time.Parse(time.RFC3339Nano, container.State.StartedAt)
+	if err == nil && startedAt.After(time.Time{}) {
+		status.StartedAt = startedAt
 	}
 
 	if container.State.ExitCode != 0 {
@@ -162,6 +321,21 @@ func (d *DockerDriver) ContainerStatus(ctx context.Context, id string) (*driver.
 	return &status, nil
 }
 
+// mergeLabels returns the labels of a container. Docker has no size limit on
+// labels, so annotations are stored as labels too.
+func mergeLabels(labels, annotations map[string]string) map[string]string {
+	merged := make(map[string]string, len(labels)+len(annotations))
+	for k, v := range annotations {
+		merged[k] = v
+	}
+
+	for k, v := range labels {
+		merged[k] = v
+	}
+
+	return merged
+}
+
 func convertEnv(env map[string]string) []string {
 	if env == nil {
 		return []string{}
@@ -174,13 +348,50 @@ func convertEnv(env map[string]string) []string {
 	return envs
 }
 
+func convertPorts(ports []driver.Port) (nat.PortSet, nat.PortMap, error) {
+	exposed := make(nat.PortSet, len(ports))
+	bindings := make(nat.PortMap, len(ports))
+
+	for _, p := range ports {
+		port, err := nat.NewPort(p.Protocol, strconv.Itoa(p.ContainerPort))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		exposed[port] = struct{}{}
+		bindings[port] = append(bindings[port], nat.PortBinding{
+			HostIP:   p.HostIP,
+			HostPort: strconv.Itoa(p.HostPort),
+		})
+	}
+
+	return exposed, bindings, nil
+}
+
+func convertResources(res driver.Resources) dockerContainer.Resources {
+	resources := dockerContainer.Resources{
+		CPUShares:         res.CPUShares,
+		CPUPeriod:         res.CPUPeriod,
+		CPUQuota:          res.CPUQuota,
+		Memory:            res.MemoryLimit,
+		MemoryReservation: res.MemoryReservation,
+		BlkioWeight:       res.BlkioWeight,
+	}
+
+	if res.PidsLimit > 0 {
+		resources.PidsLimit = &res.PidsLimit
+	}
+
+	return resources
+}
+
 func (d *DockerDriver) CreateContainer(ctx context.Context, spec *driver.Spec) (string, error) {
 	containerConfig := dockerContainer.Config{
 		Image:      spec.Image,
 		Entrypoint: spec.Command,
 		Cmd:        spec.Arguments,
 		Env:        convertEnv(spec.Environment),
-		Labels:     spec.Labels,
+		Labels:     mergeLabels(spec.Labels, spec.Annotations),
 	}
 
 	mounts := make([]dockerMounts.Mount, 0)
@@ -193,9 +404,34 @@ func (d *DockerDriver) CreateContainer(ctx context.Context, spec *driver.Spec) (
 		})
 	}
 
+	exposedPorts, portBindings, err := convertPorts(spec.Network.Ports)
+	if err != nil {
+		return "", err
+	}
+
+	containerConfig.ExposedPorts = exposedPorts
+
+	networkMode := spec.Network.Mode
+	if networkMode == "" {
+		networkMode = driver.NetworkHost
+	}
+
 	hostConfig := dockerContainer.HostConfig{
-		NetworkMode: "host",
-		Mounts:      mounts,
+		NetworkMode:  dockerContainer.NetworkMode(networkMode),
+		Mounts:       mounts,
+		PortBindings: portBindings,
+		Resources:    convertResources(spec.Resources),
+	}
+
+	if join := spec.Namespaces.Join; join != "" {
+		hostConfig.NetworkMode = dockerContainer.NetworkMode("container:" + join)
+		hostConfig.IpcMode = dockerContainer.IpcMode("container:" + join)
+
+		if spec.Namespaces.SharePID {
+			hostConfig.PidMode = dockerContainer.PidMode("container:" + join)
+		}
+	} else if spec.Namespaces.Shareable {
+		hostConfig.IpcMode = dockerContainer.IPCModeShareable
 	}
 
 	container, err := d.client.ContainerCreate(ctx, &containerConfig, &hostConfig, nil, nil, spec.Name)
@@ -210,8 +446,12 @@ func (d *DockerDriver) StartContainer(ctx context.Context, id string) error {
 	return d.client.ContainerStart(ctx, id, dockerContainer.StartOptions{})
 }
 
-func (d *DockerDriver) StopContainer(ctx context.Context, id string) error {
-	return d.client.ContainerStop(ctx, id, dockerContainer.StopOptions{})
+func (d *DockerDriver) StopContainer(ctx context.Context, id string, opts driver.StopOptions) error {
+	timeout := int(opts.Timeout.Seconds())
+	return d.client.ContainerStop(ctx, id, dockerContainer.StopOptions{
+		Signal:  opts.Signal,
+		Timeout: &timeout,
+	})
 }
 
 func (d *DockerDriver) RemoveContainer(ctx context.Context, id string) error {
@@ -230,18 +470,43 @@ func (d *DockerDriver) WaitForExit(ctx context.Context, id string) error {
 	}
 }
 
-func (d *DockerDriver) GetLogs(ctx context.Context, id string, stdout, stderr io.Writer) error {
-	reader, err := d.client.ContainerLogs(ctx, id, dockerContainer.LogsOptions{
+func (d *DockerDriver) GetLogs(ctx context.Context, id string, opts driver.LogOptions) error {
+	logsOpts := dockerContainer.LogsOptions{
 		ShowStdout: true,
 		ShowStderr: true,
-		Follow:     true,
-	})
+		Follow:     opts.Follow,
+		Timestamps: opts.Timestamps,
+		Tail:       "all",
+	}
+
+	if !opts.Since.IsZero() {
+		logsOpts.Since = opts.Since.Format(time.RFC3339Nano)
+	}
+
+	if !opts.Until.IsZero() {
+		logsOpts.Until = opts.Until.Format(time.RFC3339Nano)
+	}
+
+	if opts.Tail >= 0 {
+		logsOpts.Tail = strconv.Itoa(opts.Tail)
+	}
+
+	reader, err := d.client.ContainerLogs(ctx, id, logsOpts)
 	if err != nil {
 		return err
 	}
 
 	defer reader.Close()
 
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
 	_, err = stdcopy.StdCopy(stdout, stderr, reader)
 	if err != nil {
 		return err
@@ -249,3 +514,85 @@ func (d *DockerDriver) GetLogs(ctx context.Context, id string, stdout, stderr io
 
 	return nil
 }
+
+func (d *DockerDriver) Exec(ctx context.Context, id string, opts driver.ExecOptions) (int, error) {
+	exec, err := d.client.ContainerExecCreate(ctx, id, dockerContainer.ExecOptions{
+		Cmd:          opts.Command,
+		Tty:          opts.TTY,
+		AttachStdin:  opts.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	resp, err := d.client.ContainerExecAttach(ctx, exec.ID, dockerContainer.ExecAttachOptions{
+		Tty: opts.TTY,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to attach to exec: %w", err)
+	}
+
+	defer resp.Close()
+
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	if opts.Stdin != nil {
+		go func() {
+			io.Copy(resp.Conn, opts.Stdin)
+			resp.CloseWrite()
+		}()
+	}
+
+	if opts.Resize != nil {
+		go func() {
+			for {
+				select {
+				case size := <-opts.Resize:
+					d.client.ContainerExecResize(ctx, exec.ID, dockerContainer.ResizeOptions{
+						Height: size.Height,
+						Width:  size.Width,
+					})
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	copied := make(chan error, 1)
+	go func() {
+		var err error
+		// The output of a terminal is not multiplexed.
+		if opts.TTY {
+			_, err = io.Copy(stdout, resp.Reader)
+		} else {
+			_, err = stdcopy.StdCopy(stdout, stderr, resp.Reader)
+		}
+		copied <- err
+	}()
+
+	select {
+	case err := <-copied:
+		if err != nil {
+			return 0, err
+		}
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	inspect, err := d.client.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect exec: %w", err)
+	}
+
+	return inspect.ExitCode, nil
+}
@@ -0,0 +1,30 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/driver/drivertest"
+)
+
+// TestConformance runs against the local Docker daemon. It is skipped unless
+// SYSCTR_TEST_DOCKER is set.
+func TestConformance(t *testing.T) {
+	if os.Getenv("SYSCTR_TEST_DOCKER") == "" {
+		t.Skip("SYSCTR_TEST_DOCKER not set")
+	}
+
+	drivertest.Run(t, drivertest.Config{
+		New: func(t *testing.T) driver.Driver {
+			d := new(DockerDriver)
+			if err := d.Provision(context.Background()); err != nil {
+				t.Fatalf("Provision: %v", err)
+			}
+
+			return d
+		},
+		Image: "busybox:latest",
+	})
+}
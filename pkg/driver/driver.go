@@ -4,20 +4,36 @@ import (
 	"context"
 	"errors"
 	"io"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/registry"
 )
 
 type Driver interface {
 	DriverInfo() DriverInfo
 
 	PullImage(ctx context.Context, image string) error
+	// ImageDigest returns the digest of the local image, the digest of the
+	// manifest it was pulled by when known. It returns ErrImageNotFound if
+	// the image has not been pulled.
+	ImageDigest(ctx context.Context, image string) (string, error)
+	// LoadImages imports the images of an archive, either a Docker image
+	// archive or an OCI image layout, and returns their names.
+	LoadImages(ctx context.Context, r io.Reader) ([]string, error)
+	// SaveImages writes the local images to w as a Docker image archive,
+	// which LoadImages of any driver imports. It returns ErrImageNotFound
+	// if an image has not been pulled.
+	SaveImages(ctx context.Context, w io.Writer, images []string) error
 	FindContainer(ctx context.Context, name string, labels map[string]string) (*Status, error)
+	ListContainers(ctx context.Context, labels map[string]string) ([]Status, error)
 	ContainerStatus(ctx context.Context, id string) (*Status, error)
 	CreateContainer(ctx context.Context, spec *Spec) (string, error)
 	StartContainer(ctx context.Context, id string) error
-	StopContainer(ctx context.Context, id string) error
+	StopContainer(ctx context.Context, id string, opts StopOptions) error
 	RemoveContainer(ctx context.Context, id string) error
 	WaitForExit(ctx context.Context, id string) error
-	GetLogs(ctx context.Context, id string, stdout, stderr io.Writer) error
+	GetLogs(ctx context.Context, id string, opts LogOptions) error
+	Exec(ctx context.Context, id string, opts ExecOptions) (int, error)
 }
 
 type DriverInfo struct {
@@ -33,14 +49,127 @@ type Destructor interface {
 	Destroy(ctx context.Context) error
 }
 
+// RegistryConfigurer is implemented by drivers pulling images from
+// registries, which authenticate with the configured credentials.
+type RegistryConfigurer interface {
+	ConfigureRegistries(registries registry.Config)
+}
+
+// ServiceDependent is implemented by drivers relying on system services, such
+// as the daemon of their container runtime. Units generated for containers
+// are ordered after them.
+type ServiceDependent interface {
+	ServiceDependencies() []string
+}
+
+// ImageTagger is implemented by drivers able to name a local image with
+// another reference, which keeps the image available once its name is
+// pulled again.
+type ImageTagger interface {
+	// TagImage names the local image with target. It returns
+	// ErrImageNotFound if the image has not been pulled.
+	TagImage(ctx context.Context, image, target string) error
+}
+
 type Spec struct {
-	Name        string
-	Image       string
-	Labels      map[string]string
+	Name   string
+	Image  string
+	Labels map[string]string
+	// Annotations hold metadata too large for labels, such as the spec the
+	// container was created from. They are returned in Status but can not
+	// be used to filter containers.
+	Annotations map[string]string
 	Command     []string
 	Arguments   []string
 	Environment map[string]string
 	Volumes     []Volume
+	Network     Network
+	Resources   Resources
+	// Namespaces shares namespaces between the containers of a pod.
+	Namespaces Namespaces
+}
+
+// Namespaces shares the namespaces of a container with the other containers
+// of a pod.
+type Namespaces struct {
+	// Join is the ID of the container whose network and IPC namespaces the
+	// container joins, and its PID namespace if SharePID is set. The network
+	// of the spec is ignored. The joined container must be running whenever
+	// the container is started.
+	Join     string
+	SharePID bool
+	// Shareable makes the IPC namespace of the container joinable by
+	// others.
+	Shareable bool
+}
+
+// Resources constrains the host resources a container may use. Zero values
+// leave the runtime's defaults in place. Memory sizes are in bytes, CPU
+// periods and quotas in microseconds.
+type Resources struct {
+	CPUShares         int64
+	CPUPeriod         int64
+	CPUQuota          int64
+	MemoryLimit       int64
+	MemoryReservation int64
+	PidsLimit         int64
+	BlkioWeight       uint16
+}
+
+const (
+	DefaultStopSignal  = "SIGTERM"
+	DefaultStopTimeout = 10 * time.Second
+)
+
+// StopOptions controls how a container is stopped. The signal is sent to the
+// container's main process and, if it is still running once the timeout
+// elapses, the container is killed with SIGKILL.
+type StopOptions struct {
+	Signal  string
+	Timeout time.Duration
+}
+
+// ExecOptions describes a command run inside a running container. Exec
+// returns the exit code of the command once it exits. Nil writers discard
+// the output.
+type ExecOptions struct {
+	Command []string
+	// Stdin is copied to the standard input of the command, which is
+	// closed once Stdin returns EOF. The command has no input when nil.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// TTY runs the command in a terminal. Its output is written to Stdout.
+	TTY bool
+	// Resize receives the size of the terminal whenever it changes.
+	Resize <-chan TerminalSize
+}
+
+type TerminalSize struct {
+	Width  uint
+	Height uint
+}
+
+// TailAll returns all output of a container from GetLogs.
+const TailAll = -1
+
+// LogOptions selects the output of a container copied by GetLogs. Nil
+// writers discard the stream.
+type LogOptions struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	// Follow keeps copying output until the container exits.
+	Follow bool
+	// Since and Until limit the output to lines written within the time
+	// range. Zero values leave the range open.
+	Since time.Time
+	Until time.Time
+	// Tail is the number of lines from the end of the output to copy, or
+	// TailAll.
+	Tail int
+	// Timestamps prefixes each line with the time it was written, in
+	// RFC 3339 format.
+	Timestamps bool
 }
 
 type Volume struct {
@@ -49,6 +178,33 @@ type Volume struct {
 	ReadOnly bool
 }
 
+type NetworkMode string
+
+const (
+	// NetworkHost shares the network namespace of the host. It is the
+	// default when no mode is set.
+	NetworkHost NetworkMode = "host"
+	// NetworkNone gives the container a network namespace with no
+	// connectivity.
+	NetworkNone NetworkMode = "none"
+	// NetworkBridge connects the container to a bridge network, reachable
+	// from the host through the published ports.
+	NetworkBridge NetworkMode = "bridge"
+)
+
+type Network struct {
+	Mode  NetworkMode
+	Ports []Port
+}
+
+// Port publishes a container port on the host.
+type Port struct {
+	ContainerPort int
+	HostPort      int
+	HostIP        string
+	Protocol      string
+}
+
 type ContainerStatus string
 
 func (s ContainerStatus) String() string {
@@ -63,12 +219,30 @@ const (
 )
 
 type Status struct {
-	ID       string
-	Status   ContainerStatus
-	Labels   map[string]string
-	ExitCode int
+	ID     string
+	Name   string
+	Image  string
+	Status ContainerStatus
+	Labels map[string]string
+	// Annotations are the annotations the container was created with.
+	Annotations map[string]string
+	ExitCode    int
+	// StartedAt is the time the container was last started, zero if it has
+	// never been started.
+	StartedAt time.Time
 }
 
 var (
 	ErrContainerNotFound = errors.New("container not found")
+	ErrImageNotFound     = errors.New("image not found")
+
+	// ErrDriverNotFound is returned when loading a driver that is not
+	// registered.
+	ErrDriverNotFound = errors.New("driver not found")
+	// ErrInvalidConfig is returned when the configuration of a driver can
+	// not be decoded.
+	ErrInvalidConfig = errors.New("invalid driver configuration")
+	// ErrDriverUnavailable is returned when a driver fails to provision,
+	// usually because its runtime can not be reached.
+	ErrDriverUnavailable = errors.New("driver unavailable")
 )
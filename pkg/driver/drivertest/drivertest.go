@@ -0,0 +1,871 @@
+// Package drivertest provides a conformance suite for driver.Driver
+// implementations. Every driver is expected to pass it, which guarantees the
+// runner sees identical semantics regardless of the container runtime.
+package drivertest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distribution/reference"
+	godigest "github.com/opencontainers/go-digest"
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+const labelConformance = "sh.tmacro.sysctr.conformance"
+
+// stopOptions keeps the suite fast, a shell running as PID 1 ignores SIGTERM.
+var stopOptions = driver.StopOptions{
+	Signal:  driver.DefaultStopSignal,
+	Timeout: 2 * time.Second,
+}
+
+// Config describes how to run the conformance suite against a driver.
+type Config struct {
+	// New returns a ready to use driver. It is called once per test.
+	New func(t *testing.T) driver.Driver
+
+	// Image is an image providing a POSIX shell at /bin/sh.
+	Image string
+
+	// Timeout bounds every test. Defaults to one minute.
+	Timeout time.Duration
+}
+
+// Run runs the conformance suite against the driver described by cfg.
+func Run(t *testing.T, cfg Config) {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = time.Minute
+	}
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, h *harness)
+	}{
+		{"ImageDigest", testImageDigest},
+		{"ImageDigest/Pinned", testImageDigestPinned},
+		{"ImageDigest/NotFound", testImageDigestNotFound},
+		{"ImageArchive", testImageArchive},
+		{"ImageArchive/NotFound", testImageArchiveNotFound},
+		{"FindContainer/NotFound", testFindContainerNotFound},
+		{"FindContainer/Created", testFindContainerCreated},
+		{"FindContainer/Name", testFindContainerName},
+		{"FindContainer/Exited", testFindContainerExited},
+		{"FindContainer/LabelMismatch", testFindContainerLabelMismatch},
+		{"ListContainers", testListContainers},
+		{"ListContainers/LabelMismatch", testListContainersLabelMismatch},
+		{"ContainerStatus/Lifecycle", testContainerStatusLifecycle},
+		{"ContainerStatus/ExitCode", testContainerStatusExitCode},
+		{"StartContainer/Restart", testStartContainerRestart},
+		{"StartContainer/AlreadyRunning", testStartContainerAlreadyRunning},
+		{"StopContainer", testStopContainer},
+		{"StopContainer/Timeout", testStopContainerTimeout},
+		{"RemoveContainer", testRemoveContainer},
+		{"RemoveContainer/Running", testRemoveContainerRunning},
+		{"WaitForExit/Exited", testWaitForExitExited},
+		{"WaitForExit/Cancelled", testWaitForExitCancelled},
+		{"GetLogs/Streams", testGetLogsStreams},
+		{"GetLogs/Follow", testGetLogsFollow},
+		{"GetLogs/Tail", testGetLogsTail},
+		{"GetLogs/Since", testGetLogsSince},
+		{"GetLogs/Timestamps", testGetLogsTimestamps},
+		{"Exec", testExec},
+		{"Exec/Stdin", testExecStdin},
+		{"Exec/TTY", testExecTTY},
+		{"Annotations", testAnnotations},
+		{"Namespaces", testNamespaces},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+			defer cancel()
+
+			h := &harness{
+				ctx: ctx,
+				drv: cfg.New(t),
+				cfg: cfg,
+			}
+
+			if err := h.drv.PullImage(ctx, cfg.Image); err != nil {
+				t.Fatalf("PullImage(%s): %v", cfg.Image, err)
+			}
+
+			tt.fn(t, h)
+		})
+	}
+}
+
+type harness struct {
+	ctx context.Context
+	drv driver.Driver
+	cfg Config
+}
+
+func randomName(t *testing.T) string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+
+	return "sysctr-conformance-" + hex.EncodeToString(b)
+}
+
+// create creates a container running script with /bin/sh and registers its
+// removal with t.Cleanup.
+func (h *harness) create(t *testing.T, script string) (string, *driver.Spec) {
+	t.Helper()
+
+	return h.createWith(t, script, driver.Namespaces{})
+}
+
+// createWith creates a container like create, sharing namespaces as ns asks.
+func (h *harness) createWith(t *testing.T, script string, ns driver.Namespaces) (string, *driver.Spec) {
+	t.Helper()
+
+	return h.createNamed(t, randomName(t), script, ns)
+}
+
+// createNamed creates a container like createWith, named name.
+func (h *harness) createNamed(t *testing.T, name, script string, ns driver.Namespaces) (string, *driver.Spec) {
+	t.Helper()
+
+	spec := &driver.Spec{
+		Name:    name,
+		Image:   h.cfg.Image,
+		Command: []string{"/bin/sh", "-c"},
+		Arguments: []string{
+			script,
+		},
+		Labels: map[string]string{
+			labelConformance:           "true",
+			labelConformance + ".name": name,
+		},
+		Annotations: map[string]string{
+			// Larger than the labels of some runtimes may be.
+			labelConformance + ".blob": strings.Repeat("x", 8192),
+		},
+		Namespaces: ns,
+	}
+
+	id, err := h.drv.CreateContainer(h.ctx, spec)
+	if err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), h.cfg.Timeout)
+		defer cancel()
+
+		if err := h.drv.StopContainer(ctx, id, stopOptions); err != nil {
+			t.Logf("cleanup: StopContainer: %v", err)
+		}
+
+		if err := h.drv.RemoveContainer(ctx, id); err != nil {
+			t.Logf("cleanup: RemoveContainer: %v", err)
+		}
+	})
+
+	return id, spec
+}
+
+func (h *harness) start(t *testing.T, id string) {
+	t.Helper()
+
+	if err := h.drv.StartContainer(h.ctx, id); err != nil {
+		t.Fatalf("StartContainer: %v", err)
+	}
+}
+
+func (h *harness) wait(t *testing.T, id string) {
+	t.Helper()
+
+	if err := h.drv.WaitForExit(h.ctx, id); err != nil {
+		t.Fatalf("WaitForExit: %v", err)
+	}
+}
+
+func (h *harness) status(t *testing.T, id string) *driver.Status {
+	t.Helper()
+
+	status, err := h.drv.ContainerStatus(h.ctx, id)
+	if err != nil {
+		t.Fatalf("ContainerStatus: %v", err)
+	}
+
+	return status
+}
+
+func testImageDigest(t *testing.T, h *harness) {
+	digest, err := h.drv.ImageDigest(h.ctx, h.cfg.Image)
+	if err != nil {
+		t.Fatalf("ImageDigest: %v", err)
+	}
+
+	if _, err := godigest.Parse(digest); err != nil {
+		t.Errorf("ImageDigest: %q is not a digest: %v", digest, err)
+	}
+}
+
+func testImageDigestPinned(t *testing.T, h *harness) {
+	digest, err := h.drv.ImageDigest(h.ctx, h.cfg.Image)
+	if err != nil {
+		t.Fatalf("ImageDigest: %v", err)
+	}
+
+	named, err := reference.ParseNormalizedNamed(h.cfg.Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinned := reference.TrimNamed(named).String() + "@" + digest
+	if err := h.drv.PullImage(h.ctx, pinned); err != nil {
+		t.Fatalf("PullImage(%s): %v", pinned, err)
+	}
+
+	got, err := h.drv.ImageDigest(h.ctx, pinned)
+	if err != nil {
+		t.Fatalf("ImageDigest(%s): %v", pinned, err)
+	}
+
+	if got != digest {
+		t.Errorf("ImageDigest(%s): want %s, got %s", pinned, digest, got)
+	}
+}
+
+func testImageDigestNotFound(t *testing.T, h *harness) {
+	_, err := h.drv.ImageDigest(h.ctx, "localhost/"+randomName(t)+":latest")
+	if !errors.Is(err, driver.ErrImageNotFound) {
+		t.Fatalf("ImageDigest: want ErrImageNotFound, got %v", err)
+	}
+}
+
+func testImageArchive(t *testing.T, h *harness) {
+	var archive bytes.Buffer
+	if err := h.drv.SaveImages(h.ctx, &archive, []string{h.cfg.Image}); err != nil {
+		t.Fatalf("SaveImages: %v", err)
+	}
+
+	names, err := h.drv.LoadImages(h.ctx, &archive)
+	if err != nil {
+		t.Fatalf("LoadImages: %v", err)
+	}
+
+	// Drivers name images either as given or fully qualified.
+	want, err := reference.ParseDockerRef(h.cfg.Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, name := range names {
+		if named, err := reference.ParseDockerRef(name); err == nil && named.String() == want.String() {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("LoadImages: want %s, got %v", want, names)
+	}
+
+	id, _ := h.create(t, "exit 0")
+	h.start(t, id)
+	h.wait(t, id)
+}
+
+func testImageArchiveNotFound(t *testing.T, h *harness) {
+	var archive bytes.Buffer
+
+	err := h.drv.SaveImages(h.ctx, &archive, []string{"localhost/" + randomName(t) + ":latest"})
+	if !errors.Is(err, driver.ErrImageNotFound) {
+		t.Fatalf("SaveImages: want ErrImageNotFound, got %v", err)
+	}
+}
+
+func testFindContainerNotFound(t *testing.T, h *harness) {
+	name := randomName(t)
+
+	_, err := h.drv.FindContainer(h.ctx, name, map[string]string{labelConformance: "true"})
+	if !errors.Is(err, driver.ErrContainerNotFound) {
+		t.Fatalf("FindContainer: want ErrContainerNotFound, got %v", err)
+	}
+}
+
+func testFindContainerCreated(t *testing.T, h *harness) {
+	id, spec := h.create(t, "exit 0")
+
+	status, err := h.drv.FindContainer(h.ctx, spec.Name, spec.Labels)
+	if err != nil {
+		t.Fatalf("FindContainer: %v", err)
+	}
+
+	if status.ID != id {
+		t.Errorf("ID: want %s, got %s", id, status.ID)
+	}
+
+	if status.Status != driver.Created {
+		t.Errorf("Status: want %s, got %s", driver.Created, status.Status)
+	}
+
+	for k, v := range spec.Labels {
+		if status.Labels[k] != v {
+			t.Errorf("Labels[%s]: want %q, got %q", k, v, status.Labels[k])
+		}
+	}
+}
+
+// testFindContainerName checks that containers are found by their exact
+// name, among containers with the same labels whose names contain it.
+func testFindContainerName(t *testing.T, h *harness) {
+	name := randomName(t)
+	labels := map[string]string{labelConformance: "true"}
+
+	ids := make(map[string]string)
+	for _, n := range []string{name, name + "-suffix", "prefix-" + name} {
+		ids[n], _ = h.createNamed(t, n, "exit 0", driver.Namespaces{})
+	}
+
+	for n, id := range ids {
+		status, err := h.drv.FindContainer(h.ctx, n, labels)
+		if err != nil {
+			t.Errorf("FindContainer(%s): %v", n, err)
+			continue
+		}
+
+		if status.ID != id || status.Name != n {
+			t.Errorf("FindContainer(%s): want %s, got %s (%s)", n, id, status.ID, status.Name)
+		}
+	}
+
+	_, err := h.drv.FindContainer(h.ctx, name[:len(name)-1], labels)
+	if !errors.Is(err, driver.ErrContainerNotFound) {
+		t.Errorf("FindContainer of a prefix: want ErrContainerNotFound, got %v", err)
+	}
+}
+
+// testFindContainerExited checks that FindContainer reports the exit code
+// and start time of an exited container, as ContainerStatus does.
+func testFindContainerExited(t *testing.T, h *harness) {
+	id, spec := h.create(t, "exit 3")
+
+	h.start(t, id)
+	h.wait(t, id)
+
+	want := h.status(t, id)
+
+	status, err := h.drv.FindContainer(h.ctx, spec.Name, spec.Labels)
+	if err != nil {
+		t.Fatalf("FindContainer: %v", err)
+	}
+
+	if status.Status != driver.Stopped || status.ExitCode != 3 {
+		t.Errorf("FindContainer: want %s with exit code 3, got %s with exit code %d", driver.Stopped, status.Status, status.ExitCode)
+	}
+
+	if status.StartedAt.IsZero() || !status.StartedAt.Equal(want.StartedAt) {
+		t.Errorf("StartedAt: want %s, got %s", want.StartedAt, status.StartedAt)
+	}
+}
+
+func testFindContainerLabelMismatch(t *testing.T, h *harness) {
+	_, spec := h.create(t, "exit 0")
+
+	_, err := h.drv.FindContainer(h.ctx, spec.Name, map[string]string{labelConformance: "false"})
+	if !errors.Is(err, driver.ErrContainerNotFound) {
+		t.Fatalf("FindContainer: want ErrContainerNotFound, got %v", err)
+	}
+}
+
+func testListContainers(t *testing.T, h *harness) {
+	createdID, createdSpec := h.create(t, "exit 0")
+	runningID, runningSpec := h.create(t, "sleep 3600")
+
+	h.start(t, runningID)
+
+	statuses, err := h.drv.ListContainers(h.ctx, map[string]string{labelConformance: "true"})
+	if err != nil {
+		t.Fatalf("ListContainers: %v", err)
+	}
+
+	found := make(map[string]driver.Status, len(statuses))
+	for _, status := range statuses {
+		found[status.ID] = status
+	}
+
+	created, ok := found[createdID]
+	if !ok {
+		t.Fatalf("created container %s not listed", createdID)
+	}
+
+	if created.Name != createdSpec.Name {
+		t.Errorf("Name: want %s, got %s", createdSpec.Name, created.Name)
+	}
+
+	if created.Image == "" {
+		t.Errorf("Image: want image, got none")
+	}
+
+	if created.Status != driver.Created {
+		t.Errorf("Status: want %s, got %s", driver.Created, created.Status)
+	}
+
+	if !created.StartedAt.IsZero() {
+		t.Errorf("StartedAt: want zero for a created container, got %s", created.StartedAt)
+	}
+
+	running, ok := found[runningID]
+	if !ok {
+		t.Fatalf("running container %s not listed", runningID)
+	}
+
+	if running.Name != runningSpec.Name {
+		t.Errorf("Name: want %s, got %s", runningSpec.Name, running.Name)
+	}
+
+	if running.Status != driver.Running {
+		t.Errorf("Status: want %s, got %s", driver.Running, running.Status)
+	}
+
+	if running.StartedAt.IsZero() || time.Since(running.StartedAt) > h.cfg.Timeout {
+		t.Errorf("StartedAt: want recent start time, got %s", running.StartedAt)
+	}
+
+	if running.Labels[labelConformance] != "true" {
+		t.Errorf("Labels[%s]: want %q, got %q", labelConformance, "true", running.Labels[labelConformance])
+	}
+}
+
+func testListContainersLabelMismatch(t *testing.T, h *harness) {
+	id, spec := h.create(t, "exit 0")
+
+	statuses, err := h.drv.ListContainers(h.ctx, map[string]string{
+		labelConformance:           "true",
+		labelConformance + ".name": spec.Name + "-other",
+	})
+	if err != nil {
+		t.Fatalf("ListContainers: %v", err)
+	}
+
+	for _, status := range statuses {
+		if status.ID == id {
+			t.Errorf("container %s listed despite label mismatch", id)
+		}
+	}
+}
+
+func testContainerStatusLifecycle(t *testing.T, h *harness) {
+	id, _ := h.create(t, "sleep 2")
+
+	if status := h.status(t, id); status.Status != driver.Created {
+		t.Fatalf("Status before start: want %s, got %s", driver.Created, status.Status)
+	}
+
+	h.start(t, id)
+
+	if status := h.status(t, id); status.Status != driver.Running {
+		t.Fatalf("Status after start: want %s, got %s", driver.Running, status.Status)
+	}
+
+	h.wait(t, id)
+
+	status := h.status(t, id)
+	if status.Status != driver.Stopped {
+		t.Fatalf("Status after exit: want %s, got %s", driver.Stopped, status.Status)
+	}
+
+	if status.ExitCode != 0 {
+		t.Errorf("ExitCode: want 0, got %d", status.ExitCode)
+	}
+}
+
+func testContainerStatusExitCode(t *testing.T, h *harness) {
+	id, _ := h.create(t, "exit 3")
+
+	h.start(t, id)
+	h.wait(t, id)
+
+	status := h.status(t, id)
+	if status.Status != driver.Stopped {
+		t.Fatalf("Status: want %s, got %s", driver.Stopped, status.Status)
+	}
+
+	if status.ExitCode != 3 {
+		t.Errorf("ExitCode: want 3, got %d", status.ExitCode)
+	}
+}
+
+func testStartContainerRestart(t *testing.T, h *harness) {
+	id, _ := h.create(t, "sleep 2; exit 3")
+
+	h.start(t, id)
+	h.wait(t, id)
+
+	if status := h.status(t, id); status.Status != driver.Stopped {
+		t.Fatalf("Status: want %s, got %s", driver.Stopped, status.Status)
+	}
+
+	// Containers that exited can be started again, as Run does to restart
+	// them.
+	h.start(t, id)
+
+	if status := h.status(t, id); status.Status != driver.Running {
+		t.Fatalf("Status after restart: want %s, got %s", driver.Running, status.Status)
+	}
+
+	h.wait(t, id)
+
+	if status := h.status(t, id); status.ExitCode != 3 {
+		t.Errorf("ExitCode after restart: want 3, got %d", status.ExitCode)
+	}
+}
+
+// testStartContainerAlreadyRunning checks that starting a running container
+// leaves it running, as Run does when it attaches to an existing container.
+func testStartContainerAlreadyRunning(t *testing.T, h *harness) {
+	id, _ := h.create(t, "sleep 3600")
+
+	h.start(t, id)
+
+	if err := h.drv.StartContainer(h.ctx, id); err != nil {
+		t.Fatalf("StartContainer on running container: %v", err)
+	}
+
+	if status := h.status(t, id); status.Status != driver.Running {
+		t.Fatalf("Status: want %s, got %s", driver.Running, status.Status)
+	}
+}
+
+func testStopContainer(t *testing.T, h *harness) {
+	id, _ := h.create(t, "sleep 3600")
+
+	h.start(t, id)
+
+	if err := h.drv.StopContainer(h.ctx, id, stopOptions); err != nil {
+		t.Fatalf("StopContainer: %v", err)
+	}
+
+	h.wait(t, id)
+
+	if status := h.status(t, id); status.Status != driver.Stopped {
+		t.Fatalf("Status: want %s, got %s", driver.Stopped, status.Status)
+	}
+
+	if err := h.drv.StopContainer(h.ctx, id, stopOptions); err != nil {
+		t.Fatalf("StopContainer on stopped container: %v", err)
+	}
+}
+
+func testStopContainerTimeout(t *testing.T, h *harness) {
+	id, _ := h.create(t, "sleep 3600")
+
+	h.start(t, id)
+
+	start := time.Now()
+	err := h.drv.StopContainer(h.ctx, id, driver.StopOptions{
+		Signal:  "SIGUSR1",
+		Timeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("StopContainer: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 15*time.Second {
+		t.Errorf("StopContainer took %s, want the container killed after the timeout", elapsed)
+	}
+
+	h.wait(t, id)
+
+	if status := h.status(t, id); status.Status != driver.Stopped {
+		t.Fatalf("Status: want %s, got %s", driver.Stopped, status.Status)
+	}
+}
+
+func testRemoveContainer(t *testing.T, h *harness) {
+	id, spec := h.create(t, "exit 0")
+
+	h.start(t, id)
+	h.wait(t, id)
+
+	if err := h.drv.RemoveContainer(h.ctx, id); err != nil {
+		t.Fatalf("RemoveContainer: %v", err)
+	}
+
+	_, err := h.drv.FindContainer(h.ctx, spec.Name, spec.Labels)
+	if !errors.Is(err, driver.ErrContainerNotFound) {
+		t.Fatalf("FindContainer after remove: want ErrContainerNotFound, got %v", err)
+	}
+}
+
+// testRemoveContainerRunning checks that running containers are removed
+// without being stopped first, as rm --force does.
+func testRemoveContainerRunning(t *testing.T, h *harness) {
+	id, spec := h.create(t, "sleep 3600")
+
+	h.start(t, id)
+
+	if err := h.drv.RemoveContainer(h.ctx, id); err != nil {
+		t.Fatalf("RemoveContainer: %v", err)
+	}
+
+	_, err := h.drv.FindContainer(h.ctx, spec.Name, spec.Labels)
+	if !errors.Is(err, driver.ErrContainerNotFound) {
+		t.Fatalf("FindContainer after remove: want ErrContainerNotFound, got %v", err)
+	}
+}
+
+func testWaitForExitExited(t *testing.T, h *harness) {
+	id, _ := h.create(t, "sleep 1")
+
+	h.start(t, id)
+	h.wait(t, id)
+
+	// Waiting on a container that already exited returns immediately.
+	h.wait(t, id)
+}
+
+func testWaitForExitCancelled(t *testing.T, h *harness) {
+	id, _ := h.create(t, "sleep 3600")
+
+	h.start(t, id)
+
+	ctx, cancel := context.WithCancel(h.ctx)
+	time.AfterFunc(500*time.Millisecond, cancel)
+
+	err := h.drv.WaitForExit(ctx, id)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("WaitForExit: want context.Canceled, got %v", err)
+	}
+
+	if status := h.status(t, id); status.Status != driver.Running {
+		t.Fatalf("Status: want %s, got %s", driver.Running, status.Status)
+	}
+}
+
+func testGetLogsStreams(t *testing.T, h *harness) {
+	id, _ := h.create(t, "echo hello; echo oops >&2; exit 0")
+
+	h.start(t, id)
+	h.wait(t, id)
+
+	var stdout, stderr bytes.Buffer
+	opts := driver.LogOptions{Stdout: &stdout, Stderr: &stderr, Tail: driver.TailAll}
+	if err := h.drv.GetLogs(h.ctx, id, opts); err != nil {
+		t.Fatalf("GetLogs: %v", err)
+	}
+
+	if got := stdout.String(); got != "hello\n" {
+		t.Errorf("stdout: want %q, got %q", "hello\n", got)
+	}
+
+	if got := stderr.String(); got != "oops\n" {
+		t.Errorf("stderr: want %q, got %q", "oops\n", got)
+	}
+}
+
+func testGetLogsFollow(t *testing.T, h *harness) {
+	id, _ := h.create(t, "echo first; sleep 1; echo second")
+
+	h.start(t, id)
+
+	var stdout, stderr bytes.Buffer
+	opts := driver.LogOptions{Stdout: &stdout, Stderr: &stderr, Follow: true, Tail: driver.TailAll}
+	if err := h.drv.GetLogs(h.ctx, id, opts); err != nil {
+		t.Fatalf("GetLogs: %v", err)
+	}
+
+	if got := strings.Fields(stdout.String()); len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Errorf("stdout: want [first second], got %q", got)
+	}
+}
+
+func testGetLogsTail(t *testing.T, h *harness) {
+	id, _ := h.create(t, "echo one; echo two; echo three")
+
+	h.start(t, id)
+	h.wait(t, id)
+
+	var stdout bytes.Buffer
+	if err := h.drv.GetLogs(h.ctx, id, driver.LogOptions{Stdout: &stdout, Tail: 2}); err != nil {
+		t.Fatalf("GetLogs: %v", err)
+	}
+
+	if got := strings.Fields(stdout.String()); len(got) != 2 || got[0] != "two" || got[1] != "three" {
+		t.Errorf("stdout: want [two three], got %q", got)
+	}
+}
+
+func testGetLogsSince(t *testing.T, h *harness) {
+	id, _ := h.create(t, "echo before; sleep 2; echo after")
+
+	h.start(t, id)
+	h.wait(t, id)
+
+	status := h.status(t, id)
+	if status.StartedAt.IsZero() {
+		t.Skip("driver does not report the start time")
+	}
+
+	var stdout bytes.Buffer
+	opts := driver.LogOptions{
+		Stdout: &stdout,
+		Since:  status.StartedAt.Add(time.Second),
+		Tail:   driver.TailAll,
+	}
+	if err := h.drv.GetLogs(h.ctx, id, opts); err != nil {
+		t.Fatalf("GetLogs: %v", err)
+	}
+
+	if got := strings.Fields(stdout.String()); len(got) != 1 || got[0] != "after" {
+		t.Errorf("stdout: want [after], got %q", got)
+	}
+}
+
+func testGetLogsTimestamps(t *testing.T, h *harness) {
+	id, _ := h.create(t, "echo hello")
+
+	h.start(t, id)
+	h.wait(t, id)
+
+	var stdout bytes.Buffer
+	opts := driver.LogOptions{Stdout: &stdout, Tail: driver.TailAll, Timestamps: true}
+	if err := h.drv.GetLogs(h.ctx, id, opts); err != nil {
+		t.Fatalf("GetLogs: %v", err)
+	}
+
+	fields := strings.Fields(stdout.String())
+	if len(fields) != 2 || fields[1] != "hello" {
+		t.Fatalf("stdout: want timestamp and hello, got %q", stdout.String())
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+		t.Errorf("timestamp: %v", err)
+	}
+}
+
+func testExec(t *testing.T, h *harness) {
+	id, _ := h.create(t, "sleep 3600")
+
+	h.start(t, id)
+
+	var stdout, stderr bytes.Buffer
+	code, err := h.drv.Exec(h.ctx, id, driver.ExecOptions{
+		Command: []string{"/bin/sh", "-c", "echo hello; echo oops >&2; exit 4"},
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	})
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	if code != 4 {
+		t.Errorf("exit code: want 4, got %d", code)
+	}
+
+	if got := stdout.String(); got != "hello\n" {
+		t.Errorf("stdout: want %q, got %q", "hello\n", got)
+	}
+
+	if got := stderr.String(); got != "oops\n" {
+		t.Errorf("stderr: want %q, got %q", "oops\n", got)
+	}
+
+	if status := h.status(t, id); status.Status != driver.Running {
+		t.Errorf("Status after exec: want %s, got %s", driver.Running, status.Status)
+	}
+}
+
+func testExecStdin(t *testing.T, h *harness) {
+	id, _ := h.create(t, "sleep 3600")
+
+	h.start(t, id)
+
+	var stdout bytes.Buffer
+	code, err := h.drv.Exec(h.ctx, id, driver.ExecOptions{
+		Command: []string{"cat"},
+		Stdin:   strings.NewReader("hello\n"),
+		Stdout:  &stdout,
+	})
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	if code != 0 {
+		t.Errorf("exit code: want 0, got %d", code)
+	}
+
+	if got := stdout.String(); got != "hello\n" {
+		t.Errorf("stdout: want %q, got %q", "hello\n", got)
+	}
+}
+
+func testExecTTY(t *testing.T, h *harness) {
+	id, _ := h.create(t, "sleep 3600")
+
+	h.start(t, id)
+
+	var stdout, stderr bytes.Buffer
+	code, err := h.drv.Exec(h.ctx, id, driver.ExecOptions{
+		Command: []string{"/bin/sh", "-c", "echo out; echo err >&2; exit 2"},
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+		TTY:     true,
+	})
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	if code != 2 {
+		t.Errorf("exit code: want 2, got %d", code)
+	}
+
+	if got := strings.Fields(stdout.String()); len(got) != 2 || got[0] != "out" || got[1] != "err" {
+		t.Errorf("stdout: want [out err], got %q", stdout.String())
+	}
+
+	if stderr.Len() != 0 {
+		t.Errorf("stderr: want no output, got %q", stderr.String())
+	}
+}
+
+func testAnnotations(t *testing.T, h *harness) {
+	id, spec := h.create(t, "exit 0")
+
+	found, err := h.drv.FindContainer(h.ctx, spec.Name, spec.Labels)
+	if err != nil {
+		t.Fatalf("FindContainer: %v", err)
+	}
+
+	for name, status := range map[string]*driver.Status{
+		"FindContainer":   found,
+		"ContainerStatus": h.status(t, id),
+	} {
+		for k, v := range spec.Annotations {
+			if status.Annotations[k] != v {
+				t.Errorf("%s: Annotations[%s]: want %d bytes, got %d", name, k, len(v), len(status.Annotations[k]))
+			}
+		}
+	}
+}
+
+func testNamespaces(t *testing.T, h *harness) {
+	primary, _ := h.createWith(t, "sleep 3600", driver.Namespaces{Shareable: true})
+	h.start(t, primary)
+
+	sidecar, _ := h.createWith(t, "sleep 3600", driver.Namespaces{Join: primary, SharePID: true})
+	h.start(t, sidecar)
+
+	if status := h.status(t, sidecar); status.Status != driver.Running {
+		t.Errorf("Status of joining container: want %s, got %s", driver.Running, status.Status)
+	}
+
+	code, err := h.drv.Exec(h.ctx, sidecar, driver.ExecOptions{Command: []string{"true"}})
+	if err != nil || code != 0 {
+		t.Errorf("Exec in joining container: want exit code 0, got %d, %v", code, err)
+	}
+}
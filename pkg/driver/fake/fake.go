@@ -0,0 +1,853 @@
+package fake
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+func init() {
+	driver.RegisterDriver(&FakeDriver{})
+}
+
+// Program simulates the main process of a container. It is started by
+// StartContainer and should return the exit code of the process. The context
+// is cancelled when the container is stopped.
+type Program func(ctx context.Context, stdout, stderr io.Writer) int
+
+// FakeDriver is an in-memory driver that simulates the container lifecycle
+// without a container runtime. It is intended for tests.
+//
+// Containers run the Program registered for their image. If there is none
+// and the command is `sh -c <script>` the script is interpreted, supporting
+// `echo` (optionally redirected with `>&2`), `sleep` and `exit`. Any other
+// command runs until the container is stopped.
+//
+// Exec runs the exec handler registered for the container's image. By default
+// `sh -c <script>` is interpreted as above, `true` and `false` exit with 0
+// and 1, `cat` copies its input to its output, and any other command is not
+// found.
+type FakeDriver struct {
+	// Images lists image references that are available without pulling.
+	Images []string `json:"images"`
+
+	mu         sync.Mutex
+	images     map[string]bool
+	digests    map[string]string
+	containers map[string]*container
+	programs   map[string]Program
+	execs      map[string]ExecHandler
+	failures   map[string]error
+	nextID     int
+}
+
+type logEntry struct {
+	stderr bool
+	data   []byte
+	time   time.Time
+}
+
+type container struct {
+	id        string
+	spec      driver.Spec
+	status    driver.ContainerStatus
+	exitCode  int
+	startedAt time.Time
+
+	logs    []logEntry
+	changed chan struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// New returns a provisioned FakeDriver.
+func New() *FakeDriver {
+	d := new(FakeDriver)
+	d.Provision(context.Background())
+	return d
+}
+
+func (d *FakeDriver) DriverInfo() driver.DriverInfo {
+	return driver.DriverInfo{
+		ID:  "fake",
+		New: func() driver.Driver { return new(FakeDriver) },
+	}
+}
+
+func (d *FakeDriver) Provision(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.images = make(map[string]bool, len(d.Images))
+	for _, img := range d.Images {
+		d.images[img] = true
+	}
+
+	d.digests = make(map[string]string)
+	d.containers = make(map[string]*container)
+	d.programs = make(map[string]Program)
+	d.execs = make(map[string]ExecHandler)
+	d.failures = make(map[string]error)
+
+	return nil
+}
+
+// SetProgram registers the program run by containers created from image.
+func (d *FakeDriver) SetProgram(image string, program Program) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.images[image] = true
+	d.programs[image] = program
+}
+
+// SetImageDigest makes image available with digest, as if a new version of
+// it was pulled. Images default to a digest derived from their reference.
+func (d *FakeDriver) SetImageDigest(image, digest string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.images[image] = true
+	d.digests[image] = digest
+}
+
+// ExecHandler simulates a command run by Exec. It returns the exit code of
+// the command.
+type ExecHandler func(ctx context.Context, command []string, stdin io.Reader, stdout, stderr io.Writer) int
+
+// SetExec registers the handler of commands run by Exec in containers created
+// from image.
+func (d *FakeDriver) SetExec(image string, handler ExecHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.execs[image] = handler
+}
+
+// FailOn makes every following call to the named driver method return err.
+// Passing a nil error clears the failure.
+func (d *FakeDriver) FailOn(method string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err == nil {
+		delete(d.failures, method)
+		return
+	}
+
+	d.failures[method] = err
+}
+
+func (d *FakeDriver) failure(method string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.failures[method]
+}
+
+func (d *FakeDriver) PullImage(ctx context.Context, image string) error {
+	if err := d.failure("PullImage"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.images[image] = true
+	return nil
+}
+
+func (d *FakeDriver) ImageDigest(ctx context.Context, image string) (string, error) {
+	if err := d.failure("ImageDigest"); err != nil {
+		return "", err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.imageDigest(image)
+}
+
+// imageDigest returns the digest of image, d.mu must be held.
+func (d *FakeDriver) imageDigest(image string) (string, error) {
+	if !d.images[image] {
+		return "", fmt.Errorf("%w: %s", driver.ErrImageNotFound, image)
+	}
+
+	if digest, ok := d.digests[image]; ok {
+		return digest, nil
+	}
+
+	if _, digest, ok := strings.Cut(image, "@"); ok {
+		return digest, nil
+	}
+
+	sum := sha256.Sum256([]byte(image))
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// TagImage names image with target, which keeps its digest, program and
+// exec handler.
+func (d *FakeDriver) TagImage(ctx context.Context, image, target string) error {
+	if err := d.failure("TagImage"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	digest, err := d.imageDigest(image)
+	if err != nil {
+		return err
+	}
+
+	d.images[target] = true
+	d.digests[target] = digest
+
+	if program, ok := d.programs[image]; ok {
+		d.programs[target] = program
+	}
+
+	if handler, ok := d.execs[image]; ok {
+		d.execs[target] = handler
+	}
+
+	return nil
+}
+
+// archiveManifest is the manifest.json of a Docker image archive. The fake
+// driver only writes and reads the names of the images.
+type archiveManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+const archiveManifestFile = "manifest.json"
+
+// LoadImages marks the images named in the manifest.json of a Docker image
+// archive as pulled.
+func (d *FakeDriver) LoadImages(ctx context.Context, r io.Reader) ([]string, error) {
+	if err := d.failure("LoadImages"); err != nil {
+		return nil, err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("no %s in image archive", archiveManifestFile)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if hdr.Name != archiveManifestFile {
+			continue
+		}
+
+		var manifests []archiveManifest
+		if err := json.NewDecoder(tr).Decode(&manifests); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", archiveManifestFile, err)
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		var names []string
+		for _, m := range manifests {
+			for _, name := range m.RepoTags {
+				d.images[name] = true
+				names = append(names, name)
+			}
+		}
+
+		return names, nil
+	}
+}
+
+// SaveImages writes a Docker image archive holding only a manifest.json
+// naming the images.
+func (d *FakeDriver) SaveImages(ctx context.Context, w io.Writer, images []string) error {
+	if err := d.failure("SaveImages"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	manifests := make([]archiveManifest, 0, len(images))
+	for _, image := range images {
+		if !d.images[image] {
+			return fmt.Errorf("%w: %s", driver.ErrImageNotFound, image)
+		}
+
+		manifests = append(manifests, archiveManifest{RepoTags: []string{image}, Layers: []string{}})
+	}
+
+	data, err := json.Marshal(manifests)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{Name: archiveManifestFile, Mode: 0644, Size: int64(len(data))}); err != nil {
+		return err
+	}
+
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+func (d *FakeDriver) FindContainer(ctx context.Context, name string, labels map[string]string) (*driver.Status, error) {
+	if err := d.failure("FindContainer"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, c := range d.containers {
+		if c.spec.Name != name || !matchLabels(c.spec.Labels, labels) {
+			continue
+		}
+
+		return c.statusLocked(), nil
+	}
+
+	return nil, driver.ErrContainerNotFound
+}
+
+func (d *FakeDriver) ListContainers(ctx context.Context, labels map[string]string) ([]driver.Status, error) {
+	if err := d.failure("ListContainers"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	statuses := []driver.Status{}
+	for _, c := range d.containers {
+		if matchLabels(c.spec.Labels, labels) {
+			statuses = append(statuses, *c.statusLocked())
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses, nil
+}
+
+func matchLabels(have, want map[string]string) bool {
+	for k, v := range want {
+		if hv, ok := have[k]; !ok || hv != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (d *FakeDriver) ContainerStatus(ctx context.Context, id string) (*driver.Status, error) {
+	if err := d.failure("ContainerStatus"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, ok := d.containers[id]
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", id)
+	}
+
+	return c.statusLocked(), nil
+}
+
+func (c *container) statusLocked() *driver.Status {
+	labels := make(map[string]string, len(c.spec.Labels))
+	for k, v := range c.spec.Labels {
+		labels[k] = v
+	}
+
+	annotations := make(map[string]string, len(c.spec.Annotations))
+	for k, v := range c.spec.Annotations {
+		annotations[k] = v
+	}
+
+	return &driver.Status{
+		ID:          c.id,
+		Name:        c.spec.Name,
+		Image:       c.spec.Image,
+		Status:      c.status,
+		Labels:      labels,
+		Annotations: annotations,
+		ExitCode:    c.exitCode,
+		StartedAt:   c.startedAt,
+	}
+}
+
+func (d *FakeDriver) CreateContainer(ctx context.Context, spec *driver.Spec) (string, error) {
+	if err := d.failure("CreateContainer"); err != nil {
+		return "", err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.images[spec.Image] {
+		return "", fmt.Errorf("no such image: %s", spec.Image)
+	}
+
+	for _, c := range d.containers {
+		if c.spec.Name == spec.Name {
+			return "", fmt.Errorf("container name %s is already in use by %s", spec.Name, c.id)
+		}
+	}
+
+	d.nextID++
+	id := fmt.Sprintf("fake%060d", d.nextID)
+
+	d.containers[id] = &container{
+		id:      id,
+		spec:    *spec,
+		status:  driver.Created,
+		changed: make(chan struct{}),
+	}
+
+	return id, nil
+}
+
+func (d *FakeDriver) StartContainer(ctx context.Context, id string) error {
+	if err := d.failure("StartContainer"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, ok := d.containers[id]
+	if !ok {
+		return fmt.Errorf("no such container: %s", id)
+	}
+
+	if c.status == driver.Running {
+		return nil
+	}
+
+	// Like the runtimes, containers joining the namespaces of another
+	// container can only start while it runs.
+	if join := c.spec.Namespaces.Join; join != "" {
+		if joined, ok := d.containers[join]; !ok || joined.status != driver.Running {
+			return fmt.Errorf("joined container %s is not running", join)
+		}
+	}
+
+	program, ok := d.programs[c.spec.Image]
+	if !ok {
+		program = defaultProgram(c.spec.Command, c.spec.Arguments)
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	c.cancel = cancel
+	c.done = done
+	c.status = driver.Running
+	c.exitCode = 0
+	c.startedAt = time.Now()
+	c.notifyLocked()
+
+	go func() {
+		code := program(runCtx, &logWriter{d: d, c: c}, &logWriter{d: d, c: c, stderr: true})
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		cancel()
+
+		select {
+		case <-done:
+			// The container was killed by StopContainer.
+		default:
+			c.exitLocked(done, code)
+		}
+	}()
+
+	return nil
+}
+
+func (c *container) exitLocked(done chan struct{}, code int) {
+	c.status = driver.Stopped
+	c.exitCode = code
+	close(done)
+	c.notifyLocked()
+}
+
+// notifyLocked wakes up everyone waiting for the container to change.
+func (c *container) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+type logWriter struct {
+	d      *FakeDriver
+	c      *container
+	stderr bool
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.d.mu.Lock()
+	defer w.d.mu.Unlock()
+
+	w.c.logs = append(w.c.logs, logEntry{stderr: w.stderr, data: bytes.Clone(p), time: time.Now()})
+	w.c.notifyLocked()
+
+	return len(p), nil
+}
+
+// StopContainer cancels the context of the container's program, which stands
+// in for the stop signal. Programs that ignore it are killed once the timeout
+// elapses and exit with code 137.
+func (d *FakeDriver) StopContainer(ctx context.Context, id string, opts driver.StopOptions) error {
+	if err := d.failure("StopContainer"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	c, ok := d.containers[id]
+	if !ok {
+		d.mu.Unlock()
+		return fmt.Errorf("no such container: %s", id)
+	}
+
+	if c.status != driver.Running {
+		d.mu.Unlock()
+		return nil
+	}
+
+	c.cancel()
+	done := c.done
+	d.mu.Unlock()
+
+	timer := time.NewTimer(opts.Timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	select {
+	case <-done:
+	default:
+		c.exitLocked(done, 137)
+	}
+
+	return nil
+}
+
+func (d *FakeDriver) RemoveContainer(ctx context.Context, id string) error {
+	if err := d.failure("RemoveContainer"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, ok := d.containers[id]
+	if !ok {
+		return fmt.Errorf("no such container: %s", id)
+	}
+
+	if c.status == driver.Running {
+		c.cancel()
+	}
+
+	delete(d.containers, id)
+
+	return nil
+}
+
+func (d *FakeDriver) WaitForExit(ctx context.Context, id string) error {
+	if err := d.failure("WaitForExit"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	c, ok := d.containers[id]
+	if !ok {
+		d.mu.Unlock()
+		return fmt.Errorf("no such container: %s", id)
+	}
+
+	if c.status != driver.Running {
+		d.mu.Unlock()
+		return nil
+	}
+
+	done := c.done
+	d.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *FakeDriver) GetLogs(ctx context.Context, id string, opts driver.LogOptions) error {
+	if err := d.failure("GetLogs"); err != nil {
+		return err
+	}
+
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	next := 0
+	first := true
+	for {
+		// Like the streams of real runtimes, output is cut off once ctx
+		// is cancelled.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		d.mu.Lock()
+		c, ok := d.containers[id]
+		if !ok {
+			d.mu.Unlock()
+			return fmt.Errorf("no such container: %s", id)
+		}
+
+		entries := c.logs[next:]
+		next = len(c.logs)
+		running := c.status == driver.Running
+		changed := c.changed
+		d.mu.Unlock()
+
+		selected := make([]logEntry, 0, len(entries))
+		done := false
+		for _, e := range entries {
+			if !opts.Since.IsZero() && e.time.Before(opts.Since) {
+				continue
+			}
+
+			if !opts.Until.IsZero() && e.time.After(opts.Until) {
+				done = true
+				break
+			}
+
+			selected = append(selected, e)
+		}
+
+		if first && opts.Tail >= 0 && len(selected) > opts.Tail {
+			selected = selected[len(selected)-opts.Tail:]
+		}
+
+		first = false
+
+		for _, e := range selected {
+			w := stdout
+			if e.stderr {
+				w = stderr
+			}
+
+			if opts.Timestamps {
+				if _, err := io.WriteString(w, e.time.UTC().Format(time.RFC3339Nano)+" "); err != nil {
+					return err
+				}
+			}
+
+			if _, err := w.Write(e.data); err != nil {
+				return err
+			}
+		}
+
+		if done || !running || !opts.Follow {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (d *FakeDriver) Exec(ctx context.Context, id string, opts driver.ExecOptions) (int, error) {
+	if err := d.failure("Exec"); err != nil {
+		return 0, err
+	}
+
+	d.mu.Lock()
+	c, ok := d.containers[id]
+	if !ok {
+		d.mu.Unlock()
+		return 0, fmt.Errorf("no such container: %s", id)
+	}
+
+	if c.status != driver.Running {
+		d.mu.Unlock()
+		return 0, fmt.Errorf("container %s is not running", id)
+	}
+
+	handler, ok := d.execs[c.spec.Image]
+	d.mu.Unlock()
+
+	if !ok {
+		handler = defaultExec
+	}
+
+	stdin, stdout, stderr := opts.Stdin, opts.Stdout, opts.Stderr
+	if stdin == nil {
+		stdin = strings.NewReader("")
+	}
+
+	if stdout == nil {
+		stdout = io.Discard
+	}
+
+	// A terminal has a single output stream.
+	if opts.TTY {
+		stderr = stdout
+	}
+
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	code := handler(ctx, opts.Command, stdin, stdout, stderr)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return code, nil
+}
+
+func defaultExec(ctx context.Context, command []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(command) == 3 && (command[0] == "sh" || command[0] == "/bin/sh") && command[1] == "-c" {
+		return scriptProgram(command[2])(ctx, stdout, stderr)
+	}
+
+	switch {
+	case len(command) == 0:
+		return 127
+	case command[0] == "true":
+		return 0
+	case command[0] == "false":
+		return 1
+	case command[0] == "cat" && len(command) == 1:
+		if _, err := io.Copy(stdout, stdin); err != nil {
+			return 1
+		}
+		return 0
+	default:
+		fmt.Fprintf(stderr, "exec: %s: not found\n", command[0])
+		return 127
+	}
+}
+
+func defaultProgram(command, args []string) Program {
+	argv := append(append([]string{}, command...), args...)
+
+	if len(argv) == 3 && (argv[0] == "sh" || argv[0] == "/bin/sh") && argv[1] == "-c" {
+		return scriptProgram(argv[2])
+	}
+
+	return func(ctx context.Context, stdout, stderr io.Writer) int {
+		<-ctx.Done()
+		return 143
+	}
+}
+
+// scriptProgram interprets a tiny subset of sh, enough to write conformance
+// tests that run unchanged against real container runtimes.
+func scriptProgram(script string) Program {
+	return func(ctx context.Context, stdout, stderr io.Writer) int {
+		lines := strings.FieldsFunc(script, func(r rune) bool { return r == ';' || r == '\n' })
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+
+			switch fields[0] {
+			case "echo":
+				out := stdout
+				if last := fields[len(fields)-1]; last == ">&2" || last == "1>&2" {
+					out = stderr
+					fields = fields[:len(fields)-1]
+				}
+				fmt.Fprintln(out, strings.Join(fields[1:], " "))
+			case "sleep":
+				secs, err := strconv.ParseFloat(argOr(fields, ""), 64)
+				if err != nil {
+					fmt.Fprintf(stderr, "sleep: invalid number '%s'\n", argOr(fields, ""))
+					return 1
+				}
+
+				select {
+				case <-time.After(time.Duration(secs * float64(time.Second))):
+				case <-ctx.Done():
+					return 143
+				}
+			case "exit":
+				code, err := strconv.Atoi(argOr(fields, "0"))
+				if err != nil {
+					return 2
+				}
+				return code
+			default:
+				fmt.Fprintf(stderr, "sh: %s: not found\n", fields[0])
+				return 127
+			}
+
+			if ctx.Err() != nil {
+				return 143
+			}
+		}
+
+		return 0
+	}
+}
+
+func argOr(fields []string, def string) string {
+	if len(fields) < 2 {
+		return def
+	}
+
+	return fields[1]
+}
@@ -0,0 +1,15 @@
+package fake
+
+import (
+	"testing"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/driver/drivertest"
+)
+
+func TestConformance(t *testing.T) {
+	drivertest.Run(t, drivertest.Config{
+		New:   func(t *testing.T) driver.Driver { return New() },
+		Image: "busybox:latest",
+	})
+}
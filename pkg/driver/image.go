@@ -0,0 +1,38 @@
+package driver
+
+import (
+	"github.com/distribution/reference"
+)
+
+// RepoDigest returns the digest of image out of the repository digests of a
+// local image, such as docker.io/library/busybox@sha256:<digest>. When image
+// is pinned to a digest only that digest matches. It returns an empty string
+// if the image was not pulled from the repository of image.
+func RepoDigest(image string, repoDigests []string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return ""
+	}
+
+	pinned, _ := named.(reference.Canonical)
+
+	for _, rd := range repoDigests {
+		ref, err := reference.ParseNormalizedNamed(rd)
+		if err != nil {
+			continue
+		}
+
+		canonical, ok := ref.(reference.Canonical)
+		if !ok || ref.Name() != named.Name() {
+			continue
+		}
+
+		if pinned != nil && canonical.Digest() != pinned.Digest() {
+			continue
+		}
+
+		return canonical.Digest().String()
+	}
+
+	return ""
+}
@@ -0,0 +1,173 @@
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"github.com/containerd/console"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+func (d *OCIDriver) Exec(ctx context.Context, id string, opts driver.ExecOptions) (int, error) {
+	status, err := d.ContainerStatus(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	if status.Status != driver.Running {
+		return 0, fmt.Errorf("container %s is not running", id)
+	}
+
+	dir := d.containerDir(id)
+
+	var spec specs.Spec
+	if err := readJSON(filepath.Join(dir, configFile), &spec); err != nil {
+		return 0, err
+	}
+
+	if spec.Process == nil {
+		return 0, errors.New("container spec has no process")
+	}
+
+	// The command inherits the environment, user and working directory of
+	// the container's main process.
+	pspec := *spec.Process
+	pspec.Args = opts.Command
+	pspec.Terminal = opts.TTY
+
+	execID, err := newContainerID()
+	if err != nil {
+		return 0, err
+	}
+
+	processFile := filepath.Join(dir, "exec-"+execID[:12]+".json")
+	if err := writeJSON(processFile, &pspec); err != nil {
+		return 0, err
+	}
+
+	defer os.Remove(processFile)
+
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	cmd := d.runtime(id, "exec", "--process", processFile, id)
+
+	if opts.TTY {
+		err = runTerminal(ctx, cmd, opts.Stdin, stdout, opts.Resize)
+	} else {
+		err = run(ctx, cmd, opts.Stdin, stdout, stderr)
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// The runtime exits with the exit code of the command.
+		return exitErr.ExitCode(), nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to exec: %w", err)
+	}
+
+	return 0, nil
+}
+
+// run runs cmd, killing it when ctx is done.
+func run(ctx context.Context, cmd *exec.Cmd, stdin io.Reader, stdout, stderr io.Writer) error {
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	return wait(ctx, cmd)
+}
+
+// runTerminal runs cmd with a terminal as its standard streams. The runtime
+// forwards the input, output and size of the terminal to the command.
+func runTerminal(ctx context.Context, cmd *exec.Cmd, stdin io.Reader, stdout io.Writer, resize <-chan driver.TerminalSize) error {
+	pty, slave, err := console.NewPty()
+	if err != nil {
+		return fmt.Errorf("failed to create terminal: %w", err)
+	}
+
+	defer pty.Close()
+
+	tty, err := os.OpenFile(slave, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return err
+	}
+
+	cmd.Stdin = tty
+	cmd.Stdout = tty
+	cmd.Stderr = tty
+	// The terminal is made the controlling terminal of the runtime, which
+	// then receives SIGWINCH when it is resized.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+
+	err = cmd.Start()
+	tty.Close()
+
+	if err != nil {
+		return err
+	}
+
+	if stdin != nil {
+		go io.Copy(pty, stdin)
+	}
+
+	copied := make(chan struct{})
+	go func() {
+		// Reading fails with EIO once the runtime exits.
+		io.Copy(stdout, pty)
+		close(copied)
+	}()
+
+	if resize != nil {
+		go func() {
+			for {
+				select {
+				case size := <-resize:
+					pty.Resize(console.WinSize{Height: uint16(size.Height), Width: uint16(size.Width)})
+				case <-copied:
+					return
+				}
+			}
+		}()
+	}
+
+	err = wait(ctx, cmd)
+	<-copied
+
+	return err
+}
+
+func wait(ctx context.Context, cmd *exec.Cmd) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-done
+		return ctx.Err()
+	}
+}
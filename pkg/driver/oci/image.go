@@ -0,0 +1,337 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/archive"
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/images"
+	imagearchive "github.com/containerd/containerd/images/archive"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes"
+	"github.com/distribution/reference"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/rs/zerolog"
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+// Images are stored in an OCI image layout under <root>/images, so they can
+// also be copied in with tools such as skopeo.
+const (
+	layoutFile = "oci-layout"
+	indexFile  = "index.json"
+)
+
+// image is an image of the local store resolved for the current platform.
+type image struct {
+	Name     string
+	Manifest ocispec.Manifest
+	Config   ocispec.Image
+}
+
+func (d *OCIDriver) imagesDir() string {
+	return filepath.Join(d.Root, "images")
+}
+
+// normalizeImageRef returns the fully qualified form of imageRef, such as
+// docker.io/library/busybox:latest for busybox.
+func normalizeImageRef(imageRef string) (string, error) {
+	named, err := reference.ParseDockerRef(imageRef)
+	if err != nil {
+		return "", err
+	}
+
+	return named.String(), nil
+}
+
+func (d *OCIDriver) PullImage(ctx context.Context, imageRef string) error {
+	name, err := normalizeImageRef(imageRef)
+	if err != nil {
+		return err
+	}
+
+	store, err := local.NewStore(d.imagesDir())
+	if err != nil {
+		return err
+	}
+
+	resolver := d.registries.Resolver()
+
+	name, desc, err := resolver.Resolve(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to resolve image: %w", err)
+	}
+
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	platform := platforms.Default()
+	handler := images.Handlers(
+		remotes.FetchHandler(store, fetcher),
+		images.LimitManifests(images.FilterPlatforms(images.ChildrenHandler(store), platform), platform, 1),
+	)
+
+	if err := images.Dispatch(ctx, handler, nil, desc); err != nil {
+		return fmt.Errorf("failed to pull image: %w", err)
+	}
+
+	if err := d.tagImage(name, desc); err != nil {
+		return err
+	}
+
+	zerolog.Ctx(ctx).Info().Str("driver", "oci").Str("digest", desc.Digest.String()).Msg("pulled")
+
+	return nil
+}
+
+// tagImage records desc in the index of the image layout under name,
+// replacing the image previously stored under that name.
+func (d *OCIDriver) tagImage(name string, desc ocispec.Descriptor) error {
+	index, err := d.readIndex()
+	if err != nil {
+		return err
+	}
+
+	manifests := make([]ocispec.Descriptor, 0, len(index.Manifests)+1)
+	for _, m := range index.Manifests {
+		if m.Annotations[ocispec.AnnotationRefName] != name {
+			manifests = append(manifests, m)
+		}
+	}
+
+	desc.Annotations = map[string]string{ocispec.AnnotationRefName: name}
+	index.Manifests = append(manifests, desc)
+
+	layout := ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion}
+	if err := writeJSON(filepath.Join(d.imagesDir(), layoutFile), layout); err != nil {
+		return err
+	}
+
+	return writeJSON(filepath.Join(d.imagesDir(), indexFile), index)
+}
+
+func (d *OCIDriver) readIndex() (*ocispec.Index, error) {
+	index := &ocispec.Index{}
+	index.SchemaVersion = 2
+	index.MediaType = ocispec.MediaTypeImageIndex
+
+	err := readJSON(filepath.Join(d.imagesDir(), indexFile), index)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read image index: %w", err)
+	}
+
+	return index, nil
+}
+
+// getImage returns the image stored under imageRef, which must have been
+// pulled.
+func (d *OCIDriver) getImage(ctx context.Context, store content.Store, imageRef string) (*image, error) {
+	name, err := normalizeImageRef(imageRef)
+	if err != nil {
+		return nil, err
+	}
+
+	desc, err := d.findImage(name)
+	if errors.Is(err, driver.ErrImageNotFound) {
+		return nil, fmt.Errorf("image %s not found, it must be pulled first", name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := images.Manifest(ctx, store, *desc, platforms.Default())
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := content.ReadBlob(ctx, store, manifest.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	img := &image{Name: name, Manifest: manifest}
+	if err := json.Unmarshal(data, &img.Config); err != nil {
+		return nil, fmt.Errorf("failed to decode image config: %w", err)
+	}
+
+	return img, nil
+}
+
+// findImage returns the descriptor stored in the index under the normalized
+// name, wrapping driver.ErrImageNotFound if there is none.
+func (d *OCIDriver) findImage(name string) (*ocispec.Descriptor, error) {
+	index, err := d.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, desc := range index.Manifests {
+		if desc.Annotations[ocispec.AnnotationRefName] == name {
+			return &desc, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", driver.ErrImageNotFound, name)
+}
+
+// ImageDigest returns the digest of the manifest, or index, the image was
+// pulled by.
+func (d *OCIDriver) ImageDigest(ctx context.Context, imageRef string) (string, error) {
+	name, err := normalizeImageRef(imageRef)
+	if err != nil {
+		return "", err
+	}
+
+	desc, err := d.findImage(name)
+	if err != nil {
+		return "", err
+	}
+
+	return desc.Digest.String(), nil
+}
+
+func (d *OCIDriver) TagImage(ctx context.Context, imageRef, target string) error {
+	name, err := normalizeImageRef(imageRef)
+	if err != nil {
+		return err
+	}
+
+	targetName, err := normalizeImageRef(target)
+	if err != nil {
+		return err
+	}
+
+	desc, err := d.findImage(name)
+	if err != nil {
+		return err
+	}
+
+	return d.tagImage(targetName, *desc)
+}
+
+// LoadImages imports the images of the archive into the image layout. Images
+// are named by their containerd name annotation or, in OCI layouts, by a
+// reference name holding a full image reference. Manifests named only by a
+// tag are skipped.
+func (d *OCIDriver) LoadImages(ctx context.Context, r io.Reader) ([]string, error) {
+	store, err := local.NewStore(d.imagesDir())
+	if err != nil {
+		return nil, err
+	}
+
+	desc, err := imagearchive.ImportIndex(ctx, store, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import images: %w", err)
+	}
+
+	data, err := content.ReadBlob(ctx, store, desc)
+	if err != nil {
+		return nil, err
+	}
+
+	var index ocispec.Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to decode image index: %w", err)
+	}
+
+	var names []string
+	for _, m := range index.Manifests {
+		name := m.Annotations[images.AnnotationImageName]
+		if ref := m.Annotations[ocispec.AnnotationRefName]; name == "" && strings.ContainsAny(ref, "/:") {
+			name = ref
+		}
+
+		if name == "" {
+			continue
+		}
+
+		name, err := normalizeImageRef(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image name: %w", err)
+		}
+
+		if err := d.tagImage(name, m); err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// SaveImages writes the images for the platform of the host, the only
+// platform pulled.
+func (d *OCIDriver) SaveImages(ctx context.Context, w io.Writer, imageRefs []string) error {
+	store, err := local.NewStore(d.imagesDir())
+	if err != nil {
+		return err
+	}
+
+	opts := []imagearchive.ExportOpt{
+		imagearchive.WithPlatform(platforms.DefaultStrict()),
+		imagearchive.WithSkipMissing(store),
+	}
+
+	for _, ref := range imageRefs {
+		name, err := normalizeImageRef(ref)
+		if err != nil {
+			return err
+		}
+
+		desc, err := d.findImage(name)
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, imagearchive.WithManifest(*desc, name))
+	}
+
+	return imagearchive.Export(ctx, store, w, opts...)
+}
+
+// unpack applies the layers of img to the directory rootfs.
+func unpack(ctx context.Context, store content.Provider, img *image, rootfs string) error {
+	if err := os.MkdirAll(rootfs, 0755); err != nil {
+		return err
+	}
+
+	for _, layer := range img.Manifest.Layers {
+		if err := applyLayer(ctx, store, layer, rootfs); err != nil {
+			return fmt.Errorf("failed to unpack layer %s: %w", layer.Digest, err)
+		}
+	}
+
+	return nil
+}
+
+func applyLayer(ctx context.Context, store content.Provider, layer ocispec.Descriptor, rootfs string) error {
+	ra, err := store.ReaderAt(ctx, layer)
+	if err != nil {
+		return err
+	}
+
+	defer ra.Close()
+
+	r, err := compression.DecompressStream(content.NewReader(ra))
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	_, err = archive.Apply(ctx, rootfs, r)
+	return err
+}
@@ -0,0 +1,223 @@
+package oci
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/logfile"
+	"golang.org/x/sys/unix"
+)
+
+// monitorCommand is the sysctr subcommand started by StartContainer to run
+// a container, see RunMonitor.
+const monitorCommand = "oci-monitor"
+
+// monitorReadyFd is the file descriptor on which the monitor reports whether
+// the container started.
+const monitorReadyFd = 3
+
+// RunMonitor creates and starts the container in the bundle dir with the OCI
+// runtime, then waits for it to exit and records its exit code. The output
+// of the container is appended to its log file.
+//
+// The monitor runs in its own process, started by StartContainer, so that
+// containers outlive the sysctr command that started them. It becomes the
+// parent of the container by acting as a subreaper. "ok" or the error that
+// prevented the container from starting is written to the file descriptor
+// monitorReadyFd.
+func RunMonitor(runtime, runtimeRoot, dir string) error {
+	ready := os.NewFile(monitorReadyFd, "ready")
+
+	// The monitor is stopped along with the container, when it exits.
+	signal.Ignore(syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	pid, output, err := startContainer(runtime, runtimeRoot, dir)
+	if err != nil {
+		fmt.Fprint(ready, err.Error())
+		ready.Close()
+		return err
+	}
+
+	run := &runRecord{Monitor: os.Getpid(), Pid: pid, StartedAt: time.Now().UTC()}
+	if err := writeJSON(filepath.Join(dir, runFile), run); err != nil {
+		killContainer(runtime, runtimeRoot, dir)
+		fmt.Fprint(ready, err.Error())
+		ready.Close()
+		return err
+	}
+
+	fmt.Fprint(ready, "ok")
+	ready.Close()
+
+	run.ExitCode = waitForPid(pid)
+
+	// The output is complete once every process of the container exited.
+	done := make(chan struct{})
+	go func() {
+		output.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+	}
+
+	killContainer(runtime, runtimeRoot, dir)
+
+	run.Exited = true
+	run.FinishedAt = time.Now().UTC()
+
+	return writeJSON(filepath.Join(dir, runFile), run)
+}
+
+// startContainer creates and starts the container with its output copied to
+// the log file. It returns the pid of the container and a wait group done
+// once the output has been copied.
+func startContainer(runtime, runtimeRoot, dir string) (int, *sync.WaitGroup, error) {
+	id := filepath.Base(dir)
+
+	// The container is reparented to the monitor once the runtime exits.
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		return 0, nil, fmt.Errorf("failed to become a subreaper: %w", err)
+	}
+
+	w, err := logfile.Create(filepath.Join(dir, logFile))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// The container inherits the write ends of the pipes, the monitor's
+	// copies are closed so the output ends when the container exits.
+	create := runtimeCommand(runtime, runtimeRoot, dir, "create", "--bundle", dir, "--pid-file", filepath.Join(dir, pidFile), id)
+	create.Stdout = stdoutW
+	create.Stderr = stderrW
+
+	err = create.Run()
+	stdoutW.Close()
+	stderrW.Close()
+
+	if err != nil {
+		stdoutR.Close()
+		stderrR.Close()
+		return 0, nil, runtimeError("create", dir, err)
+	}
+
+	output := &sync.WaitGroup{}
+	output.Add(2)
+
+	go func() {
+		defer output.Done()
+		w.Copy(logfile.Stdout, stdoutR)
+	}()
+
+	go func() {
+		defer output.Done()
+		w.Copy(logfile.Stderr, stderrR)
+	}()
+
+	go func() {
+		output.Wait()
+		w.Close()
+	}()
+
+	data, err := os.ReadFile(filepath.Join(dir, pidFile))
+	if err != nil {
+		killContainer(runtime, runtimeRoot, dir)
+		return 0, nil, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		killContainer(runtime, runtimeRoot, dir)
+		return 0, nil, fmt.Errorf("invalid pid file: %w", err)
+	}
+
+	if err := runtimeCommand(runtime, runtimeRoot, dir, "start", id).Run(); err != nil {
+		killContainer(runtime, runtimeRoot, dir)
+		return 0, nil, runtimeError("start", dir, err)
+	}
+
+	return pid, output, nil
+}
+
+// waitForPid reaps children of the monitor until the process pid exits and
+// returns its exit code, 128 plus the signal number if it was killed.
+func waitForPid(pid int) int {
+	for {
+		var status unix.WaitStatus
+		wpid, err := unix.Wait4(-1, &status, 0, nil)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+
+		if err != nil {
+			// The container is not a child of the monitor, which
+			// happens if it was not reparented.
+			return waitForExternalPid(pid)
+		}
+
+		if wpid != pid {
+			continue
+		}
+
+		if status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+
+		return status.ExitStatus()
+	}
+}
+
+// waitForExternalPid polls until pid exits. Its exit code is unknown.
+func waitForExternalPid(pid int) int {
+	for unix.Kill(pid, 0) == nil {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return 255
+}
+
+// killContainer kills the container in the bundle dir and deletes it from
+// the runtime.
+func killContainer(runtime, runtimeRoot, dir string) {
+	runtimeCommand(runtime, runtimeRoot, dir, "delete", "--force", filepath.Base(dir)).Run()
+}
+
+// runtimeCommand returns the command running the OCI runtime for the
+// container in the bundle dir, logging to its runtime log.
+func runtimeCommand(runtime, runtimeRoot, dir string, args ...string) *exec.Cmd {
+	global := []string{"--root", runtimeRoot, "--log", filepath.Join(dir, runtimeLog)}
+	return exec.Command(runtime, append(global, args...)...)
+}
+
+// runtimeError returns err with the last line logged by the runtime, which
+// explains why it failed.
+func runtimeError(action, dir string, err error) error {
+	data, _ := os.ReadFile(filepath.Join(dir, runtimeLog))
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if last := lines[len(lines)-1]; last != "" {
+		return fmt.Errorf("failed to %s container: %w: %s", action, err, last)
+	}
+
+	return fmt.Errorf("failed to %s container: %w", action, err)
+}
@@ -0,0 +1,69 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/containerd/containerd/oci"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+// namespaceFiles are the files under /proc/<pid>/ns of the namespaces
+// joined by the containers of a pod.
+var namespaceFiles = map[specs.LinuxNamespaceType]string{
+	specs.NetworkNamespace: "net",
+	specs.IPCNamespace:     "ipc",
+	specs.PIDNamespace:     "pid",
+}
+
+// joinNamespaces points the namespaces of the runtime spec of the container
+// at those of the container it joins. The joined container may have been
+// restarted since the container was created, so they are updated on every
+// start.
+func (d *OCIDriver) joinNamespaces(ctx context.Context, id string) error {
+	record, err := d.loadContainer(id)
+	if err != nil {
+		return err
+	}
+
+	if record.Join == "" {
+		return nil
+	}
+
+	status, err := d.ContainerStatus(ctx, record.Join)
+	if err != nil {
+		return fmt.Errorf("failed to load joined container %s: %w", record.Join, err)
+	}
+
+	run, err := loadRun(d.containerDir(record.Join))
+	if err != nil {
+		return err
+	}
+
+	if status.Status != driver.Running || run == nil || run.Pid == 0 {
+		return fmt.Errorf("joined container %s is not running", record.Join)
+	}
+
+	nsTypes := []specs.LinuxNamespaceType{specs.NetworkNamespace, specs.IPCNamespace}
+	if record.SharePID {
+		nsTypes = append(nsTypes, specs.PIDNamespace)
+	}
+
+	path := filepath.Join(d.containerDir(id), configFile)
+
+	var spec oci.Spec
+	if err := readJSON(path, &spec); err != nil {
+		return err
+	}
+
+	for _, t := range nsTypes {
+		ns := specs.LinuxNamespace{Type: t, Path: fmt.Sprintf("/proc/%d/ns/%s", run.Pid, namespaceFiles[t])}
+		if err := oci.WithLinuxNamespace(ns)(ctx, nil, nil, &spec); err != nil {
+			return err
+		}
+	}
+
+	return writeJSON(path, &spec)
+}
@@ -0,0 +1,489 @@
+// Package oci implements a driver running containers with an OCI runtime
+// such as runc or crun, without a container daemon. Images are pulled into a
+// local OCI image layout and unpacked into a root filesystem for each
+// container. Every container is run by a monitor process, see RunMonitor.
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/logfile"
+	"github.com/tmacro/sysctr/pkg/registry"
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	driver.RegisterDriver(&OCIDriver{})
+}
+
+const (
+	defaultRuntime     = "runc"
+	defaultRoot        = "/var/lib/sysctr/oci"
+	defaultRuntimeRoot = "/run/sysctr/oci"
+
+	// pollInterval is how often the state of a container is checked while
+	// waiting for it to exit.
+	pollInterval = 100 * time.Millisecond
+)
+
+type OCIDriver struct {
+	// Runtime is the name or path of the OCI runtime binary.
+	Runtime string `json:"runtime"`
+	// Root holds the images and containers.
+	Root string `json:"root"`
+	// RuntimeRoot holds the state of the runtime, it should be on a tmpfs.
+	RuntimeRoot string `json:"runtime_root"`
+
+	// executable is sysctr itself, started as the monitor of containers.
+	executable string
+	registries registry.Config
+}
+
+func (d *OCIDriver) DriverInfo() driver.DriverInfo {
+	return driver.DriverInfo{
+		ID:  "oci",
+		New: func() driver.Driver { return new(OCIDriver) },
+	}
+}
+
+func (d *OCIDriver) ConfigureRegistries(registries registry.Config) {
+	d.registries = registries
+}
+
+func (d *OCIDriver) Provision(ctx context.Context) error {
+	var err error
+
+	if d.Runtime == "" {
+		d.Runtime = defaultRuntime
+	}
+
+	if d.Root == "" {
+		d.Root = defaultRoot
+	}
+
+	if d.RuntimeRoot == "" {
+		d.RuntimeRoot = defaultRuntimeRoot
+	}
+
+	d.Runtime, err = exec.LookPath(d.Runtime)
+	if err != nil {
+		return err
+	}
+
+	d.executable, err = os.Executable()
+	if err != nil {
+		return err
+	}
+
+	d.executable, err = filepath.EvalSymlinks(d.executable)
+	if err != nil {
+		return err
+	}
+
+	return os.MkdirAll(d.containersDir(), 0700)
+}
+
+func matchLabels(have, want map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (d *OCIDriver) FindContainer(ctx context.Context, name string, labels map[string]string) (*driver.Status, error) {
+	records, err := d.loadContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*containerRecord
+	for _, record := range records {
+		if record.Name == name && matchLabels(record.Labels, labels) {
+			matches = append(matches, record)
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, driver.ErrContainerNotFound
+	}
+
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("found multiple containers with name %s", name)
+	}
+
+	return d.status(matches[0])
+}
+
+func (d *OCIDriver) ListContainers(ctx context.Context, labels map[string]string) ([]driver.Status, error) {
+	records, err := d.loadContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]driver.Status, 0, len(records))
+	for _, record := range records {
+		if !matchLabels(record.Labels, labels) {
+			continue
+		}
+
+		status, err := d.status(record)
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, *status)
+	}
+
+	return statuses, nil
+}
+
+func (d *OCIDriver) ContainerStatus(ctx context.Context, id string) (*driver.Status, error) {
+	record, err := d.loadContainer(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.status(record)
+}
+
+func (d *OCIDriver) status(record *containerRecord) (*driver.Status, error) {
+	status := &driver.Status{
+		ID:          record.ID,
+		Name:        record.Name,
+		Image:       record.Image,
+		Status:      driver.Created,
+		Labels:      record.Labels,
+		Annotations: record.Annotations,
+	}
+
+	run, err := loadRun(d.containerDir(record.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	if run == nil {
+		return status, nil
+	}
+
+	status.StartedAt = run.StartedAt
+
+	switch {
+	case run.Exited:
+		status.Status = driver.Stopped
+		status.ExitCode = run.ExitCode
+	case processAlive(run.Monitor) || d.runtimeRunning(record.ID):
+		status.Status = driver.Running
+	default:
+		// The monitor died without recording the exit code.
+		status.Status = driver.Stopped
+		status.ExitCode = 255
+	}
+
+	return status, nil
+}
+
+func processAlive(pid int) bool {
+	return pid > 0 && unix.Kill(pid, 0) == nil
+}
+
+// runtimeRunning reports whether the runtime knows of a running container
+// with the ID.
+func (d *OCIDriver) runtimeRunning(id string) bool {
+	out, err := d.runtime(id, "state", id).Output()
+	if err != nil {
+		return false
+	}
+
+	var state struct {
+		Status string `json:"status"`
+	}
+
+	if err := json.Unmarshal(out, &state); err != nil {
+		return false
+	}
+
+	return state.Status == "running" || state.Status == "paused"
+}
+
+func (d *OCIDriver) runtime(id string, args ...string) *exec.Cmd {
+	return runtimeCommand(d.Runtime, d.RuntimeRoot, d.containerDir(id), args...)
+}
+
+func (d *OCIDriver) CreateContainer(ctx context.Context, spec *driver.Spec) (string, error) {
+	if _, err := d.FindContainer(ctx, spec.Name, nil); err == nil {
+		return "", fmt.Errorf("container %s already exists", spec.Name)
+	} else if !errors.Is(err, driver.ErrContainerNotFound) {
+		return "", err
+	}
+
+	store, err := local.NewStore(d.imagesDir())
+	if err != nil {
+		return "", err
+	}
+
+	img, err := d.getImage(ctx, store, spec.Image)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := newContainerID()
+	if err != nil {
+		return "", err
+	}
+
+	dir := d.containerDir(id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	err = d.createBundle(ctx, id, spec, img, store)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to create container: %w", err)
+	}
+
+	return id, nil
+}
+
+// createBundle unpacks the image and writes the runtime spec of the
+// container. The container record is written last, so that containers are
+// only listed once complete.
+func (d *OCIDriver) createBundle(ctx context.Context, id string, spec *driver.Spec, img *image, store content.Store) error {
+	dir := d.containerDir(id)
+	rootfs := filepath.Join(dir, rootfsDir)
+
+	if err := unpack(ctx, store, img, rootfs); err != nil {
+		return err
+	}
+
+	runtimeSpec, err := newRuntimeSpec(ctx, id, rootfs, spec, img)
+	if err != nil {
+		return err
+	}
+
+	if err := writeJSON(filepath.Join(dir, configFile), runtimeSpec); err != nil {
+		return err
+	}
+
+	return writeJSON(filepath.Join(dir, containerFile), containerRecord{
+		ID:          id,
+		Name:        spec.Name,
+		Image:       spec.Image,
+		Labels:      spec.Labels,
+		Annotations: spec.Annotations,
+		CreatedAt:   time.Now().UTC(),
+		Join:        spec.Namespaces.Join,
+		SharePID:    spec.Namespaces.SharePID,
+	})
+}
+
+// StartContainer starts the monitor of the container and returns once it
+// reports that the container started.
+func (d *OCIDriver) StartContainer(ctx context.Context, id string) error {
+	status, err := d.ContainerStatus(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Like the other drivers, starting a running container does nothing, as
+	// Run does when it attaches to an existing container.
+	if status.Status == driver.Running {
+		return nil
+	}
+
+	if err := d.joinNamespaces(ctx, id); err != nil {
+		return err
+	}
+
+	dir := d.containerDir(id)
+	if err := os.Remove(filepath.Join(dir, runFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// The runtime may still know of the previous run if its monitor died.
+	d.runtime(id, "delete", "--force", id).Run()
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	defer readyR.Close()
+
+	monitor := exec.Command(d.executable, monitorCommand, "--runtime", d.Runtime, "--runtime-root", d.RuntimeRoot, dir)
+	monitor.ExtraFiles = []*os.File{readyW}
+	// The monitor outlives this process and must not receive the signals
+	// of its terminal.
+	monitor.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	err = monitor.Start()
+	readyW.Close()
+
+	if err != nil {
+		return fmt.Errorf("failed to start monitor: %w", err)
+	}
+
+	go monitor.Wait()
+
+	ready := make(chan string, 1)
+	go func() {
+		data, _ := io.ReadAll(readyR)
+		ready <- string(data)
+	}()
+
+	select {
+	case msg := <-ready:
+		if msg != "ok" {
+			if msg == "" {
+				msg = "monitor exited"
+			}
+
+			return errors.New(msg)
+		}
+
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *OCIDriver) StopContainer(ctx context.Context, id string, opts driver.StopOptions) error {
+	signal := opts.Signal
+	if signal == "" {
+		signal = driver.DefaultStopSignal
+	}
+
+	stopped, err := d.kill(ctx, id, signal)
+	if err != nil || stopped {
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	err = d.WaitForExit(waitCtx, id)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	stopped, err = d.kill(ctx, id, "SIGKILL")
+	if err != nil || stopped {
+		return err
+	}
+
+	return d.WaitForExit(ctx, id)
+}
+
+// kill sends signal to the container. It reports whether the container is
+// already stopped.
+func (d *OCIDriver) kill(ctx context.Context, id, signal string) (bool, error) {
+	status, err := d.ContainerStatus(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	if status.Status != driver.Running {
+		return true, nil
+	}
+
+	out, err := d.runtime(id, "kill", id, signal).CombinedOutput()
+	if err == nil {
+		return false, nil
+	}
+
+	// The container may have exited in the meantime.
+	status, statusErr := d.ContainerStatus(ctx, id)
+	if statusErr == nil && status.Status != driver.Running {
+		return true, nil
+	}
+
+	return false, fmt.Errorf("failed to kill container: %w: %s", err, out)
+}
+
+func (d *OCIDriver) RemoveContainer(ctx context.Context, id string) error {
+	if _, err := d.loadContainer(id); err != nil {
+		return err
+	}
+
+	stopped, err := d.kill(ctx, id, "SIGKILL")
+	if err != nil {
+		return err
+	}
+
+	if !stopped {
+		if err := d.WaitForExit(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	d.runtime(id, "delete", "--force", id).Run()
+
+	return os.RemoveAll(d.containerDir(id))
+}
+
+// WaitForExit polls the state of the container until it is no longer
+// running.
+func (d *OCIDriver) WaitForExit(ctx context.Context, id string) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		status, err := d.ContainerStatus(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if status.Status != driver.Running {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *OCIDriver) GetLogs(ctx context.Context, id string, opts driver.LogOptions) error {
+	if _, err := d.loadContainer(id); err != nil {
+		return err
+	}
+
+	readOpts := logfile.ReadOptions{
+		Stdout:     opts.Stdout,
+		Stderr:     opts.Stderr,
+		Since:      opts.Since,
+		Until:      opts.Until,
+		Tail:       opts.Tail,
+		Timestamps: opts.Timestamps,
+	}
+
+	if opts.Follow {
+		readOpts.Running = func(ctx context.Context) (bool, error) {
+			status, err := d.ContainerStatus(ctx, id)
+			if err != nil {
+				return false, err
+			}
+
+			return status.Status == driver.Running, nil
+		}
+	}
+
+	return logfile.Read(ctx, filepath.Join(d.containerDir(id), logFile), readOpts)
+}
@@ -0,0 +1,353 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/platforms"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/driver/drivertest"
+)
+
+// TestMain runs the monitor when the test binary is started by
+// StartContainer in place of sysctr.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == monitorCommand {
+		flags := flag.NewFlagSet(monitorCommand, flag.ExitOnError)
+		runtime := flags.String("runtime", "", "")
+		runtimeRoot := flags.String("runtime-root", "", "")
+		flags.Parse(os.Args[2:])
+
+		if err := RunMonitor(*runtime, *runtimeRoot, flags.Arg(0)); err != nil {
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// TestConformance runs containers with the local OCI runtime, as root. It is
+// skipped unless SYSCTR_TEST_OCI is set.
+func TestConformance(t *testing.T) {
+	if os.Getenv("SYSCTR_TEST_OCI") == "" {
+		t.Skip("SYSCTR_TEST_OCI not set")
+	}
+
+	drivertest.Run(t, drivertest.Config{
+		New: func(t *testing.T) driver.Driver {
+			d := &OCIDriver{
+				Root:        t.TempDir(),
+				RuntimeRoot: filepath.Join(defaultRuntimeRoot, "test"),
+			}
+
+			if err := d.Provision(context.Background()); err != nil {
+				t.Fatalf("Provision: %v", err)
+			}
+
+			return d
+		},
+		Image: "busybox:latest",
+	})
+}
+
+func TestProcessArgs(t *testing.T) {
+	img := &image{}
+	img.Config.Config.Entrypoint = []string{"/entrypoint.sh"}
+	img.Config.Config.Cmd = []string{"serve"}
+
+	tests := []struct {
+		name string
+		spec driver.Spec
+		want []string
+	}{
+		{"image", driver.Spec{}, []string{"/entrypoint.sh", "serve"}},
+		{"arguments", driver.Spec{Arguments: []string{"check"}}, []string{"/entrypoint.sh", "check"}},
+		{"command", driver.Spec{Command: []string{"/bin/sh"}}, []string{"/bin/sh"}},
+		{"both", driver.Spec{Command: []string{"/bin/sh"}, Arguments: []string{"-c", "true"}}, []string{"/bin/sh", "-c", "true"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := processArgs(&tt.spec, img)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("processArgs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetworkSpecOpts(t *testing.T) {
+	if _, err := networkSpecOpts(driver.Network{Mode: driver.NetworkHost}); err != nil {
+		t.Errorf("host: %v", err)
+	}
+
+	if _, err := networkSpecOpts(driver.Network{Mode: driver.NetworkNone}); err != nil {
+		t.Errorf("none: %v", err)
+	}
+
+	ports := []driver.Port{{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}}
+	if _, err := networkSpecOpts(driver.Network{Mode: driver.NetworkNone, Ports: ports}); err == nil {
+		t.Error("none with ports: expected an error")
+	}
+
+	if _, err := networkSpecOpts(driver.Network{Mode: driver.NetworkBridge}); err == nil {
+		t.Error("bridge: expected an error")
+	}
+}
+
+func TestTagImage(t *testing.T) {
+	d := &OCIDriver{Root: t.TempDir()}
+	if err := os.MkdirAll(d.imagesDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "docker.io/library/busybox:latest"
+	first := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageIndex, Digest: "sha256:aaaa", Size: 1}
+	second := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageIndex, Digest: "sha256:bbbb", Size: 1}
+	other := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageIndex, Digest: "sha256:cccc", Size: 1}
+
+	for _, tag := range []struct {
+		name string
+		desc ocispec.Descriptor
+	}{{name, first}, {"docker.io/library/alpine:latest", other}, {name, second}} {
+		if err := d.tagImage(tag.name, tag.desc); err != nil {
+			t.Fatalf("tagImage: %v", err)
+		}
+	}
+
+	index, err := d.readIndex()
+	if err != nil {
+		t.Fatalf("readIndex: %v", err)
+	}
+
+	if len(index.Manifests) != 2 {
+		t.Fatalf("index has %d manifests, want 2", len(index.Manifests))
+	}
+
+	for _, m := range index.Manifests {
+		if m.Annotations[ocispec.AnnotationRefName] == name && m.Digest != second.Digest {
+			t.Errorf("%s is %s, want %s", name, m.Digest, second.Digest)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(d.imagesDir(), layoutFile)); err != nil {
+		t.Errorf("layout file: %v", err)
+	}
+}
+
+// writeImage stores an image without layers for the current platform in the
+// store of d under name.
+func writeImage(t *testing.T, d *OCIDriver, name string) ocispec.Descriptor {
+	t.Helper()
+
+	ctx := context.Background()
+	store, err := local.NewStore(d.imagesDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(mediaType string, v any) ocispec.Descriptor {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		desc := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(data), Size: int64(len(data))}
+		if err := content.WriteBlob(ctx, store, desc.Digest.String(), bytes.NewReader(data), desc); err != nil {
+			t.Fatal(err)
+		}
+
+		return desc
+	}
+
+	config := write(ocispec.MediaTypeImageConfig, ocispec.Image{
+		Platform: platforms.DefaultSpec(),
+		RootFS:   ocispec.RootFS{Type: "layers"},
+	})
+
+	manifest := ocispec.Manifest{MediaType: ocispec.MediaTypeImageManifest, Config: config, Layers: []ocispec.Descriptor{}}
+	manifest.SchemaVersion = 2
+
+	desc := write(ocispec.MediaTypeImageManifest, manifest)
+	if err := d.tagImage(name, desc); err != nil {
+		t.Fatal(err)
+	}
+
+	return desc
+}
+
+func TestImageArchive(t *testing.T) {
+	ctx := context.Background()
+	name := "docker.io/library/app:1.0"
+
+	src := &OCIDriver{Root: t.TempDir()}
+	desc := writeImage(t, src, name)
+
+	var archive bytes.Buffer
+	if err := src.SaveImages(ctx, &archive, []string{"app:1.0"}); err != nil {
+		t.Fatalf("SaveImages: %v", err)
+	}
+
+	dst := &OCIDriver{Root: t.TempDir()}
+
+	names, err := dst.LoadImages(ctx, &archive)
+	if err != nil {
+		t.Fatalf("LoadImages: %v", err)
+	}
+
+	if !reflect.DeepEqual(names, []string{name}) {
+		t.Errorf("LoadImages: want [%s], got %v", name, names)
+	}
+
+	got, err := dst.ImageDigest(ctx, "app:1.0")
+	if err != nil {
+		t.Fatalf("ImageDigest: %v", err)
+	}
+
+	if got != desc.Digest.String() {
+		t.Errorf("ImageDigest: want %s, got %s", desc.Digest, got)
+	}
+
+	if err := src.SaveImages(ctx, &archive, []string{"missing:1.0"}); !errors.Is(err, driver.ErrImageNotFound) {
+		t.Errorf("SaveImages: want ErrImageNotFound, got %v", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	// The runtime knows of no container.
+	d := &OCIDriver{Root: t.TempDir(), Runtime: "false"}
+	ctx := context.Background()
+
+	record := containerRecord{ID: "abc", Name: "my-app", Image: "busybox:latest", Labels: map[string]string{"app": "my-app"}}
+	dir := d.containerDir(record.ID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeJSON(filepath.Join(dir, containerFile), record); err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Now().UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name     string
+		run      *runRecord
+		status   driver.ContainerStatus
+		exitCode int
+	}{
+		{"created", nil, driver.Created, 0},
+		{"running", &runRecord{Monitor: os.Getpid(), StartedAt: started}, driver.Running, 0},
+		{"exited", &runRecord{StartedAt: started, Exited: true, ExitCode: 3}, driver.Stopped, 3},
+		{"monitor died", &runRecord{Monitor: -1, StartedAt: started}, driver.Stopped, 255},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(filepath.Join(dir, runFile))
+			if tt.run != nil {
+				if err := writeJSON(filepath.Join(dir, runFile), tt.run); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			status, err := d.FindContainer(ctx, "my-app", map[string]string{"app": "my-app"})
+			if err != nil {
+				t.Fatalf("FindContainer: %v", err)
+			}
+
+			if status.Status != tt.status || status.ExitCode != tt.exitCode {
+				t.Errorf("status = %s (%d), want %s (%d)", status.Status, status.ExitCode, tt.status, tt.exitCode)
+			}
+		})
+	}
+
+	if _, err := d.FindContainer(ctx, "my-app", map[string]string{"app": "other"}); err != driver.ErrContainerNotFound {
+		t.Errorf("FindContainer with other labels: %v, want %v", err, driver.ErrContainerNotFound)
+	}
+
+	if _, err := d.ContainerStatus(ctx, "../abc"); err == nil {
+		t.Error("ContainerStatus with a path: expected an error")
+	}
+}
+
+func TestJoinNamespaces(t *testing.T) {
+	d := &OCIDriver{Root: t.TempDir(), Runtime: "false"}
+	ctx := context.Background()
+
+	write := func(record containerRecord, run *runRecord, spec *specs.Spec) {
+		dir := d.containerDir(record.ID)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := writeJSON(filepath.Join(dir, containerFile), record); err != nil {
+			t.Fatal(err)
+		}
+
+		if run != nil {
+			if err := writeJSON(filepath.Join(dir, runFile), run); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if spec != nil {
+			if err := writeJSON(filepath.Join(dir, configFile), spec); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	write(containerRecord{ID: "primary", Name: "app"}, &runRecord{Monitor: os.Getpid(), Pid: 4242}, nil)
+	write(containerRecord{ID: "sidecar", Name: "app-exporter", Join: "primary"}, nil, &specs.Spec{
+		Linux: &specs.Linux{Namespaces: []specs.LinuxNamespace{
+			{Type: specs.NetworkNamespace},
+			{Type: specs.IPCNamespace},
+			{Type: specs.PIDNamespace},
+		}},
+	})
+
+	if err := d.joinNamespaces(ctx, "sidecar"); err != nil {
+		t.Fatalf("joinNamespaces: %v", err)
+	}
+
+	var spec specs.Spec
+	if err := readJSON(filepath.Join(d.containerDir("sidecar"), configFile), &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[specs.LinuxNamespaceType]string{
+		specs.NetworkNamespace: "/proc/4242/ns/net",
+		specs.IPCNamespace:     "/proc/4242/ns/ipc",
+		// The PID namespace is not shared.
+		specs.PIDNamespace: "",
+	}
+
+	for _, ns := range spec.Linux.Namespaces {
+		if ns.Path != want[ns.Type] {
+			t.Errorf("%s namespace: want path %q, got %q", ns.Type, want[ns.Type], ns.Path)
+		}
+	}
+
+	// The joined container exited.
+	write(containerRecord{ID: "primary", Name: "app"}, &runRecord{Pid: 4242, Exited: true}, nil)
+
+	if err := d.joinNamespaces(ctx, "sidecar"); err == nil {
+		t.Error("joinNamespaces: expected an error once the joined container exited")
+	}
+}
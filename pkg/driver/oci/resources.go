@@ -0,0 +1,90 @@
+package oci
+
+import (
+	"context"
+
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+// defaultCPUPeriod is the CFS period used by the kernel and Docker when only
+// a quota is set.
+const defaultCPUPeriod = 100000
+
+// resourceSpecOpts returns the OCI spec options applying the cgroup limits of
+// res.
+func resourceSpecOpts(res driver.Resources) []oci.SpecOpts {
+	var opts []oci.SpecOpts
+
+	if res.CPUShares > 0 {
+		opts = append(opts, oci.WithCPUShares(uint64(res.CPUShares)))
+	}
+
+	if res.CPUQuota > 0 || res.CPUPeriod > 0 {
+		period := uint64(res.CPUPeriod)
+		if period == 0 {
+			period = defaultCPUPeriod
+		}
+
+		quota := res.CPUQuota
+		if quota == 0 {
+			quota = -1
+		}
+
+		opts = append(opts, oci.WithCPUCFS(quota, period))
+	}
+
+	if res.MemoryLimit > 0 {
+		opts = append(opts, oci.WithMemoryLimit(uint64(res.MemoryLimit)))
+	}
+
+	if res.MemoryReservation > 0 {
+		opts = append(opts, withMemoryReservation(res.MemoryReservation))
+	}
+
+	if res.PidsLimit > 0 {
+		opts = append(opts, oci.WithPidsLimit(res.PidsLimit))
+	}
+
+	if res.BlkioWeight > 0 {
+		opts = append(opts, withBlkioWeight(res.BlkioWeight))
+	}
+
+	return opts
+}
+
+func withMemoryReservation(reservation int64) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		ensureResources(s)
+		if s.Linux.Resources.Memory == nil {
+			s.Linux.Resources.Memory = &specs.LinuxMemory{}
+		}
+
+		s.Linux.Resources.Memory.Reservation = &reservation
+		return nil
+	}
+}
+
+func withBlkioWeight(weight uint16) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		ensureResources(s)
+		if s.Linux.Resources.BlockIO == nil {
+			s.Linux.Resources.BlockIO = &specs.LinuxBlockIO{}
+		}
+
+		s.Linux.Resources.BlockIO.Weight = &weight
+		return nil
+	}
+}
+
+func ensureResources(s *oci.Spec) {
+	if s.Linux == nil {
+		s.Linux = &specs.Linux{}
+	}
+
+	if s.Linux.Resources == nil {
+		s.Linux.Resources = &specs.LinuxResources{}
+	}
+}
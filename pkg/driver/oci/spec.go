@@ -0,0 +1,119 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/oci"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+// processArgs returns the command of the container. Like Docker, the command
+// of the spec replaces the entrypoint of the image and the arguments replace
+// its cmd, which is dropped when only the entrypoint is replaced.
+func processArgs(spec *driver.Spec, img *image) []string {
+	entrypoint := img.Config.Config.Entrypoint
+	cmd := img.Config.Config.Cmd
+
+	if len(spec.Command) > 0 {
+		entrypoint = spec.Command
+		cmd = nil
+	}
+
+	if len(spec.Arguments) > 0 {
+		cmd = spec.Arguments
+	}
+
+	args := make([]string, 0, len(entrypoint)+len(cmd))
+	args = append(args, entrypoint...)
+	return append(args, cmd...)
+}
+
+// newRuntimeSpec returns the runtime spec of the container created from
+// spec, with its root filesystem unpacked at rootfs.
+func newRuntimeSpec(ctx context.Context, id, rootfs string, spec *driver.Spec, img *image) (*specs.Spec, error) {
+	args := processArgs(spec, img)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no command given and image %s has none", img.Name)
+	}
+
+	env := append([]string{}, img.Config.Config.Env...)
+	for k, v := range spec.Environment {
+		env = append(env, k+"="+v)
+	}
+
+	mounts := make([]specs.Mount, 0, len(spec.Volumes))
+	for _, v := range spec.Volumes {
+		mode := "rw"
+		if v.ReadOnly {
+			mode = "ro"
+		}
+
+		mounts = append(mounts, specs.Mount{
+			Type:        "bind",
+			Source:      v.Source,
+			Destination: v.Target,
+			Options:     []string{"rbind", mode},
+		})
+	}
+
+	opts := []oci.SpecOpts{
+		oci.WithRootFSPath(rootfs),
+		oci.WithProcessArgs(args...),
+		oci.WithEnv(env),
+		oci.WithMounts(mounts),
+		oci.WithHostname(spec.Name),
+		oci.WithAnnotations(spec.Annotations),
+		oci.WithCgroup("/sysctr/" + id),
+	}
+
+	if cwd := img.Config.Config.WorkingDir; cwd != "" {
+		opts = append(opts, oci.WithProcessCwd(cwd))
+	}
+
+	// Names are looked up in the passwd and group files of the root
+	// filesystem.
+	if user := img.Config.Config.User; user != "" {
+		opts = append(opts, oci.WithUser(user), oci.WithAdditionalGIDs(user))
+	}
+
+	if spec.Namespaces.Join != "" {
+		// The network namespace is joined when the container is started.
+		opts = append(opts, oci.WithHostHostsFile, oci.WithHostResolvconf)
+	} else {
+		networkOpts, err := networkSpecOpts(spec.Network)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, networkOpts...)
+	}
+	opts = append(opts, resourceSpecOpts(spec.Resources)...)
+
+	ctx = namespaces.WithNamespace(ctx, "sysctr")
+	return oci.GenerateSpec(ctx, nil, &containers.Container{ID: id}, opts...)
+}
+
+func networkSpecOpts(network driver.Network) ([]oci.SpecOpts, error) {
+	switch network.Mode {
+	case "", driver.NetworkHost:
+		return []oci.SpecOpts{
+			oci.WithHostNamespace(specs.NetworkNamespace),
+			oci.WithHostHostsFile,
+			oci.WithHostResolvconf,
+		}, nil
+	case driver.NetworkNone:
+		if len(network.Ports) > 0 {
+			return nil, fmt.Errorf("ports can not be published in %s network mode", driver.NetworkNone)
+		}
+
+		// The default spec has a network namespace of its own with only
+		// a loopback interface.
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("network mode %s is not supported by the oci driver", network.Mode)
+}
@@ -0,0 +1,159 @@
+package oci
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+// Each container is stored in its own directory under <root>/containers,
+// which is also the bundle passed to the runtime.
+const (
+	containerFile = "container.json"
+	runFile       = "run.json"
+	configFile    = "config.json"
+	rootfsDir     = "rootfs"
+	logFile       = "container.log"
+	runtimeLog    = "runtime.log"
+	pidFile       = "init.pid"
+)
+
+// containerRecord is what the driver knows about a container, written when
+// it is created.
+type containerRecord struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Image       string            `json:"image"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	// Join is the ID of the container whose namespaces are joined, see
+	// joinNamespaces.
+	Join     string `json:"join,omitempty"`
+	SharePID bool   `json:"share_pid,omitempty"`
+}
+
+// runRecord is the last run of a container, written by the monitor when the
+// container starts and exits.
+type runRecord struct {
+	// Monitor is the pid of the monitor of the container.
+	Monitor    int       `json:"monitor_pid"`
+	Pid        int       `json:"pid"`
+	StartedAt  time.Time `json:"started_at"`
+	Exited     bool      `json:"exited"`
+	ExitCode   int       `json:"exit_code"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+}
+
+func newContainerID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func (d *OCIDriver) containersDir() string {
+	return filepath.Join(d.Root, "containers")
+}
+
+func (d *OCIDriver) containerDir(id string) string {
+	return filepath.Join(d.containersDir(), id)
+}
+
+// loadContainer returns the record of a container, wrapping
+// driver.ErrContainerNotFound if there is none.
+func (d *OCIDriver) loadContainer(id string) (*containerRecord, error) {
+	if id == "" || filepath.Base(id) != id {
+		return nil, fmt.Errorf("%w: %s", driver.ErrContainerNotFound, id)
+	}
+
+	var record containerRecord
+	err := readJSON(filepath.Join(d.containerDir(id), containerFile), &record)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", driver.ErrContainerNotFound, id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// loadContainers returns the records of every container.
+func (d *OCIDriver) loadContainers() ([]*containerRecord, error) {
+	entries, err := os.ReadDir(d.containersDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*containerRecord, 0, len(entries))
+	for _, e := range entries {
+		record, err := d.loadContainer(e.Name())
+		if errors.Is(err, driver.ErrContainerNotFound) {
+			// Being created or removed.
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// loadRun returns the last run of the container in dir, nil if it has never
+// been started.
+func loadRun(dir string) (*runRecord, error) {
+	var run runRecord
+	err := readJSON(filepath.Join(dir, runFile), &run)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// writeJSON atomically replaces the file at path.
+func writeJSON(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
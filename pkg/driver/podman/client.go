@@ -0,0 +1,190 @@
+package podman
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// apiVersion is the version of the libpod API used by the driver, supported
+// by Podman 4.0 and later.
+const apiVersion = "v4.0.0"
+
+// client calls the libpod REST API of Podman over its unix socket.
+type client struct {
+	socket string
+	http   *http.Client
+}
+
+func newClient(socket string) *client {
+	return &client{
+		socket: socket,
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// apiError is the error returned by the API for unsuccessful requests.
+type apiError struct {
+	StatusCode int    `json:"response"`
+	Message    string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("podman: %s (status %d)", e.Message, e.StatusCode)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// isNotRunning reports whether the request failed because the container is
+// not running.
+func isNotRunning(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict
+}
+
+func (c *client) url(path string, query url.Values) string {
+	u := url.URL{
+		Scheme:   "http",
+		Host:     "d",
+		Path:     "/" + apiVersion + "/libpod" + path,
+		RawQuery: query.Encode(),
+	}
+
+	return u.String()
+}
+
+func (c *client) newRequest(ctx context.Context, method, path string, query url.Values, body any) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path, query), reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req, nil
+}
+
+// do sends a request and returns the response if it succeeded. The caller
+// must close the body of the response.
+func (c *client) do(ctx context.Context, method, path string, query url.Values, body any) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.send(req)
+}
+
+// send sends req and returns the response if it succeeded. The caller must
+// close the body of the response.
+func (c *client) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, decodeError(resp)
+	}
+
+	return resp, nil
+}
+
+// call sends a request and decodes the response into out, unless it is nil.
+func (c *client) call(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	resp, err := c.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func decodeError(resp *http.Response) error {
+	apiErr := &apiError{StatusCode: resp.StatusCode}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = string(bytes.TrimSpace(data))
+	}
+
+	apiErr.StatusCode = resp.StatusCode
+
+	return apiErr
+}
+
+// hijack sends a request that upgrades the connection to a raw stream, as
+// done to attach to an exec session. The returned reader yields the output
+// of the session, input is written to the connection.
+func (c *client) hijack(ctx context.Context, path string, body any) (*net.UnixConn, *bufio.Reader, error) {
+	req, err := c.newRequest(ctx, http.MethodPost, path, nil, body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", c.socket)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer conn.Close()
+		return nil, nil, decodeError(resp)
+	}
+
+	return conn.(*net.UnixConn), reader, nil
+}
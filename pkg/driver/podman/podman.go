@@ -0,0 +1,754 @@
+package podman
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/rs/zerolog"
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/registry"
+)
+
+func init() {
+	driver.RegisterDriver(&PodmanDriver{})
+}
+
+const defaultSocket = "/run/podman/podman.sock"
+
+type PodmanDriver struct {
+	// Socket is the path of the Podman API socket.
+	Socket string `json:"socket"`
+	// Rootless talks to the Podman service of the user running sysctr
+	// rather than the system one.
+	Rootless bool `json:"rootless"`
+
+	client     *client
+	registries registry.Config
+}
+
+func (d *PodmanDriver) DriverInfo() driver.DriverInfo {
+	return driver.DriverInfo{
+		ID:  "podman",
+		New: func() driver.Driver { return new(PodmanDriver) },
+	}
+}
+
+func (d *PodmanDriver) ServiceDependencies() []string {
+	return []string{"podman.socket"}
+}
+
+// rootlessSocket returns the path of the API socket of the Podman service of
+// the current user.
+func rootlessSocket() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = filepath.Join("/run/user", strconv.Itoa(os.Getuid()))
+	}
+
+	return filepath.Join(dir, "podman", "podman.sock")
+}
+
+func (d *PodmanDriver) Provision(ctx context.Context) error {
+	if d.Socket == "" {
+		d.Socket = defaultSocket
+		if d.Rootless {
+			d.Socket = rootlessSocket()
+		}
+	}
+
+	d.client = newClient(d.Socket)
+
+	return d.client.call(ctx, http.MethodGet, "/_ping", nil, nil, nil)
+}
+
+// pullReport is a line of the progress reported while pulling an image.
+type pullReport struct {
+	Stream string   `json:"stream"`
+	Error  string   `json:"error"`
+	Images []string `json:"images"`
+	ID     string   `json:"id"`
+}
+
+// ConfigureRegistries sets the credentials sent to registries. Their
+// certificate authorities are configured in /etc/containers/certs.d.
+func (d *PodmanDriver) ConfigureRegistries(registries registry.Config) {
+	d.registries = registries
+}
+
+func (d *PodmanDriver) PullImage(ctx context.Context, imageRef string) error {
+	auth, err := d.registries.EncodeAuth(imageRef)
+	if err != nil {
+		return err
+	}
+
+	req, err := d.client.newRequest(ctx, http.MethodPost, "/images/pull", url.Values{
+		"reference": {imageRef},
+		"policy":    {"always"},
+		"tlsVerify": {strconv.FormatBool(!d.registries.Insecure(imageRef))},
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	if auth != "" {
+		req.Header.Set("X-Registry-Auth", auth)
+	}
+
+	resp, err := d.client.send(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	logger := zerolog.Ctx(ctx).With().Str("driver", "podman").Logger()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var report pullReport
+		err := dec.Decode(&report)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if report.Error != "" {
+			return fmt.Errorf("failed to pull image: %s", report.Error)
+		}
+
+		if report.Stream != "" {
+			logger.Debug().Msg(strings.TrimSpace(report.Stream))
+		}
+
+		if report.ID != "" {
+			logger.Info().Str("id", report.ID).Msg("pulled")
+		}
+	}
+}
+
+// inspectedImage is an image as returned by the inspect endpoint.
+type inspectedImage struct {
+	ID          string   `json:"Id"`
+	Digest      string   `json:"Digest"`
+	RepoDigests []string `json:"RepoDigests"`
+}
+
+// ImageDigest returns the repository digest of the image, or the digest of
+// its manifest if it was not pulled by the name of the image.
+func (d *PodmanDriver) ImageDigest(ctx context.Context, imageRef string) (string, error) {
+	var img inspectedImage
+	err := d.client.call(ctx, http.MethodGet, "/images/"+imageRef+"/json", nil, nil, &img)
+	if isNotFound(err) {
+		return "", fmt.Errorf("%w: %s", driver.ErrImageNotFound, imageRef)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if digest := driver.RepoDigest(imageRef, img.RepoDigests); digest != "" {
+		return digest, nil
+	}
+
+	if img.Digest != "" {
+		return img.Digest, nil
+	}
+
+	return "sha256:" + img.ID, nil
+}
+
+// TagImage names the image with target, which is split into the repository
+// and tag the tag endpoint expects.
+func (d *PodmanDriver) TagImage(ctx context.Context, imageRef, target string) error {
+	named, err := reference.ParseDockerRef(target)
+	if err != nil {
+		return err
+	}
+
+	tagged, ok := named.(reference.Tagged)
+	if !ok {
+		return fmt.Errorf("image reference %s has no tag", target)
+	}
+
+	err = d.client.call(ctx, http.MethodPost, "/images/"+imageRef+"/tag", url.Values{
+		"repo": {named.Name()},
+		"tag":  {tagged.Tag()},
+	}, nil, nil)
+	if isNotFound(err) {
+		return fmt.Errorf("%w: %s", driver.ErrImageNotFound, imageRef)
+	}
+
+	return err
+}
+
+// loadReport is the response of the image load endpoint.
+type loadReport struct {
+	Names []string `json:"Names"`
+}
+
+func (d *PodmanDriver) LoadImages(ctx context.Context, r io.Reader) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.client.url("/images/load", nil), r)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-tar")
+
+	resp, err := d.client.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	var report loadReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, err
+	}
+
+	return report.Names, nil
+}
+
+func (d *PodmanDriver) SaveImages(ctx context.Context, w io.Writer, imageRefs []string) error {
+	for _, ref := range imageRefs {
+		err := d.client.call(ctx, http.MethodGet, "/images/"+ref+"/exists", nil, nil, nil)
+		if isNotFound(err) {
+			return fmt.Errorf("%w: %s", driver.ErrImageNotFound, ref)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := d.client.do(ctx, http.MethodGet, "/images/export", url.Values{
+		"format":     {"docker-archive"},
+		"references": imageRefs,
+		"compress":   {"false"},
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+
+	return err
+}
+
+// listedContainer is a container as returned by the list endpoint.
+type listedContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// listFilters returns the filters of the list endpoint selecting containers
+// with all the labels.
+func listFilters(labels map[string]string) (string, error) {
+	filters := map[string][]string{}
+	for k, v := range labels {
+		filters["label"] = append(filters["label"], fmt.Sprintf("%s=%s", k, v))
+	}
+
+	data, err := json.Marshal(filters)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (d *PodmanDriver) listContainers(ctx context.Context, labels map[string]string) ([]listedContainer, error) {
+	filters, err := listFilters(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []listedContainer
+	err = d.client.call(ctx, http.MethodGet, "/containers/json", url.Values{
+		"all":     {"true"},
+		"filters": {filters},
+	}, nil, &containers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	return containers, nil
+}
+
+func (d *PodmanDriver) FindContainer(ctx context.Context, name string, labels map[string]string) (*driver.Status, error) {
+	containers, err := d.listContainers(ctx, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	// The name filter of Podman matches substrings, so names are compared
+	// here.
+	var matches []listedContainer
+	for _, c := range containers {
+		for _, n := range c.Names {
+			if n == name {
+				matches = append(matches, c)
+				break
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, driver.ErrContainerNotFound
+	}
+
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("found multiple containers with name %s", name)
+	}
+
+	status, err := d.ContainerStatus(ctx, matches[0].ID)
+	if isNotFound(err) {
+		// Removed since it was listed.
+		return nil, driver.ErrContainerNotFound
+	}
+
+	return status, err
+}
+
+func (d *PodmanDriver) ListContainers(ctx context.Context, labels map[string]string) ([]driver.Status, error) {
+	containers, err := d.listContainers(ctx, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	// The exit code and annotations are only available by inspecting each
+	// container.
+	statuses := make([]driver.Status, 0, len(containers))
+	for _, c := range containers {
+		status, err := d.ContainerStatus(ctx, c.ID)
+		if isNotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, *status)
+	}
+
+	return statuses, nil
+}
+
+// inspectedContainer is a container as returned by the inspect endpoint.
+type inspectedContainer struct {
+	ID        string `json:"Id"`
+	Name      string `json:"Name"`
+	ImageName string `json:"ImageName"`
+	State     struct {
+		Status    string    `json:"Status"`
+		ExitCode  int       `json:"ExitCode"`
+		StartedAt time.Time `json:"StartedAt"`
+	} `json:"State"`
+	Config struct {
+		Labels      map[string]string `json:"Labels"`
+		Annotations map[string]string `json:"Annotations"`
+	} `json:"Config"`
+}
+
+func convertPodmanStatus(status string) driver.ContainerStatus {
+	switch status {
+	case "created", "configured", "initialized":
+		return driver.Created
+	case "running", "paused", "stopping":
+		return driver.Running
+	case "exited", "stopped", "removing":
+		return driver.Stopped
+	}
+
+	return driver.UnknownStatus
+}
+
+func (d *PodmanDriver) ContainerStatus(ctx context.Context, id string) (*driver.Status, error) {
+	var container inspectedContainer
+	err := d.client.call(ctx, http.MethodGet, "/containers/"+id+"/json", nil, nil, &container)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	containerStatus := convertPodmanStatus(container.State.Status)
+	if containerStatus == driver.UnknownStatus {
+		return nil, fmt.Errorf("unknown container status: %s", container.State.Status)
+	}
+
+	status := driver.Status{
+		ID:          container.ID,
+		Name:        container.Name,
+		Image:       container.ImageName,
+		Status:      containerStatus,
+		Labels:      container.Config.Labels,
+		Annotations: container.Config.Annotations,
+		ExitCode:    container.State.ExitCode,
+	}
+
+	if container.State.StartedAt.After(time.Time{}) {
+		status.StartedAt = container.State.StartedAt
+	}
+
+	return &status, nil
+}
+
+// specGenerator is the subset of the container spec of the create endpoint
+// used by the driver.
+type specGenerator struct {
+	Name           string            `json:"name"`
+	Image          string            `json:"image"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Annotations    map[string]string `json:"annotations,omitempty"`
+	Entrypoint     []string          `json:"entrypoint,omitempty"`
+	Command        []string          `json:"command,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	Mounts         []mount           `json:"mounts,omitempty"`
+	NetNS          namespace         `json:"netns"`
+	IpcNS          *namespace        `json:"ipcns,omitempty"`
+	PidNS          *namespace        `json:"pidns,omitempty"`
+	PortMappings   []portMapping     `json:"portmappings,omitempty"`
+	ResourceLimits *resourceLimits   `json:"resource_limits,omitempty"`
+}
+
+type mount struct {
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Destination string   `json:"destination"`
+	Options     []string `json:"options,omitempty"`
+}
+
+type namespace struct {
+	NSMode string `json:"nsmode"`
+	// Value is the container joined in container mode.
+	Value string `json:"value,omitempty"`
+}
+
+type portMapping struct {
+	ContainerPort int    `json:"container_port"`
+	HostPort      int    `json:"host_port"`
+	HostIP        string `json:"host_ip,omitempty"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+func convertMounts(volumes []driver.Volume) []mount {
+	mounts := make([]mount, 0, len(volumes))
+	for _, v := range volumes {
+		options := []string{"rbind"}
+		if v.ReadOnly {
+			options = append(options, "ro")
+		}
+
+		mounts = append(mounts, mount{
+			Type:        "bind",
+			Source:      v.Source,
+			Destination: v.Target,
+			Options:     options,
+		})
+	}
+
+	return mounts
+}
+
+func convertPorts(ports []driver.Port) []portMapping {
+	mappings := make([]portMapping, 0, len(ports))
+	for _, p := range ports {
+		mappings = append(mappings, portMapping{
+			ContainerPort: p.ContainerPort,
+			HostPort:      p.HostPort,
+			HostIP:        p.HostIP,
+			Protocol:      p.Protocol,
+		})
+	}
+
+	return mappings
+}
+
+func (d *PodmanDriver) CreateContainer(ctx context.Context, spec *driver.Spec) (string, error) {
+	networkMode := spec.Network.Mode
+	if networkMode == "" {
+		networkMode = driver.NetworkHost
+	}
+
+	gen := specGenerator{
+		Name:           spec.Name,
+		Image:          spec.Image,
+		Labels:         spec.Labels,
+		Annotations:    spec.Annotations,
+		Entrypoint:     spec.Command,
+		Command:        spec.Arguments,
+		Env:            spec.Environment,
+		Mounts:         convertMounts(spec.Volumes),
+		NetNS:          namespace{NSMode: string(networkMode)},
+		PortMappings:   convertPorts(spec.Network.Ports),
+		ResourceLimits: convertResources(spec.Resources),
+	}
+
+	if join := spec.Namespaces.Join; join != "" {
+		gen.NetNS = namespace{NSMode: "container", Value: join}
+		gen.IpcNS = &namespace{NSMode: "container", Value: join}
+
+		if spec.Namespaces.SharePID {
+			gen.PidNS = &namespace{NSMode: "container", Value: join}
+		}
+	} else if spec.Namespaces.Shareable {
+		gen.IpcNS = &namespace{NSMode: "shareable"}
+	}
+
+	var resp struct {
+		ID string `json:"Id"`
+	}
+
+	err := d.client.call(ctx, http.MethodPost, "/containers/create", nil, gen, &resp)
+	if err != nil {
+		return "", fmt.Errorf("failed to create container: %w", err)
+	}
+
+	return resp.ID, nil
+}
+
+func (d *PodmanDriver) StartContainer(ctx context.Context, id string) error {
+	return d.client.call(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil, nil)
+}
+
+// StopContainer sends the stop signal itself, as the stop endpoint only
+// sends the signal the container was created with.
+func (d *PodmanDriver) StopContainer(ctx context.Context, id string, opts driver.StopOptions) error {
+	signal := opts.Signal
+	if signal == "" {
+		signal = driver.DefaultStopSignal
+	}
+
+	err := d.kill(ctx, id, signal)
+	if isNotRunning(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	err = d.WaitForExit(waitCtx, id)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	err = d.kill(ctx, id, "SIGKILL")
+	if isNotRunning(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return d.WaitForExit(ctx, id)
+}
+
+func (d *PodmanDriver) kill(ctx context.Context, id, signal string) error {
+	return d.client.call(ctx, http.MethodPost, "/containers/"+id+"/kill", url.Values{
+		"signal": {signal},
+	}, nil, nil)
+}
+
+func (d *PodmanDriver) RemoveContainer(ctx context.Context, id string) error {
+	return d.client.call(ctx, http.MethodDelete, "/containers/"+id, url.Values{
+		"force": {"true"},
+	}, nil, nil)
+}
+
+func (d *PodmanDriver) WaitForExit(ctx context.Context, id string) error {
+	return d.client.call(ctx, http.MethodPost, "/containers/"+id+"/wait", url.Values{
+		"condition": {"exited", "stopped"},
+	}, nil, nil)
+}
+
+func (d *PodmanDriver) GetLogs(ctx context.Context, id string, opts driver.LogOptions) error {
+	query := url.Values{
+		"stdout":     {"true"},
+		"stderr":     {"true"},
+		"follow":     {strconv.FormatBool(opts.Follow)},
+		"timestamps": {strconv.FormatBool(opts.Timestamps)},
+	}
+
+	if !opts.Since.IsZero() {
+		query.Set("since", opts.Since.Format(time.RFC3339Nano))
+	}
+
+	if !opts.Until.IsZero() {
+		query.Set("until", opts.Until.Format(time.RFC3339Nano))
+	}
+
+	if opts.Tail >= 0 {
+		query.Set("tail", strconv.Itoa(opts.Tail))
+	}
+
+	resp, err := d.client.do(ctx, http.MethodGet, "/containers/"+id+"/logs", query, nil)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	// Podman multiplexes the output like Docker.
+	_, err = stdcopy.StdCopy(stdout, stderr, resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// execConfig is the body of the exec create endpoint.
+type execConfig struct {
+	Cmd          []string `json:"Cmd"`
+	AttachStdin  bool     `json:"AttachStdin"`
+	AttachStdout bool     `json:"AttachStdout"`
+	AttachStderr bool     `json:"AttachStderr"`
+	Tty          bool     `json:"Tty"`
+}
+
+type execInspect struct {
+	Running  bool `json:"Running"`
+	ExitCode int  `json:"ExitCode"`
+}
+
+func (d *PodmanDriver) Exec(ctx context.Context, id string, opts driver.ExecOptions) (int, error) {
+	var exec struct {
+		ID string `json:"Id"`
+	}
+
+	err := d.client.call(ctx, http.MethodPost, "/containers/"+id+"/exec", nil, execConfig{
+		Cmd:          opts.Command,
+		AttachStdin:  opts.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          opts.TTY,
+	}, &exec)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	conn, reader, err := d.client.hijack(ctx, "/exec/"+exec.ID+"/start", map[string]bool{
+		"Detach": false,
+		"Tty":    opts.TTY,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to start exec: %w", err)
+	}
+
+	defer conn.Close()
+
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	if opts.Stdin != nil {
+		go func() {
+			io.Copy(conn, opts.Stdin)
+			conn.CloseWrite()
+		}()
+	}
+
+	if opts.Resize != nil {
+		go func() {
+			for {
+				select {
+				case size := <-opts.Resize:
+					d.client.call(ctx, http.MethodPost, "/exec/"+exec.ID+"/resize", url.Values{
+						"h": {strconv.FormatUint(uint64(size.Height), 10)},
+						"w": {strconv.FormatUint(uint64(size.Width), 10)},
+					}, nil, nil)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	copied := make(chan error, 1)
+	go func() {
+		copied <- copyExecOutput(stdout, stderr, reader, opts.TTY)
+	}()
+
+	select {
+	case err := <-copied:
+		if err != nil {
+			return 0, err
+		}
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	return d.execExitCode(ctx, exec.ID)
+}
+
+func copyExecOutput(stdout, stderr io.Writer, reader *bufio.Reader, tty bool) error {
+	var err error
+	// The output of a terminal is not multiplexed.
+	if tty {
+		_, err = io.Copy(stdout, reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, reader)
+	}
+
+	return err
+}
+
+// execExitCode returns the exit code of an exec session, waiting for Podman
+// to record it once the output has been copied.
+func (d *PodmanDriver) execExitCode(ctx context.Context, id string) (int, error) {
+	for {
+		var inspect execInspect
+		err := d.client.call(ctx, http.MethodGet, "/exec/"+id+"/json", nil, nil, &inspect)
+		if err != nil {
+			return 0, fmt.Errorf("failed to inspect exec: %w", err)
+		}
+
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
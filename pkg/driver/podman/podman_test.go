@@ -0,0 +1,132 @@
+package podman
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/driver/drivertest"
+)
+
+// TestConformance runs against the local Podman service. It is skipped
+// unless SYSCTR_TEST_PODMAN is set.
+func TestConformance(t *testing.T) {
+	if os.Getenv("SYSCTR_TEST_PODMAN") == "" {
+		t.Skip("SYSCTR_TEST_PODMAN not set")
+	}
+
+	drivertest.Run(t, drivertest.Config{
+		New: func(t *testing.T) driver.Driver {
+			d := &PodmanDriver{Rootless: os.Getuid() != 0}
+			if err := d.Provision(context.Background()); err != nil {
+				t.Fatalf("Provision: %v", err)
+			}
+
+			return d
+		},
+		Image: "busybox:latest",
+	})
+}
+
+// newTestDriver returns a driver talking to handler over a unix socket.
+func newTestDriver(t *testing.T, handler http.Handler) *PodmanDriver {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "podman.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener = l
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	d := &PodmanDriver{Socket: socket}
+	if err := d.Provision(context.Background()); err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+
+	return d
+}
+
+func TestFindContainer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v4.0.0/libpod/_ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	mux.HandleFunc("GET /v4.0.0/libpod/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		var filters map[string][]string
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil {
+			t.Errorf("filters: %v", err)
+		}
+
+		if len(filters["label"]) != 1 || filters["label"][0] != "sh.tmacro.sysctr=true" {
+			t.Errorf("unexpected filters %v", filters)
+		}
+
+		// The name filter of Podman matches substrings.
+		json.NewEncoder(w).Encode([]listedContainer{
+			{ID: "1", Names: []string{"app-old"}},
+			{ID: "2", Names: []string{"app"}},
+		})
+	})
+
+	mux.HandleFunc("GET /v4.0.0/libpod/containers/{id}/json", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "2" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"message": "no such container", "response": 404})
+			return
+		}
+
+		w.Write([]byte(`{
+			"Id": "2",
+			"Name": "app",
+			"ImageName": "docker.io/library/busybox:latest",
+			"State": {"Status": "exited", "ExitCode": 3, "StartedAt": "2024-01-02T03:04:05Z"},
+			"Config": {"Labels": {"sh.tmacro.sysctr": "true"}, "Annotations": {"spec": "{}"}}
+		}`))
+	})
+
+	d := newTestDriver(t, mux)
+	ctx := context.Background()
+	labels := map[string]string{"sh.tmacro.sysctr": "true"}
+
+	status, err := d.FindContainer(ctx, "app", labels)
+	if err != nil {
+		t.Fatalf("FindContainer: %v", err)
+	}
+
+	if status.ID != "2" || status.Status != driver.Stopped || status.ExitCode != 3 || status.Annotations["spec"] != "{}" {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	if _, err := d.FindContainer(ctx, "other", labels); !errors.Is(err, driver.ErrContainerNotFound) {
+		t.Errorf("FindContainer: want ErrContainerNotFound, got %v", err)
+	}
+
+	_, err = d.ContainerStatus(ctx, "missing")
+	if !isNotFound(err) {
+		t.Errorf("ContainerStatus: want not found, got %v", err)
+	}
+}
+
+func TestConvertResources(t *testing.T) {
+	if convertResources(driver.Resources{}) != nil {
+		t.Errorf("want no limits")
+	}
+
+	limits := convertResources(driver.Resources{MemoryLimit: 1 << 30, PidsLimit: 64})
+	if limits.Memory == nil || limits.Memory.Limit != 1<<30 || limits.Pids == nil || limits.Pids.Limit != 64 || limits.CPU != nil {
+		t.Errorf("unexpected limits %+v", limits)
+	}
+}
@@ -0,0 +1,71 @@
+package podman
+
+import "github.com/tmacro/sysctr/pkg/driver"
+
+// resourceLimits is the subset of the OCI linux resources of the create
+// endpoint used by the driver.
+type resourceLimits struct {
+	CPU     *cpuLimits     `json:"cpu,omitempty"`
+	Memory  *memoryLimits  `json:"memory,omitempty"`
+	Pids    *pidsLimits    `json:"pids,omitempty"`
+	BlockIO *blockIOLimits `json:"blockIO,omitempty"`
+}
+
+type cpuLimits struct {
+	Shares uint64 `json:"shares,omitempty"`
+	Quota  int64  `json:"quota,omitempty"`
+	Period uint64 `json:"period,omitempty"`
+}
+
+type memoryLimits struct {
+	Limit       int64 `json:"limit,omitempty"`
+	Reservation int64 `json:"reservation,omitempty"`
+}
+
+type pidsLimits struct {
+	Limit int64 `json:"limit"`
+}
+
+type blockIOLimits struct {
+	Weight uint16 `json:"weight,omitempty"`
+}
+
+// convertResources returns the resource limits of the container, nil if
+// there are none.
+func convertResources(res driver.Resources) *resourceLimits {
+	limits := &resourceLimits{}
+	empty := true
+
+	if res.CPUShares > 0 || res.CPUQuota > 0 || res.CPUPeriod > 0 {
+		limits.CPU = &cpuLimits{
+			Shares: uint64(res.CPUShares),
+			Quota:  res.CPUQuota,
+			Period: uint64(res.CPUPeriod),
+		}
+		empty = false
+	}
+
+	if res.MemoryLimit > 0 || res.MemoryReservation > 0 {
+		limits.Memory = &memoryLimits{
+			Limit:       res.MemoryLimit,
+			Reservation: res.MemoryReservation,
+		}
+		empty = false
+	}
+
+	if res.PidsLimit > 0 {
+		limits.Pids = &pidsLimits{Limit: res.PidsLimit}
+		empty = false
+	}
+
+	if res.BlkioWeight > 0 {
+		limits.BlockIO = &blockIOLimits{Weight: res.BlkioWeight}
+		empty = false
+	}
+
+	if empty {
+		return nil
+	}
+
+	return limits
+}
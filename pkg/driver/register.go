@@ -4,10 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"reflect"
 	"sync"
+
+	"github.com/tmacro/sysctr/pkg/registry"
 )
 
 type DriverMap map[string]json.RawMessage
@@ -40,13 +41,26 @@ func RegisterDriver(drv Driver) {
 	drivers[mod.ID] = mod
 }
 
-func LoadDriver(ctx context.Context, id string, config json.RawMessage) (Driver, error) {
+// GetDriverInfo returns the registered driver with the given ID.
+func GetDriverInfo(id string) (DriverInfo, error) {
 	driverMu.RLock()
-	modInfo, ok := drivers[id]
-	driverMu.RUnlock()
+	defer driverMu.RUnlock()
 
+	modInfo, ok := drivers[id]
 	if !ok {
-		return nil, errors.New("driver not found: " + id)
+		return DriverInfo{}, fmt.Errorf("%w: %s", ErrDriverNotFound, id)
+	}
+
+	return modInfo, nil
+}
+
+// LoadDriver returns the provisioned driver with the given ID, decoding its
+// configuration from config. Drivers pulling images with registries are
+// given the configuration of the registries first.
+func LoadDriver(ctx context.Context, id string, config json.RawMessage, registries registry.Config) (Driver, error) {
+	modInfo, err := GetDriverInfo(id)
+	if err != nil {
+		return nil, err
 	}
 
 	drv := modInfo.New()
@@ -57,19 +71,23 @@ func LoadDriver(ctx context.Context, id string, config json.RawMessage) (Driver,
 
 	if len(config) > 0 {
 		if err := strictUnmarshal(config, &drv); err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
 		}
 	}
 
+	if r, ok := drv.(RegistryConfigurer); ok {
+		r.ConfigureRegistries(registries)
+	}
+
 	if p, ok := drv.(Provisioner); ok {
 		if err := p.Provision(ctx); err != nil {
 			if d, ok := drv.(Destructor); ok {
 				destErr := d.Destroy(ctx)
 				if destErr != nil {
-					return nil, fmt.Errorf("failed destroy after provisioning error: %v, provisioning error: %v", destErr, err)
+					return nil, fmt.Errorf("%w: failed destroy after provisioning error: %v, provisioning error: %v", ErrDriverUnavailable, destErr, err)
 				}
 			}
-			return nil, fmt.Errorf("failed provisioning: %v", err)
+			return nil, fmt.Errorf("%w: failed provisioning: %v", ErrDriverUnavailable, err)
 		}
 	}
 
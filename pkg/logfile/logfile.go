@@ -0,0 +1,262 @@
+// Package logfile implements the on-disk log format used by drivers that
+// capture container output themselves. Each line of output is stored as a
+// JSON object, compatible with Docker's json-file log driver.
+package logfile
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+
+	// maxLineSize is the largest chunk of output stored in a single entry.
+	// Longer lines are split over multiple entries.
+	maxLineSize = 16 * 1024
+
+	pollInterval = 250 * time.Millisecond
+)
+
+type Entry struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+// Writer appends entries to a log file. It is safe for concurrent use.
+type Writer struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// Create opens the log file at path for appending, creating it and its parent
+// directories if needed.
+func Create(path string) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (w *Writer) Write(stream string, p []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.enc.Encode(Entry{
+		Log:    string(p),
+		Stream: stream,
+		Time:   time.Now().UTC(),
+	})
+}
+
+// Copy stores every line read from r as an entry of the given stream until r
+// returns EOF.
+func (w *Writer) Copy(stream string, r io.Reader) error {
+	br := bufio.NewReaderSize(r, maxLineSize)
+	for {
+		line, err := br.ReadSlice('\n')
+		if len(line) > 0 {
+			if werr := w.Write(stream, line); werr != nil {
+				return werr
+			}
+		}
+
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.f.Close()
+}
+
+// ReadOptions selects the entries copied by Read. Nil writers discard the
+// stream.
+type ReadOptions struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	// Since and Until limit the output to entries written within the time
+	// range. Zero values leave the range open.
+	Since time.Time
+	Until time.Time
+	// Tail is the number of entries from the end of the file to copy, all
+	// of them when negative.
+	Tail int
+	// Timestamps prefixes each entry with the time it was written.
+	Timestamps bool
+	// Running reports whether entries may still be appended to the file.
+	// Read follows the file for as long as it reports true, or returns at
+	// the end of the file when it is nil.
+	Running func(ctx context.Context) (bool, error)
+}
+
+// Read writes the entries of the log file at path to the writers of opts
+// and returns once all selected output has been copied. A missing log file
+// is treated as empty.
+func Read(ctx context.Context, path string, opts ReadOptions) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	if opts.Stdout == nil {
+		opts.Stdout = io.Discard
+	}
+
+	if opts.Stderr == nil {
+		opts.Stderr = io.Discard
+	}
+
+	br := bufio.NewReader(f)
+	var partial []byte
+	drained := false
+
+	// Until the end of the file is first reached entries are buffered, so
+	// that only the last opts.Tail of them are copied.
+	tailing := opts.Tail >= 0
+	var tail []Entry
+
+	flushTail := func() error {
+		for _, entry := range tail {
+			if err := writeEntry(entry, opts); err != nil {
+				return err
+			}
+		}
+
+		tailing = false
+		tail = nil
+
+		return nil
+	}
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			partial = append(partial, line...)
+		}
+
+		if err == nil {
+			var entry Entry
+			if err := json.Unmarshal(partial, &entry); err != nil {
+				return err
+			}
+
+			partial = partial[:0]
+
+			if !opts.Since.IsZero() && entry.Time.Before(opts.Since) {
+				continue
+			}
+
+			// Entries are appended in order, none of the following
+			// ones are in range either.
+			if !opts.Until.IsZero() && entry.Time.After(opts.Until) {
+				return flushTail()
+			}
+
+			if tailing {
+				tail = append(tail, entry)
+				if len(tail) > opts.Tail {
+					copy(tail, tail[1:])
+					tail = tail[:opts.Tail]
+				}
+
+				continue
+			}
+
+			if err := writeEntry(entry, opts); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		if tailing {
+			if err := flushTail(); err != nil {
+				return err
+			}
+		}
+
+		if opts.Running == nil {
+			return nil
+		}
+
+		if !opts.Until.IsZero() && time.Now().After(opts.Until) {
+			return nil
+		}
+
+		ok, err := opts.Running(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			// The writer may still be flushing the last lines after the
+			// container exited, read once more before giving up.
+			if drained {
+				return nil
+			}
+
+			drained = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func writeEntry(entry Entry, opts ReadOptions) error {
+	w := opts.Stdout
+	if entry.Stream == Stderr {
+		w = opts.Stderr
+	}
+
+	if opts.Timestamps {
+		if _, err := io.WriteString(w, entry.Time.Format(time.RFC3339Nano)+" "); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, entry.Log)
+	return err
+}
@@ -0,0 +1,144 @@
+package logfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopyAndFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "test.log")
+
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := w.Copy(Stdout, strings.NewReader("one\ntwo\nno newline")); err != nil {
+		t.Fatalf("Copy stdout: %v", err)
+	}
+
+	if err := w.Copy(Stderr, strings.NewReader("oops\n")); err != nil {
+		t.Fatalf("Copy stderr: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	notRunning := func(context.Context) (bool, error) { return false, nil }
+
+	opts := ReadOptions{Stdout: &stdout, Stderr: &stderr, Tail: -1, Running: notRunning}
+	if err := Read(context.Background(), path, opts); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	if got, want := stdout.String(), "one\ntwo\nno newline"; got != want {
+		t.Errorf("stdout: want %q, got %q", want, got)
+	}
+
+	if got, want := stderr.String(), "oops\n"; got != want {
+		t.Errorf("stderr: want %q, got %q", want, got)
+	}
+}
+
+func TestCopySplitsLongLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	long := strings.Repeat("x", maxLineSize*2+10) + "\n"
+	if err := w.Copy(Stdout, strings.NewReader(long)); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+
+	w.Close()
+
+	var stdout bytes.Buffer
+	notRunning := func(context.Context) (bool, error) { return false, nil }
+
+	opts := ReadOptions{Stdout: &stdout, Stderr: &stdout, Tail: -1, Running: notRunning}
+	if err := Read(context.Background(), path, opts); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	if stdout.String() != long {
+		t.Errorf("output does not match input, got %d bytes want %d", stdout.Len(), len(long))
+	}
+}
+
+func TestReadMissingFile(t *testing.T) {
+	running := func(context.Context) (bool, error) { return true, nil }
+
+	opts := ReadOptions{Tail: -1, Running: running}
+	if err := Read(context.Background(), filepath.Join(t.TempDir(), "missing.log"), opts); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+}
+
+// writeEntries writes one stdout entry per second starting at start.
+func writeEntries(t *testing.T, path string, start time.Time, lines ...string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for i, line := range lines {
+		entry := Entry{Log: line + "\n", Stream: Stdout, Time: start.Add(time.Duration(i) * time.Second)}
+		if err := enc.Encode(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadSelect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	start := time.Date(2024, 8, 1, 10, 0, 0, 0, time.UTC)
+	writeEntries(t, path, start, "0", "1", "2", "3", "4")
+
+	tests := map[string]struct {
+		opts ReadOptions
+		want string
+	}{
+		"all":        {ReadOptions{Tail: -1}, "0\n1\n2\n3\n4\n"},
+		"tail":       {ReadOptions{Tail: 2}, "3\n4\n"},
+		"tail zero":  {ReadOptions{Tail: 0}, ""},
+		"tail large": {ReadOptions{Tail: 10}, "0\n1\n2\n3\n4\n"},
+		"since":      {ReadOptions{Tail: -1, Since: start.Add(3 * time.Second)}, "3\n4\n"},
+		"until":      {ReadOptions{Tail: -1, Until: start.Add(time.Second)}, "0\n1\n"},
+		"until tail": {ReadOptions{Tail: 1, Until: start.Add(2 * time.Second)}, "2\n"},
+		"timestamps": {
+			ReadOptions{Tail: 1, Timestamps: true},
+			"2024-08-01T10:00:04Z 4\n",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			tt.opts.Stdout = &stdout
+
+			if err := Read(context.Background(), path, tt.opts); err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// dockerConfig is the part of a Docker config.json holding credentials.
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+type dockerAuth struct {
+	// Auth is the base64 encoding of username:password.
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+	RegistryToken string `json:"registrytoken"`
+}
+
+// readDockerConfig returns the credentials of the registry at host from the
+// Docker config.json at path.
+func readDockerConfig(path, host string) (Credentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to read docker config: %w", err)
+	}
+
+	var config dockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Credentials{}, fmt.Errorf("failed to decode docker config %s: %w", path, err)
+	}
+
+	for key, auth := range config.Auths {
+		if dockerConfigHost(key) != host {
+			continue
+		}
+
+		creds := Credentials{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			IdentityToken: auth.IdentityToken,
+			RegistryToken: auth.RegistryToken,
+		}
+
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return Credentials{}, fmt.Errorf("invalid auth of registry %s in %s: %w", host, path, err)
+			}
+
+			var ok bool
+			creds.Username, creds.Password, ok = strings.Cut(string(decoded), ":")
+			if !ok {
+				return Credentials{}, fmt.Errorf("invalid auth of registry %s in %s", host, path)
+			}
+		}
+
+		return creds, nil
+	}
+
+	return Credentials{}, fmt.Errorf("no credentials of registry %s in %s", host, path)
+}
+
+// dockerConfigHost returns the host of a key of the auths of a Docker
+// config, which may be a URL such as https://index.docker.io/v1/.
+func dockerConfigHost(key string) string {
+	key = strings.TrimPrefix(key, "https://")
+	key = strings.TrimPrefix(key, "http://")
+	key, _, _ = strings.Cut(key, "/")
+
+	switch key {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+
+	return key
+}
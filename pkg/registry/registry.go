@@ -0,0 +1,138 @@
+// Package registry holds the configuration of the image registries drivers
+// pull from, such as their credentials and certificate authorities.
+package registry
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/distribution/reference"
+	registrytypes "github.com/docker/docker/api/types/registry"
+)
+
+// Config holds the configuration of registries by host, as it appears in
+// image references, such as registry.example.com:5000. Docker Hub is
+// docker.io.
+type Config map[string]Registry
+
+// Registry is the configuration of a registry. Credentials are given by
+// either Username and Password, TokenFile or DockerConfig.
+type Registry struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// TokenFile holds a bearer token sent to the registry. It is read on
+	// every pull, so that the token may be rotated.
+	TokenFile string `json:"token_file"`
+	// DockerConfig is a Docker config.json holding the credentials of the
+	// registry, such as written by docker login. Credential helpers are not
+	// supported.
+	DockerConfig string `json:"docker_config"`
+	// CAFile is a PEM file of certificate authorities trusted in addition
+	// to those of the system.
+	CAFile string `json:"ca_file"`
+	// Insecure skips the verification of the certificate of the registry
+	// and falls back to plain HTTP.
+	Insecure bool `json:"insecure"`
+}
+
+// Credentials authenticate with a registry. They are empty for anonymous
+// pulls.
+type Credentials struct {
+	Username string
+	Password string
+	// IdentityToken is a refresh token exchanged for bearer tokens.
+	IdentityToken string
+	// RegistryToken is a bearer token sent as is.
+	RegistryToken string
+}
+
+// Validate returns an error if a registry sets more than one source of
+// credentials.
+func (c Config) Validate() error {
+	for host, r := range c {
+		sources := 0
+		for _, set := range []bool{r.Username != "" || r.Password != "", r.TokenFile != "", r.DockerConfig != ""} {
+			if set {
+				sources++
+			}
+		}
+
+		if sources > 1 {
+			return fmt.Errorf("registry %s: only one of username and password, token_file or docker_config may be set", host)
+		}
+
+		if r.Password != "" && r.Username == "" {
+			return fmt.Errorf("registry %s: password requires a username", host)
+		}
+	}
+
+	return nil
+}
+
+// Host returns the host of the registry image is pulled from.
+func Host(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+
+	return reference.Domain(named), nil
+}
+
+// Credentials returns the credentials of the registry at host.
+func (c Config) Credentials(host string) (Credentials, error) {
+	r := c[host]
+
+	switch {
+	case r.TokenFile != "":
+		data, err := os.ReadFile(r.TokenFile)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("failed to read token of registry %s: %w", host, err)
+		}
+
+		return Credentials{RegistryToken: strings.TrimSpace(string(data))}, nil
+	case r.DockerConfig != "":
+		return readDockerConfig(r.DockerConfig, host)
+	}
+
+	return Credentials{Username: r.Username, Password: r.Password}, nil
+}
+
+// EncodeAuth returns the credentials of the registry image is pulled from
+// in the form of the X-Registry-Auth header of the Docker and Podman APIs,
+// empty for anonymous pulls.
+func (c Config) EncodeAuth(image string) (string, error) {
+	host, err := Host(image)
+	if err != nil {
+		return "", err
+	}
+
+	creds, err := c.Credentials(host)
+	if err != nil {
+		return "", err
+	}
+
+	if creds == (Credentials{}) {
+		return "", nil
+	}
+
+	return registrytypes.EncodeAuthConfig(registrytypes.AuthConfig{
+		Username:      creds.Username,
+		Password:      creds.Password,
+		IdentityToken: creds.IdentityToken,
+		RegistryToken: creds.RegistryToken,
+		ServerAddress: host,
+	})
+}
+
+// Insecure reports whether the certificate of the registry image is pulled
+// from is not verified.
+func (c Config) Insecure(image string) bool {
+	host, err := Host(image)
+	if err != nil {
+		return false
+	}
+
+	return c[host].Insecure
+}
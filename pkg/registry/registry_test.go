@@ -0,0 +1,167 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	registrytypes "github.com/docker/docker/api/types/registry"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"empty", nil, false},
+		{"password", Config{"r.example.com": {Username: "u", Password: "p"}}, false},
+		{"token file", Config{"r.example.com": {TokenFile: "/token", CAFile: "/ca.pem"}}, false},
+		{"password without username", Config{"r.example.com": {Password: "p"}}, true},
+		{"two sources", Config{"r.example.com": {Username: "u", DockerConfig: "/config.json"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate: want error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	dockerConfig := writeFile(t, "config.json", `{
+		"auths": {
+			"https://index.docker.io/v1/": {"auth": "`+base64.StdEncoding.EncodeToString([]byte("hub:secret"))+`"},
+			"r.example.com": {"identitytoken": "refresh"}
+		}
+	}`)
+
+	config := Config{
+		"r.example.com":    {DockerConfig: dockerConfig},
+		"docker.io":        {DockerConfig: dockerConfig},
+		"q.example.com":    {DockerConfig: dockerConfig},
+		"t.example.com":    {TokenFile: writeFile(t, "token", "bearer\n")},
+		"p.example.com":    {Username: "user", Password: "pass"},
+		"anon.example.com": {Insecure: true},
+	}
+
+	tests := []struct {
+		host    string
+		want    Credentials
+		wantErr bool
+	}{
+		{"docker.io", Credentials{Username: "hub", Password: "secret"}, false},
+		{"r.example.com", Credentials{IdentityToken: "refresh"}, false},
+		{"q.example.com", Credentials{}, true},
+		{"t.example.com", Credentials{RegistryToken: "bearer"}, false},
+		{"p.example.com", Credentials{Username: "user", Password: "pass"}, false},
+		{"anon.example.com", Credentials{}, false},
+		{"unknown.example.com", Credentials{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			got, err := config.Credentials(tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Credentials: want error %v, got %v", tt.wantErr, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Credentials: want %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEncodeAuth(t *testing.T) {
+	config := Config{"r.example.com": {Username: "user", Password: "pass"}}
+
+	auth, err := config.EncodeAuth("busybox:latest")
+	if err != nil || auth != "" {
+		t.Errorf("anonymous: want no auth, got %q, %v", auth, err)
+	}
+
+	auth, err = config.EncodeAuth("r.example.com/team/app:1.0")
+	if err != nil {
+		t.Fatalf("EncodeAuth: %v", err)
+	}
+
+	data, err := base64.URLEncoding.DecodeString(auth)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	var decoded registrytypes.AuthConfig
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if decoded.Username != "user" || decoded.Password != "pass" || decoded.ServerAddress != "r.example.com" {
+		t.Errorf("unexpected auth %+v", decoded)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	const digest = "sha256:2d0f4b2f8b7e0e1f3d6b6d7b1c4f9a8e5c3b2a1d0e9f8a7b6c5d4e3f2a1b0c9d"
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "user" || pass != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path != "/v2/team/app/manifests/1.0" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Header().Set("Content-Length", "2")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	ca := writeFile(t, "ca.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})))
+	host := strings.TrimPrefix(srv.URL, "https://")
+	ref := host + "/team/app:1.0"
+
+	anonymous := Config{host: {CAFile: ca}}
+	if _, _, err := anonymous.Resolver().Resolve(context.Background(), ref); err == nil {
+		t.Error("Resolve without credentials: expected an error")
+	}
+
+	config := Config{host: {Username: "user", Password: "pass", CAFile: ca}}
+
+	_, desc, err := config.Resolver().Resolve(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	if desc.Digest.String() != digest {
+		t.Errorf("digest: want %s, got %s", digest, desc.Digest)
+	}
+}
@@ -0,0 +1,102 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+)
+
+// Resolver returns a resolver of images for containerd's remotes package,
+// authenticating with the registries of c.
+func (c Config) Resolver() remotes.Resolver {
+	return docker.NewResolver(docker.ResolverOptions{
+		Hosts: c.registryHosts,
+	})
+}
+
+// registryHosts returns how to reach the registry at host, which is called
+// for every image resolved.
+func (c Config) registryHosts(host string) ([]docker.RegistryHost, error) {
+	r := c[host]
+
+	// Like Docker, registries on localhost may be served over plain HTTP.
+	local, _ := docker.MatchLocalhost(host)
+
+	client, err := r.httpClient(r.Insecure || local)
+	if err != nil {
+		return nil, fmt.Errorf("registry %s: %w", host, err)
+	}
+
+	rh := docker.RegistryHost{
+		Client:       client,
+		Host:         host,
+		Scheme:       "https",
+		Path:         "/v2",
+		Capabilities: docker.HostCapabilityPull | docker.HostCapabilityResolve,
+	}
+
+	if host == "docker.io" {
+		rh.Host = "registry-1.docker.io"
+	}
+
+	creds, err := c.Credentials(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if creds.RegistryToken != "" {
+		rh.Header = http.Header{"Authorization": {"Bearer " + creds.RegistryToken}}
+		return []docker.RegistryHost{rh}, nil
+	}
+
+	rh.Authorizer = docker.NewDockerAuthorizer(
+		docker.WithAuthClient(client),
+		docker.WithAuthCreds(func(string) (string, string, error) {
+			if creds.IdentityToken != "" {
+				return "", creds.IdentityToken, nil
+			}
+
+			return creds.Username, creds.Password, nil
+		}),
+	)
+
+	return []docker.RegistryHost{rh}, nil
+}
+
+// httpClient returns the client connecting to the registry, falling back to
+// plain HTTP if the registry does not serve HTTPS when fallback is set.
+func (r Registry) httpClient(fallback bool) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: r.Insecure}
+
+	if r.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := os.ReadFile(r.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates in %s", r.CAFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	if fallback {
+		return &http.Client{Transport: docker.NewHTTPFallback(transport)}, nil
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,178 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/rs/zerolog"
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+// Action is what Apply or Update did to a container.
+type Action string
+
+const (
+	ActionCreated   Action = "created"
+	ActionRecreated Action = "recreated"
+	ActionUnchanged Action = "unchanged"
+	ActionRemoved   Action = "removed"
+	ActionFailed    Action = "failed"
+	// ActionUpdated and ActionRolledBack are only reported by Update.
+	ActionUpdated    Action = "updated"
+	ActionRolledBack Action = "rolled back"
+)
+
+// ApplyResult is the outcome of Apply for a single container.
+type ApplyResult struct {
+	Name   string `json:"name"`
+	ID     string `json:"id,omitempty"`
+	Action Action `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ApplyOptions struct {
+	// NoPrune keeps containers managed by sysctr that are not in the
+	// desired set instead of removing them.
+	NoPrune bool
+	// AllowEmpty applies an empty set of specs, removing every container
+	// managed by sysctr. Otherwise Apply returns ErrNoSpecs unless NoPrune
+	// is set.
+	AllowEmpty bool
+	// StateDir is where secrets mounted as files are stored.
+	StateDir string
+}
+
+// Apply converges the containers managed by sysctr to specs. Containers
+// missing or drifted from their spec are (re)created and started, and
+// containers without a spec are removed. A failure to converge one container
+// does not stop the others; the results report every container and the
+// returned error joins the failures.
+func Apply(ctx context.Context, drv driver.Driver, specs []*types.Spec, opts ApplyOptions) ([]ApplyResult, error) {
+	logger := zerolog.Ctx(ctx)
+
+	// Specs read from the wrong directory must not remove every container.
+	if len(specs) == 0 && !opts.NoPrune && !opts.AllowEmpty {
+		return nil, ErrNoSpecs
+	}
+
+	desired := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		if desired[spec.Name] {
+			return nil, &types.SpecError{Field: "name", Err: fmt.Errorf("duplicate container name %q", spec.Name)}
+		}
+
+		desired[spec.Name] = true
+	}
+
+	for _, spec := range specs {
+		for i := range spec.Sidecars {
+			if name := sidecarName(spec, &spec.Sidecars[i]); desired[name] {
+				return nil, &types.SpecError{Field: "name", Err: fmt.Errorf("container name %q is used by a sidecar of %s", name, spec.Name)}
+			}
+		}
+	}
+
+	// Invalid specs are rejected before any container is touched.
+	for _, spec := range specs {
+		if err := validateSpec(drv, spec); err != nil {
+			return nil, fmt.Errorf("%s: %w", spec.Name, err)
+		}
+	}
+
+	existing, err := drv.ListContainers(ctx, map[string]string{
+		LabelSysCtr: "true",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	results := []ApplyResult{}
+	var errs []error
+
+	for _, spec := range specs {
+		specLogger := logger.With().Str("name", spec.Name).Logger()
+
+		id, action, err := applySpec(specLogger.WithContext(ctx), drv, spec, opts.StateDir)
+		if err != nil {
+			specLogger.Error().Err(err).Msg("failed to apply spec")
+			results = append(results, ApplyResult{Name: spec.Name, Action: ActionFailed, Error: err.Error()})
+			errs = append(errs, fmt.Errorf("%s: %w", spec.Name, err))
+			continue
+		}
+
+		results = append(results, ApplyResult{Name: spec.Name, ID: id, Action: action})
+	}
+
+	if opts.NoPrune {
+		return results, errors.Join(errs...)
+	}
+
+	// Sidecars are removed before the containers whose namespaces they
+	// joined.
+	sort.SliceStable(existing, func(i, j int) bool {
+		return existing[i].Labels[LabelPod] != "" && existing[j].Labels[LabelPod] == ""
+	})
+
+	for _, container := range existing {
+		name := container.Labels[LabelName]
+		if desired[name] || desired[container.Labels[LabelPod]] {
+			continue
+		}
+
+		if name == "" {
+			name = container.Name
+		}
+
+		logger.Info().Str("name", name).Str("id", container.ID).Msg("removing container without spec")
+
+		err := removeContainer(ctx, drv, &container)
+		if err != nil {
+			logger.Error().Err(err).Str("name", name).Msg("failed to remove container")
+			results = append(results, ApplyResult{Name: name, ID: container.ID, Action: ActionFailed, Error: err.Error()})
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+
+		if err := removeSecrets(opts.StateDir, container.Labels[LabelName]); err != nil {
+			logger.Warn().Err(err).Str("name", name).Msg("failed to remove secrets")
+		}
+
+		results = append(results, ApplyResult{Name: name, ID: container.ID, Action: ActionRemoved})
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// applySpec converges the container of spec, holding its lock so that a Run
+// supervising it follows the container it is replaced with.
+func applySpec(ctx context.Context, drv driver.Driver, spec *types.Spec, stateDir string) (string, Action, error) {
+	unlock, err := lockContainer(ctx, stateDir, spec.Name)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to lock container: %w", err)
+	}
+
+	defer unlock()
+
+	return run(ctx, drv, spec, stateDir, nil)
+}
+
+// removeContainer stops and removes a container whose spec is unknown, using
+// the default stop signal and timeout.
+func removeContainer(ctx context.Context, drv driver.Driver, container *driver.Status) error {
+	if container.Status == driver.Running {
+		err := drv.StopContainer(ctx, container.ID, stopOptions(&types.Spec{}, 0))
+		if err != nil {
+			return fmt.Errorf("failed to stop container: %w", err)
+		}
+	}
+
+	err := drv.RemoveContainer(ctx, container.ID)
+	if err != nil {
+		return fmt.Errorf("failed to remove container: %w", err)
+	}
+
+	return nil
+}
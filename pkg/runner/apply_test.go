@@ -0,0 +1,206 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+func namedSpec(name, script string) *types.Spec {
+	spec := newSpec(script)
+	spec.Name = name
+	return spec
+}
+
+func resultsByName(results []ApplyResult) map[string]ApplyResult {
+	byName := make(map[string]ApplyResult, len(results))
+	for _, r := range results {
+		byName[r.Name] = r
+	}
+	return byName
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+
+	unchanged := namedSpec("unchanged", "sleep 3600")
+	drifted := namedSpec("drifted", "sleep 3600")
+	removed := namedSpec("removed", "sleep 3600")
+	created := namedSpec("created", "sleep 3600")
+
+	drv := newDriver(t, unchanged)
+	unchangedID := startContainer(t, drv, unchanged, mustHashSpec(t, drv, unchanged))
+	driftedID := startContainer(t, drv, drifted, mustHashSpec(t, drv, drifted))
+	startContainer(t, drv, removed, mustHashSpec(t, drv, removed))
+
+	// Not managed by sysctr.
+	if _, err := drv.CreateContainer(ctx, &driver.Spec{Name: "other", Image: unchanged.Image}); err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+
+	drifted.Env = []types.EnvVar{{Name: "FOO", Value: "bar"}}
+
+	results, err := Apply(ctx, drv, []*types.Spec{unchanged, drifted, created}, ApplyOptions{})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	if len(results) != 4 {
+		t.Fatalf("want 4 results, got %+v", results)
+	}
+
+	byName := resultsByName(results)
+
+	want := map[string]Action{
+		unchanged.Name: ActionUnchanged,
+		drifted.Name:   ActionRecreated,
+		created.Name:   ActionCreated,
+		removed.Name:   ActionRemoved,
+	}
+
+	for name, action := range want {
+		if byName[name].Action != action {
+			t.Errorf("%s: want %s, got %+v", name, action, byName[name])
+		}
+	}
+
+	if byName[unchanged.Name].ID != unchangedID {
+		t.Errorf("unchanged: want ID %s, got %s", unchangedID, byName[unchanged.Name].ID)
+	}
+
+	if byName[drifted.Name].ID == driftedID {
+		t.Errorf("drifted: container was not recreated")
+	}
+
+	if _, err := drv.FindContainer(ctx, removed.Name, labelsFor(removed)); !errors.Is(err, driver.ErrContainerNotFound) {
+		t.Errorf("removed: want ErrContainerNotFound, got %v", err)
+	}
+
+	for _, spec := range []*types.Spec{unchanged, drifted, created} {
+		status, err := drv.ContainerStatus(ctx, byName[spec.Name].ID)
+		if err != nil {
+			t.Fatalf("%s: ContainerStatus: %v", spec.Name, err)
+		}
+
+		if status.Status != driver.Running {
+			t.Errorf("%s: want running, got %s", spec.Name, status.Status)
+		}
+	}
+
+	if _, err := drv.FindContainer(ctx, "other", nil); err != nil {
+		t.Errorf("unmanaged container was removed: %v", err)
+	}
+
+	// A second apply has nothing to do.
+	results, err = Apply(ctx, drv, []*types.Spec{unchanged, drifted, created}, ApplyOptions{})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	for _, r := range results {
+		if r.Action != ActionUnchanged {
+			t.Errorf("%s: want %s, got %s", r.Name, ActionUnchanged, r.Action)
+		}
+	}
+}
+
+func TestApplyNoPrune(t *testing.T) {
+	ctx := context.Background()
+
+	kept := namedSpec("kept", "sleep 3600")
+	drv := newDriver(t, kept)
+	id := startContainer(t, drv, kept, mustHashSpec(t, drv, kept))
+
+	results, err := Apply(ctx, drv, nil, ApplyOptions{NoPrune: true})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	if len(results) != 0 {
+		t.Errorf("want no results, got %+v", results)
+	}
+
+	if _, err := drv.ContainerStatus(ctx, id); err != nil {
+		t.Errorf("container was removed: %v", err)
+	}
+}
+
+func TestApplyInvalidSpec(t *testing.T) {
+	ctx := context.Background()
+
+	kept := namedSpec("kept", "sleep 3600")
+	drv := newDriver(t, kept)
+	id := startContainer(t, drv, kept, mustHashSpec(t, drv, kept))
+
+	tests := map[string][]*types.Spec{
+		"duplicate name": {namedSpec("dup", "true"), namedSpec("dup", "true")},
+		"invalid spec": {
+			func() *types.Spec {
+				spec := namedSpec("invalid", "true")
+				spec.Healthcheck = &types.Healthcheck{}
+				return spec
+			}(),
+		},
+	}
+
+	for name, specs := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Apply(ctx, drv, specs, ApplyOptions{})
+
+			var specErr *types.SpecError
+			if !errors.As(err, &specErr) {
+				t.Fatalf("want SpecError, got %v", err)
+			}
+
+			// Nothing is changed when a spec is invalid.
+			if _, err := drv.ContainerStatus(ctx, id); err != nil {
+				t.Errorf("container was removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestApplyEmpty(t *testing.T) {
+	ctx := context.Background()
+
+	kept := namedSpec("kept", "sleep 3600")
+	drv := newDriver(t, kept)
+	id := startContainer(t, drv, kept, mustHashSpec(t, drv, kept))
+
+	if _, err := Apply(ctx, drv, nil, ApplyOptions{}); !errors.Is(err, ErrNoSpecs) {
+		t.Fatalf("want ErrNoSpecs, got %v", err)
+	}
+
+	if _, err := drv.ContainerStatus(ctx, id); err != nil {
+		t.Fatalf("container was removed: %v", err)
+	}
+
+	results, err := Apply(ctx, drv, nil, ApplyOptions{AllowEmpty: true})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	if len(results) != 1 || results[0].Action != ActionRemoved {
+		t.Errorf("want the container removed, got %+v", results)
+	}
+}
+
+func TestApplyFailure(t *testing.T) {
+	ctx := context.Background()
+
+	spec := namedSpec("failing", "sleep 3600")
+	drv := newDriver(t, spec)
+	drv.FailOn("CreateContainer", errors.New("boom"))
+
+	results, err := Apply(ctx, drv, []*types.Spec{spec}, ApplyOptions{})
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	if len(results) != 1 || results[0].Action != ActionFailed || results[0].Error == "" {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
@@ -0,0 +1,37 @@
+package runner
+
+import (
+	"errors"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+var (
+	// ErrContainerNotFound is returned when no container has been created
+	// from the spec.
+	ErrContainerNotFound = driver.ErrContainerNotFound
+
+	// ErrImageNotFound is returned when the image of the spec is not
+	// present and its pull policy forbids pulling it.
+	ErrImageNotFound = driver.ErrImageNotFound
+
+	// ErrImageDigestMismatch is returned when the image of the spec is not
+	// the image it is pinned to.
+	ErrImageDigestMismatch = errors.New("image does not match pinned digest")
+
+	// ErrSpecDrifted is returned when the container was created from a
+	// different version of the spec.
+	ErrSpecDrifted = errors.New("container does not match spec")
+
+	// ErrUnhealthy is returned by Run when the container became unhealthy
+	// and its healthcheck asks to exit.
+	ErrUnhealthy = errors.New("container is unhealthy")
+
+	// ErrNoSpecs is returned by Apply when given no specs, which would
+	// remove every container managed by sysctr.
+	ErrNoSpecs = errors.New("no specs to apply")
+
+	// ErrRolledBack is returned by Update when the updated container failed
+	// its first health window and was recreated from the previous image.
+	ErrRolledBack = errors.New("update rolled back")
+)
@@ -0,0 +1,28 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+// Exec runs a command in the running container of spec and returns its exit
+// code.
+func Exec(ctx context.Context, drv driver.Driver, spec *types.Spec, opts driver.ExecOptions) (int, error) {
+	status, err := drv.FindContainer(ctx, spec.Name, map[string]string{
+		LabelSysCtr: "true",
+		LabelName:   spec.Name,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	if status.Status != driver.Running {
+		return 0, fmt.Errorf("container %s is not running", spec.Name)
+	}
+
+	return drv.Exec(ctx, status.ID, opts)
+}
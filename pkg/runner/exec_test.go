@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+func TestExec(t *testing.T) {
+	ctx := context.Background()
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+
+	opts := driver.ExecOptions{Command: []string{"true"}}
+	if _, err := Exec(ctx, drv, spec, opts); !errors.Is(err, ErrContainerNotFound) {
+		t.Fatalf("no container: want ErrContainerNotFound, got %v", err)
+	}
+
+	startContainer(t, drv, spec, mustHashSpec(t, drv, spec))
+
+	var stdout bytes.Buffer
+	code, err := Exec(ctx, drv, spec, driver.ExecOptions{
+		Command: []string{"cat"},
+		Stdin:   strings.NewReader("hello\n"),
+		Stdout:  &stdout,
+	})
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	if code != 0 || stdout.String() != "hello\n" {
+		t.Errorf("want exit code 0 and %q, got %d and %q", "hello\n", code, stdout.String())
+	}
+
+	code, err = Exec(ctx, drv, spec, driver.ExecOptions{Command: []string{"/bin/sh", "-c", "exit 5"}})
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	if code != 5 {
+		t.Errorf("exit code: want 5, got %d", code)
+	}
+}
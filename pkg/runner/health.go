@@ -0,0 +1,352 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+const (
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 5 * time.Second
+	defaultHealthRetries  = 3
+	// defaultProbeHost is where HTTP and TCP probes connect to. Probes are
+	// made from the host, not from the network namespace of the container.
+	defaultProbeHost = "127.0.0.1"
+
+	// maxProbeOutput bounds the probe output kept in the health state.
+	maxProbeOutput = 4096
+)
+
+// probe checks the health of a container once. It returns the output of the
+// probe and an error if the container is unhealthy.
+type probe func(ctx context.Context, containerID string) (string, error)
+
+// healthMonitor runs the probes of a container's healthcheck. Probes are
+// evaluated by sysctr itself, so they behave the same on every driver.
+type healthMonitor struct {
+	probe       probe
+	interval    time.Duration
+	timeout     time.Duration
+	startPeriod time.Duration
+	retries     int
+	onFailure   types.HealthcheckOnFailure
+
+	// onChange is called with the health of the container after every
+	// probe.
+	onChange func(health types.Health)
+}
+
+// errUnhealthy is returned by healthMonitor.run when the container became
+// unhealthy and the healthcheck asks for more than logging it.
+type errUnhealthy struct {
+	action types.HealthcheckOnFailure
+	health types.Health
+}
+
+func (e *errUnhealthy) Error() string {
+	return "container is unhealthy"
+}
+
+// newHealthMonitor returns the monitor of the healthcheck, nil if there is
+// none.
+func newHealthMonitor(drv driver.Driver, hc *types.Healthcheck) (*healthMonitor, error) {
+	if hc == nil {
+		return nil, nil
+	}
+
+	p, err := newProbe(drv, hc)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &healthMonitor{
+		probe:       p,
+		interval:    defaultHealthInterval,
+		timeout:     defaultHealthTimeout,
+		startPeriod: time.Duration(hc.StartPeriod) * time.Second,
+		retries:     defaultHealthRetries,
+		onFailure:   hc.OnFailure,
+		onChange:    func(types.Health) {},
+	}
+
+	if hc.Interval > 0 {
+		m.interval = time.Duration(hc.Interval) * time.Second
+	}
+
+	if hc.Timeout > 0 {
+		m.timeout = time.Duration(hc.Timeout) * time.Second
+	}
+
+	if hc.Retries > 0 {
+		m.retries = hc.Retries
+	}
+
+	if m.onFailure == "" {
+		m.onFailure = types.HealthcheckOnFailureLog
+	}
+
+	return m, nil
+}
+
+func newProbe(drv driver.Driver, hc *types.Healthcheck) (probe, error) {
+	var probes []probe
+
+	if hc.Exec != nil {
+		probes = append(probes, execProbe(drv, hc.Exec))
+	}
+
+	if hc.Http != nil {
+		probes = append(probes, httpProbe(hc.Http))
+	}
+
+	if hc.Tcp != nil {
+		probes = append(probes, tcpProbe(hc.Tcp))
+	}
+
+	if len(probes) != 1 {
+		return nil, &types.SpecError{
+			Field: "healthcheck",
+			Err:   errors.New("exactly one of exec, http and tcp must be set"),
+		}
+	}
+
+	return probes[0], nil
+}
+
+// validateProbeNetwork rejects HTTP and TCP probes that can never reach the
+// container from the host: containers without a network, and ports of
+// containers in bridge mode that are not published on the loopback address
+// the probes default to.
+func validateProbeNetwork(spec *types.Spec) error {
+	hc := spec.Healthcheck
+	if hc == nil {
+		return nil
+	}
+
+	var field, host string
+	var port int
+
+	switch {
+	case hc.Http != nil:
+		field, host, port = "healthcheck.http", hc.Http.Host, hc.Http.Port
+	case hc.Tcp != nil:
+		field, host, port = "healthcheck.tcp", hc.Tcp.Host, hc.Tcp.Port
+	default:
+		return nil
+	}
+
+	mode := types.NetworkModeHost
+	if spec.Network != nil && spec.Network.Mode != "" {
+		mode = spec.Network.Mode
+	}
+
+	switch mode {
+	case types.NetworkModeNone:
+		return &types.SpecError{
+			Field: field,
+			Err:   fmt.Errorf("probes are made from the host and can not reach a container in %s network mode, use an exec probe", mode),
+		}
+	case types.NetworkModeBridge:
+		// Other hosts, such as the address of the container, are left to
+		// the spec.
+		if host != "" && host != defaultProbeHost && host != "localhost" {
+			return nil
+		}
+
+		for _, p := range spec.Network.Ports {
+			hostPort := p.ContainerPort
+			if p.HostPort != nil {
+				hostPort = *p.HostPort
+			}
+
+			hostIP := ""
+			if p.HostIp != nil {
+				hostIP = *p.HostIp
+			}
+
+			tcp := p.Protocol == "" || p.Protocol == types.PortMappingProtocolTcp
+			loopback := hostIP == "" || hostIP == "0.0.0.0" || hostIP == defaultProbeHost
+
+			if tcp && loopback && hostPort == port {
+				return nil
+			}
+		}
+
+		return &types.SpecError{
+			Field: field + ".port",
+			Err:   fmt.Errorf("probes are made from the host, port %d must be published in %s network mode", port, mode),
+		}
+	}
+
+	return nil
+}
+
+func execProbe(drv driver.Driver, p *types.ExecProbe) probe {
+	return func(ctx context.Context, containerID string) (string, error) {
+		var output bytes.Buffer
+		code, err := drv.Exec(ctx, containerID, driver.ExecOptions{
+			Command: p.Command,
+			Stdout:  &output,
+			Stderr:  &output,
+		})
+		if err != nil {
+			return output.String(), err
+		}
+
+		if code != 0 {
+			return output.String(), fmt.Errorf("exited with code %d", code)
+		}
+
+		return output.String(), nil
+	}
+}
+
+func httpProbe(p *types.HttpProbe) probe {
+	host := p.Host
+	if host == "" {
+		host = defaultProbeHost
+	}
+
+	scheme := p.Scheme
+	if scheme == "" {
+		scheme = types.HttpProbeSchemeHttp
+	}
+
+	url := string(scheme) + "://" + net.JoinHostPort(host, strconv.Itoa(p.Port)) + p.Path
+
+	client := &http.Client{
+		// A redirect is a healthy response, there is no need to follow it.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return func(ctx context.Context, containerID string) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return "", err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return resp.Status, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+
+		return resp.Status, nil
+	}
+}
+
+func tcpProbe(p *types.TcpProbe) probe {
+	host := p.Host
+	if host == "" {
+		host = defaultProbeHost
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(p.Port))
+
+	return func(ctx context.Context, containerID string) (string, error) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return "", err
+		}
+
+		conn.Close()
+		return "", nil
+	}
+}
+
+// run probes the container until ctx is cancelled. It returns errUnhealthy
+// when the container became unhealthy and the action on failure is to
+// restart or exit.
+func (m *healthMonitor) run(ctx context.Context, containerID string) error {
+	logger := zerolog.Ctx(ctx)
+
+	health := types.Health{Status: types.HealthStatusStarting}
+	m.onChange(health)
+
+	started := time.Now()
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, m.timeout)
+		output, err := m.probe(probeCtx, containerID)
+		cancel()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		now := time.Now()
+		health.LastChecked = &now
+
+		if err != nil {
+			output = err.Error() + "\n" + output
+		}
+
+		if len(output) > maxProbeOutput {
+			output = output[:maxProbeOutput]
+		}
+
+		health.LastOutput = &output
+
+		previous := health.Status
+
+		switch {
+		case err == nil:
+			health.Status = types.HealthStatusHealthy
+			health.FailingStreak = 0
+		case health.Status == types.HealthStatusStarting && now.Sub(started) < m.startPeriod:
+			// Failures during the start period are not counted.
+		default:
+			health.FailingStreak++
+			if health.FailingStreak >= m.retries {
+				health.Status = types.HealthStatusUnhealthy
+			}
+		}
+
+		m.onChange(health)
+
+		if health.Status == previous {
+			continue
+		}
+
+		if health.Status == types.HealthStatusHealthy {
+			logger.Info().Str("id", containerID).Msg("container is healthy")
+			continue
+		}
+
+		if health.Status != types.HealthStatusUnhealthy {
+			continue
+		}
+
+		logger.Warn().Str("id", containerID).Int("failing_streak", health.FailingStreak).Err(err).Msg("container is unhealthy")
+
+		if m.onFailure != types.HealthcheckOnFailureLog {
+			return &errUnhealthy{action: m.onFailure, health: health}
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+// scriptedProbe fails the probes at the given indexes.
+func scriptedProbe(failures ...int) probe {
+	var calls atomic.Int32
+	failing := make(map[int]bool, len(failures))
+	for _, i := range failures {
+		failing[i] = true
+	}
+
+	return func(ctx context.Context, containerID string) (string, error) {
+		if failing[int(calls.Add(1))-1] {
+			return "", errors.New("probe failed")
+		}
+
+		return "ok", nil
+	}
+}
+
+func newTestMonitor(p probe, onFailure types.HealthcheckOnFailure) (*healthMonitor, func() []types.Health) {
+	var mu sync.Mutex
+	var history []types.Health
+
+	m := &healthMonitor{
+		probe:     p,
+		interval:  10 * time.Millisecond,
+		timeout:   time.Second,
+		retries:   2,
+		onFailure: onFailure,
+		onChange: func(h types.Health) {
+			mu.Lock()
+			defer mu.Unlock()
+			history = append(history, h)
+		},
+	}
+
+	return m, func() []types.Health {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]types.Health{}, history...)
+	}
+}
+
+func TestHealthMonitor(t *testing.T) {
+	m, history := newTestMonitor(scriptedProbe(1, 2), types.HealthcheckOnFailureExit)
+
+	err := m.run(context.Background(), "id")
+
+	var unhealthy *errUnhealthy
+	if !errors.As(err, &unhealthy) {
+		t.Fatalf("run: want errUnhealthy, got %v", err)
+	}
+
+	want := []types.HealthStatus{
+		types.HealthStatusStarting,
+		types.HealthStatusHealthy,
+		types.HealthStatusHealthy,
+		types.HealthStatusUnhealthy,
+	}
+
+	got := history()
+	if len(got) != len(want) {
+		t.Fatalf("want %d health updates, got %d", len(want), len(got))
+	}
+
+	for i, h := range got {
+		if h.Status != want[i] {
+			t.Errorf("update %d: want %s, got %s", i, want[i], h.Status)
+		}
+	}
+
+	if unhealthy.health.FailingStreak != 2 {
+		t.Errorf("failing streak: want 2, got %d", unhealthy.health.FailingStreak)
+	}
+}
+
+func TestHealthMonitorStartPeriod(t *testing.T) {
+	m, history := newTestMonitor(scriptedProbe(0, 1, 2, 3), types.HealthcheckOnFailureExit)
+	m.startPeriod = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := m.run(ctx, "id"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	for _, h := range history() {
+		if h.Status == types.HealthStatusUnhealthy || h.FailingStreak != 0 {
+			t.Fatalf("failure counted during start period: %+v", h)
+		}
+	}
+}
+
+func TestHealthMonitorLog(t *testing.T) {
+	m, history := newTestMonitor(scriptedProbe(0, 1), types.HealthcheckOnFailureLog)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := m.run(ctx, "id"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	// The container recovers once the probe succeeds again.
+	got := history()
+	if last := got[len(got)-1]; last.Status != types.HealthStatusHealthy {
+		t.Errorf("final status: want %s, got %s", types.HealthStatusHealthy, last.Status)
+	}
+}
+
+func TestNewProbe(t *testing.T) {
+	drv := newDriver(t, newSpec("sleep 3600"))
+
+	var specErr *types.SpecError
+	if _, err := newProbe(drv, &types.Healthcheck{}); !errors.As(err, &specErr) {
+		t.Errorf("no probe: want SpecError, got %v", err)
+	}
+
+	both := &types.Healthcheck{
+		Tcp:  &types.TcpProbe{Port: 80},
+		Http: &types.HttpProbe{Port: 80},
+	}
+	if _, err := newProbe(drv, both); !errors.As(err, &specErr) {
+		t.Errorf("two probes: want SpecError, got %v", err)
+	}
+}
+
+func TestHTTPProbe(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+
+	p := httpProbe(&types.HttpProbe{Port: portNum, Path: "/healthz"})
+
+	if _, err := p(context.Background(), "id"); err != nil {
+		t.Errorf("healthy: %v", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	if _, err := p(context.Background(), "id"); err == nil {
+		t.Errorf("unhealthy: want error")
+	}
+}
+
+func TestTCPProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := l.Addr().(*net.TCPAddr).Port
+	p := tcpProbe(&types.TcpProbe{Port: port})
+
+	if _, err := p(context.Background(), "id"); err != nil {
+		t.Errorf("listening: %v", err)
+	}
+
+	l.Close()
+
+	if _, err := p(context.Background(), "id"); err == nil {
+		t.Errorf("closed: want error")
+	}
+}
+
+func TestRunUnhealthyExit(t *testing.T) {
+	spec := newSpec("sleep 3600")
+	spec.Healthcheck = &types.Healthcheck{
+		Exec:      &types.ExecProbe{Command: []string{"false"}},
+		Interval:  1,
+		Retries:   1,
+		OnFailure: types.HealthcheckOnFailureExit,
+	}
+
+	drv := newDriver(t, spec)
+	stateDir := t.TempDir()
+
+	_, err := Run(context.Background(), drv, spec, RunOptions{Cleanup: true, StateDir: stateDir})
+	if !errors.Is(err, ErrUnhealthy) {
+		t.Fatalf("Run: want ErrUnhealthy, got %v", err)
+	}
+
+	if _, err := drv.FindContainer(context.Background(), spec.Name, labelsFor(spec)); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("FindContainer: want ErrContainerNotFound, got %v", err)
+	}
+}
+
+func TestRunUnhealthyRestart(t *testing.T) {
+	ctx := context.Background()
+	spec := newSpec("sleep 3600")
+	spec.Healthcheck = &types.Healthcheck{
+		Exec:      &types.ExecProbe{Command: []string{"check"}},
+		Interval:  1,
+		Retries:   1,
+		OnFailure: types.HealthcheckOnFailureRestart,
+	}
+
+	drv := newDriver(t, spec)
+
+	var starts atomic.Int32
+	drv.SetProgram(spec.Image, func(ctx context.Context, stdout, stderr io.Writer) int {
+		starts.Add(1)
+		<-ctx.Done()
+		return 143
+	})
+
+	// Only the first probe fails.
+	var probes atomic.Int32
+	drv.SetExec(spec.Image, func(ctx context.Context, command []string, stdin io.Reader, stdout, stderr io.Writer) int {
+		if probes.Add(1) == 1 {
+			return 1
+		}
+
+		return 0
+	})
+
+	stateDir := t.TempDir()
+	runCtx, cancel := context.WithTimeout(ctx, 3500*time.Millisecond)
+	defer cancel()
+
+	if _, err := Run(runCtx, drv, spec, RunOptions{StateDir: stateDir}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if got := starts.Load(); got != 2 {
+		t.Errorf("starts: want 2, got %d", got)
+	}
+
+	status, err := drv.FindContainer(ctx, spec.Name, labelsFor(spec))
+	if err != nil {
+		t.Fatalf("FindContainer: %v", err)
+	}
+
+	health, err := readHealthState(stateDir, spec.Name, status.ID)
+	if err != nil {
+		t.Fatalf("readHealthState: %v", err)
+	}
+
+	if health == nil || health.Status != types.HealthStatusHealthy {
+		t.Errorf("health: want %s, got %+v", types.HealthStatusHealthy, health)
+	}
+}
+
+func TestValidateProbeNetwork(t *testing.T) {
+	intPtr := func(n int) *int { return &n }
+	published := func(port types.PortMapping) *types.Network {
+		return &types.Network{Mode: types.NetworkModeBridge, Ports: []types.PortMapping{port}}
+	}
+
+	tests := []struct {
+		name    string
+		hc      *types.Healthcheck
+		network *types.Network
+		wantErr bool
+	}{
+		{"Host", &types.Healthcheck{Http: &types.HttpProbe{Port: 8080}}, nil, false},
+		{"Exec/None", &types.Healthcheck{Exec: &types.ExecProbe{Command: []string{"true"}}}, &types.Network{Mode: types.NetworkModeNone}, false},
+		{"HTTP/None", &types.Healthcheck{Http: &types.HttpProbe{Port: 8080}}, &types.Network{Mode: types.NetworkModeNone}, true},
+		{"TCP/None", &types.Healthcheck{Tcp: &types.TcpProbe{Port: 5432}}, &types.Network{Mode: types.NetworkModeNone}, true},
+		{"Bridge/Published", &types.Healthcheck{Tcp: &types.TcpProbe{Port: 5432}}, published(types.PortMapping{ContainerPort: 5432}), false},
+		{"Bridge/HostPort", &types.Healthcheck{Http: &types.HttpProbe{Port: 8080}}, published(types.PortMapping{ContainerPort: 80, HostPort: intPtr(8080)}), false},
+		{"Bridge/ContainerPort", &types.Healthcheck{Http: &types.HttpProbe{Port: 80}}, published(types.PortMapping{ContainerPort: 80, HostPort: intPtr(8080)}), true},
+		{"Bridge/UDP", &types.Healthcheck{Tcp: &types.TcpProbe{Port: 53}}, published(types.PortMapping{ContainerPort: 53, Protocol: types.PortMappingProtocolUdp}), true},
+		{"Bridge/OtherAddress", &types.Healthcheck{Tcp: &types.TcpProbe{Port: 5432}}, published(types.PortMapping{ContainerPort: 5432, HostIp: strPtr("192.0.2.1")}), true},
+		{"Bridge/Unpublished", &types.Healthcheck{Tcp: &types.TcpProbe{Port: 5432}}, &types.Network{Mode: types.NetworkModeBridge}, true},
+		{"Bridge/ExplicitHost", &types.Healthcheck{Tcp: &types.TcpProbe{Host: "10.88.0.2", Port: 5432}}, &types.Network{Mode: types.NetworkModeBridge}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newSpec("sleep 3600")
+			spec.Healthcheck = tt.hc
+			spec.Network = tt.network
+
+			err := validateProbeNetwork(spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("want error %v, got %v", tt.wantErr, err)
+			}
+
+			var specErr *types.SpecError
+			if err != nil && !errors.As(err, &specErr) {
+				t.Errorf("want a SpecError, got %T", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/distribution/reference"
+	"github.com/rs/zerolog"
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/sdnotify"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+// pinnedDigest returns the digest the image of spec is pinned to with
+// name@sha256:<digest>, empty if it is not pinned.
+func pinnedDigest(spec *types.Spec) (string, error) {
+	named, err := reference.ParseNormalizedNamed(spec.Image)
+	if err != nil {
+		return "", &types.SpecError{Field: "image", Err: err}
+	}
+
+	if canonical, ok := named.(reference.Canonical); ok {
+		return canonical.Digest().String(), nil
+	}
+
+	return "", nil
+}
+
+func pullPolicy(spec *types.Spec) types.SpecPullPolicy {
+	if spec.PullPolicy == nil {
+		return types.SpecPullPolicyIfNotPresent
+	}
+
+	return *spec.PullPolicy
+}
+
+// pullImage makes the image of spec available as its pull policy asks and
+// returns its digest, which must be the digest the image is pinned to.
+func pullImage(ctx context.Context, drv driver.Driver, spec *types.Spec, n Notifier) (string, error) {
+	pinned, err := pinnedDigest(spec)
+	if err != nil {
+		return "", err
+	}
+
+	policy := pullPolicy(spec)
+
+	digest, err := drv.ImageDigest(ctx, spec.Image)
+	missing := errors.Is(err, driver.ErrImageNotFound)
+	if err != nil && !missing {
+		return "", fmt.Errorf("failed to inspect image: %w", err)
+	}
+
+	switch {
+	case policy == types.SpecPullPolicyAlways || (missing && policy == types.SpecPullPolicyIfNotPresent):
+		zerolog.Ctx(ctx).Info().Str("image", spec.Image).Msg("pulling image")
+		notify(ctx, n, sdnotify.Status("Pulling image"))
+
+		if err := drv.PullImage(ctx, spec.Image); err != nil {
+			return "", fmt.Errorf("failed to pull image: %w", err)
+		}
+
+		digest, err = drv.ImageDigest(ctx, spec.Image)
+		if err != nil {
+			return "", fmt.Errorf("failed to inspect image: %w", err)
+		}
+	case missing:
+		return "", fmt.Errorf("%w: %s is not present and pull_policy is %s", ErrImageNotFound, spec.Image, policy)
+	}
+
+	if pinned != "" && digest != pinned {
+		return "", fmt.Errorf("%w: %s has digest %s", ErrImageDigestMismatch, spec.Image, digest)
+	}
+
+	return digest, nil
+}
+
+type PullOptions struct {
+	// Force pulls images whose pull policy is if-not-present even if they
+	// are present.
+	Force bool
+}
+
+// Pull makes the images of spec and its sidecars available as their pull
+// policy asks. Images whose pull policy is never are not pulled, Pull fails
+// if they are missing.
+func Pull(ctx context.Context, drv driver.Driver, spec *types.Spec, opts PullOptions) error {
+	specs := []*types.Spec{spec}
+	for i := range spec.Sidecars {
+		specs = append(specs, sidecarSpec(spec, &spec.Sidecars[i]))
+	}
+
+	for _, s := range specs {
+		if opts.Force && pullPolicy(s) != types.SpecPullPolicyNever {
+			forced := *s
+			always := types.SpecPullPolicyAlways
+			forced.PullPolicy = &always
+			s = &forced
+		}
+
+		if _, err := pullImage(ctx, drv, s, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// localImageDigest returns the digest of the local image of spec, empty if
+// it has not been pulled.
+func localImageDigest(ctx context.Context, drv driver.Driver, spec *types.Spec) (string, error) {
+	digest, err := drv.ImageDigest(ctx, spec.Image)
+	if errors.Is(err, driver.ErrImageNotFound) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image: %w", err)
+	}
+
+	return digest, nil
+}
+
+// imageChanged reports whether the container was created from a different
+// image than the local image with digest. Containers created by older
+// releases of sysctr do not record the digest of their image. Rolled back
+// containers match the image they were rolled back from.
+func imageChanged(digest string, labels map[string]string) bool {
+	recorded := labels[LabelImageDigest]
+	return digest != "" && recorded != "" && recorded != digest && labels[LabelRollbackDigest] != digest
+}
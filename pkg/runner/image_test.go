@@ -0,0 +1,206 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tmacro/sysctr/pkg/driver/fake"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+const (
+	testDigest  = "sha256:2d0f4b2f8b7e0e1f3d6b6d7b1c4f9a8e5c3b2a1d0e9f8a7b6c5d4e3f2a1b0c9d"
+	otherDigest = "sha256:9c0b1a2f3e4d5c6b7a8f9e0d1a2b3c4e5f8a9b1c4f7d6b6d3f1e0e7b8f2b4f0d"
+)
+
+func pullPolicyPtr(p types.SpecPullPolicy) *types.SpecPullPolicy {
+	return &p
+}
+
+func TestPullImagePolicy(t *testing.T) {
+	errPull := errors.New("registry unreachable")
+
+	tests := []struct {
+		name    string
+		policy  *types.SpecPullPolicy
+		present bool
+		wantErr error
+	}{
+		{"default present", nil, true, nil},
+		{"default missing", nil, false, errPull},
+		{"if-not-present present", pullPolicyPtr(types.SpecPullPolicyIfNotPresent), true, nil},
+		{"always present", pullPolicyPtr(types.SpecPullPolicyAlways), true, errPull},
+		{"never present", pullPolicyPtr(types.SpecPullPolicyNever), true, nil},
+		{"never missing", pullPolicyPtr(types.SpecPullPolicyNever), false, ErrImageNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			spec := newSpec("sleep 3600")
+			spec.PullPolicy = tt.policy
+
+			drv := fake.New()
+			if tt.present {
+				drv.SetImageDigest(spec.Image, testDigest)
+			}
+
+			// Pulls fail, so only the policies pulling the image fail.
+			drv.FailOn("PullImage", errPull)
+
+			digest, err := pullImage(ctx, drv, spec, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("pullImage: want %v, got %v", tt.wantErr, err)
+			}
+
+			if err == nil && digest != testDigest {
+				t.Errorf("digest: want %s, got %s", testDigest, digest)
+			}
+		})
+	}
+}
+
+func TestPull(t *testing.T) {
+	errPull := errors.New("registry unreachable")
+
+	tests := []struct {
+		name    string
+		policy  *types.SpecPullPolicy
+		force   bool
+		wantErr error
+	}{
+		{"default", nil, false, nil},
+		{"default forced", nil, true, errPull},
+		{"always", pullPolicyPtr(types.SpecPullPolicyAlways), false, errPull},
+		{"never forced", pullPolicyPtr(types.SpecPullPolicyNever), true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newPodSpec("sleep 3600", "exporter")
+			spec.PullPolicy = tt.policy
+
+			drv := fake.New()
+			drv.SetImageDigest(spec.Image, testDigest)
+			drv.FailOn("PullImage", errPull)
+
+			err := Pull(context.Background(), drv, spec, PullOptions{Force: tt.force})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Pull: want %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// Missing images are never pulled for specs with pull_policy never.
+	spec := newSpec("sleep 3600")
+	spec.PullPolicy = pullPolicyPtr(types.SpecPullPolicyNever)
+
+	if err := Pull(context.Background(), fake.New(), spec, PullOptions{}); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("Pull: want ErrImageNotFound, got %v", err)
+	}
+}
+
+func TestPullImagePinned(t *testing.T) {
+	ctx := context.Background()
+
+	spec := newSpec("sleep 3600")
+	spec.Image = "busybox@" + testDigest
+	drv := fake.New()
+
+	digest, err := pullImage(ctx, drv, spec, nil)
+	if err != nil {
+		t.Fatalf("pullImage: %v", err)
+	}
+
+	if digest != testDigest {
+		t.Errorf("digest: want %s, got %s", testDigest, digest)
+	}
+
+	// The local image is not the image the spec is pinned to.
+	drv.SetImageDigest(spec.Image, otherDigest)
+
+	if _, err := pullImage(ctx, drv, spec, nil); !errors.Is(err, ErrImageDigestMismatch) {
+		t.Errorf("pullImage: want ErrImageDigestMismatch, got %v", err)
+	}
+
+	spec.Image = "busybox@sha256:invalid"
+
+	var specErr *types.SpecError
+	if err := validateSpec(drv, spec); !errors.As(err, &specErr) {
+		t.Errorf("validateSpec: want a SpecError, got %v", err)
+	}
+}
+
+func TestRunRecreatesOnImageChange(t *testing.T) {
+	ctx := context.Background()
+
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+
+	id, _, err := run(ctx, drv, spec, "", nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	status, err := drv.ContainerStatus(ctx, id)
+	if err != nil {
+		t.Fatalf("ContainerStatus: %v", err)
+	}
+
+	first := status.Labels[LabelImageDigest]
+	if first == "" {
+		t.Fatalf("image digest not recorded, labels %v", status.Labels)
+	}
+
+	state, err := Status(ctx, drv, spec, StatusOptions{})
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+
+	if state.ImageDigest == nil || *state.ImageDigest != first || *state.Drifted {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	// A new version of the tag is pulled.
+	drv.SetImageDigest(spec.Image, testDigest)
+
+	p, err := PlanRun(ctx, drv, spec, PlanOptions{})
+	if err != nil {
+		t.Fatalf("PlanRun: %v", err)
+	}
+
+	if p.Action != ActionRecreated || !p.ImageChanged || !p.Drifted || len(p.Changes) != 0 {
+		t.Errorf("changed image: unexpected plan %+v", p)
+	}
+
+	newID, action, err := run(ctx, drv, spec, "", nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if action != ActionRecreated || newID == id {
+		t.Errorf("changed image: want a new container, got %s %s", action, newID)
+	}
+
+	status, err = drv.ContainerStatus(ctx, newID)
+	if err != nil {
+		t.Fatalf("ContainerStatus: %v", err)
+	}
+
+	if status.Labels[LabelImageDigest] != testDigest {
+		t.Errorf("image digest: want %s, got %s", testDigest, status.Labels[LabelImageDigest])
+	}
+
+	// Changing the pull policy does not recreate the container.
+	spec.PullPolicy = pullPolicyPtr(types.SpecPullPolicyNever)
+
+	_, action, err = run(ctx, drv, spec, "", nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if action != ActionUnchanged {
+		t.Errorf("changed pull policy: want %s, got %s", ActionUnchanged, action)
+	}
+}
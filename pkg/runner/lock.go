@@ -0,0 +1,60 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// lockPollInterval is how often a busy container lock is retried.
+const lockPollInterval = 100 * time.Millisecond
+
+func lockPath(stateDir, name string) string {
+	return filepath.Join(stateDir, name, "lock")
+}
+
+// lockContainer takes the lock of the container of name, held by Update
+// while it replaces the container and by Run while it converges to it, so
+// that Run does not recreate a container being updated. It waits for the
+// lock until ctx is cancelled and returns the function releasing it. No lock
+// is taken when stateDir is empty.
+func lockContainer(ctx context.Context, stateDir, name string) (func(), error) {
+	if stateDir == "" {
+		return func() {}, nil
+	}
+
+	path := lockPath(stateDir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			f.Close()
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	// Closing the file releases the lock.
+	return func() { f.Close() }, nil
+}
@@ -0,0 +1,23 @@
+package runner
+
+import (
+	"context"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+// Logs copies the output of the container of spec, whether it is running or
+// has exited.
+func Logs(ctx context.Context, drv driver.Driver, spec *types.Spec, opts driver.LogOptions) error {
+	status, err := drv.FindContainer(ctx, spec.Name, map[string]string{
+		LabelSysCtr: "true",
+		LabelName:   spec.Name,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return drv.GetLogs(ctx, status.ID, opts)
+}
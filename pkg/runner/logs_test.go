@@ -0,0 +1,44 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+func TestLogs(t *testing.T) {
+	ctx := context.Background()
+	spec := newSpec("echo one; echo two; echo oops >&2; exit 3")
+	drv := newDriver(t, spec)
+
+	if _, err := Run(ctx, drv, spec, RunOptions{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := Logs(ctx, drv, spec, driver.LogOptions{Stdout: &stdout, Stderr: &stderr, Tail: 2})
+	if err != nil {
+		t.Fatalf("Logs: %v", err)
+	}
+
+	if got := stdout.String(); got != "two\n" {
+		t.Errorf("stdout: want %q, got %q", "two\n", got)
+	}
+
+	if got := stderr.String(); got != "oops\n" {
+		t.Errorf("stderr: want %q, got %q", "oops\n", got)
+	}
+}
+
+func TestLogsNotFound(t *testing.T) {
+	spec := newSpec("true")
+	drv := newDriver(t, spec)
+
+	err := Logs(context.Background(), drv, spec, driver.LogOptions{Tail: driver.TailAll})
+	if !errors.Is(err, ErrContainerNotFound) {
+		t.Fatalf("want ErrContainerNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/sdnotify"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	states []string
+}
+
+func (n *recordingNotifier) Notify(states ...string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.states = append(n.states, states...)
+	return nil
+}
+
+// index returns the position of the first notification of state, -1 if it
+// was not sent.
+func (n *recordingNotifier) index(state string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for i, s := range n.states {
+		if s == state {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (n *recordingNotifier) count(state string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	count := 0
+	for _, s := range n.states {
+		if s == state {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestRunNotifiesReady(t *testing.T) {
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+	n := &recordingNotifier{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	if _, err := Run(ctx, drv, spec, RunOptions{Notifier: n}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	started := n.index(sdnotify.Status("Starting container"))
+	ready := n.index(sdnotify.Ready)
+	stopping := n.index(sdnotify.Stopping)
+
+	if started < 0 || ready < started || stopping < ready {
+		t.Errorf("unexpected notifications: %q", n.states)
+	}
+}
+
+func TestRunNotifiesReadyWhenHealthy(t *testing.T) {
+	spec := newSpec("sleep 3600")
+	spec.Healthcheck = &types.Healthcheck{
+		Exec:     &types.ExecProbe{Command: []string{"true"}},
+		Interval: 1,
+	}
+
+	drv := newDriver(t, spec)
+	n := &recordingNotifier{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Run(ctx, drv, spec, RunOptions{Notifier: n})
+		done <- err
+	}()
+
+	time.Sleep(500 * time.Millisecond)
+	if n.index(sdnotify.Ready) >= 0 {
+		t.Errorf("ready before the container is healthy")
+	}
+
+	time.Sleep(time.Second)
+	if n.index(sdnotify.Ready) < 0 {
+		t.Errorf("not ready once the container is healthy")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+func TestRunWatchdog(t *testing.T) {
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+	n := &recordingNotifier{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(250*time.Millisecond, cancel)
+
+	opts := RunOptions{Notifier: n, WatchdogInterval: 100 * time.Millisecond}
+	if _, err := Run(ctx, drv, spec, opts); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if got := n.count(sdnotify.Watchdog); got < 3 {
+		t.Errorf("watchdog notifications: want at least 3, got %d", got)
+	}
+}
@@ -0,0 +1,150 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+// Plan is what Run would do to converge the container of a spec.
+type Plan struct {
+	Name string `json:"name"`
+	// ID of the existing container, empty if there is none.
+	ID     string `json:"id,omitempty"`
+	Action Action `json:"action"`
+	// Reason explains why the container is recreated.
+	Reason string `json:"reason,omitempty"`
+	// Drifted reports whether the existing container does not match the
+	// spec.
+	Drifted bool `json:"drifted"`
+	// Recorded reports whether the spec the existing container was created
+	// from is known. Containers created by older releases of sysctr only
+	// record its hash.
+	Recorded bool `json:"recorded"`
+	// Changes from the spec the existing container was created from to the
+	// spec.
+	Changes []types.SpecChange `json:"changes,omitempty"`
+	// SecretsChanged reports whether the value of a secret changed.
+	SecretsChanged bool `json:"secrets_changed"`
+	// ImageChanged reports whether the local image is not the image the
+	// container was created from, such as after pulling a new version of
+	// its tag.
+	ImageChanged bool `json:"image_changed"`
+}
+
+type PlanOptions struct {
+	// StateDir is where the key of the digest of secrets is stored.
+	StateDir string
+}
+
+// PlanRun returns what Run would do for spec, without changing anything.
+func PlanRun(ctx context.Context, drv driver.Driver, spec *types.Spec, opts PlanOptions) (*Plan, error) {
+	if err := validateSpec(drv, spec); err != nil {
+		return nil, err
+	}
+
+	status, err := drv.FindContainer(ctx, spec.Name, map[string]string{
+		LabelSysCtr: "true",
+		LabelName:   spec.Name,
+	})
+
+	if errors.Is(err, driver.ErrContainerNotFound) {
+		return &Plan{Name: spec.Name, Action: ActionCreated}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch containers: %w", err)
+	}
+
+	imageDigest, err := localImageDigest(ctx, drv, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return plan(drv, spec, recordedSecretsDigest(spec, opts.StateDir, status.Labels), imageDigest, status)
+}
+
+// plan returns what Run does to the existing container of spec, given the
+// digest of its secrets and of the local image, empty if it is unknown.
+func plan(drv driver.Driver, spec *types.Spec, secretsDigest, imageDigest string, status *driver.Status) (*Plan, error) {
+	p := &Plan{
+		Name:   spec.Name,
+		ID:     status.ID,
+		Action: ActionUnchanged,
+	}
+
+	drifted, err := specChanged(drv, spec, secretsDigest, status.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash spec: %w", err)
+	}
+
+	p.SecretsChanged = status.Labels[LabelSecretsDigest] != secretsDigest
+	p.ImageChanged = imageChanged(imageDigest, status.Labels)
+	p.Drifted = drifted || p.ImageChanged
+
+	if recorded, ok := status.Annotations[AnnotationSpec]; ok {
+		var old types.Spec
+		if err := json.Unmarshal([]byte(recorded), &old); err != nil {
+			return nil, fmt.Errorf("failed to decode recorded spec: %w", err)
+		}
+
+		p.Recorded = true
+		p.Changes, err = types.DiffSpecs(&old, spec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case status.Status != driver.Running:
+		p.Action = ActionRecreated
+		p.Reason = "container is not running"
+	case drifted:
+		p.Action = ActionRecreated
+		p.Reason = "container does not match spec"
+	case p.ImageChanged:
+		p.Action = ActionRecreated
+		p.Reason = "image changed"
+	}
+
+	return p, nil
+}
+
+// validateSpec returns a SpecError if the container of spec can not be
+// created.
+func validateSpec(drv driver.Driver, spec *types.Spec) error {
+	if _, err := newHealthMonitor(drv, spec.Healthcheck); err != nil {
+		return err
+	}
+
+	if err := validateProbeNetwork(spec); err != nil {
+		return err
+	}
+
+	if _, err := newRestartPolicy(spec.Restart); err != nil {
+		return err
+	}
+
+	if _, err := newDriverSpec(spec, ""); err != nil {
+		return err
+	}
+
+	if _, err := pinnedDigest(spec); err != nil {
+		return err
+	}
+
+	return validateSidecars(spec)
+}
+
+func changeStrings(changes []types.SpecChange) []string {
+	s := make([]string, len(changes))
+	for i, c := range changes {
+		s[i] = c.String()
+	}
+
+	return s
+}
@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+func TestPlanRun(t *testing.T) {
+	ctx := context.Background()
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+
+	p, err := PlanRun(ctx, drv, spec, PlanOptions{})
+	if err != nil {
+		t.Fatalf("PlanRun: %v", err)
+	}
+
+	if p.Action != ActionCreated || p.ID != "" {
+		t.Errorf("no container: unexpected plan %+v", p)
+	}
+
+	id, action, err := run(ctx, drv, spec, "", nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if action != ActionCreated {
+		t.Errorf("run: want %s, got %s", ActionCreated, action)
+	}
+
+	p, err = PlanRun(ctx, drv, spec, PlanOptions{})
+	if err != nil {
+		t.Fatalf("PlanRun: %v", err)
+	}
+
+	if p.Action != ActionUnchanged || p.ID != id || p.Drifted || !p.Recorded || len(p.Changes) != 0 {
+		t.Errorf("matching container: unexpected plan %+v", p)
+	}
+
+	changed := newSpec("sleep 3600")
+	changed.Env = []types.EnvVar{{Name: "FOO", Value: "bar"}}
+
+	p, err = PlanRun(ctx, drv, changed, PlanOptions{})
+	if err != nil {
+		t.Fatalf("PlanRun: %v", err)
+	}
+
+	if p.Action != ActionRecreated || !p.Drifted || !p.Recorded {
+		t.Fatalf("drifted container: unexpected plan %+v", p)
+	}
+
+	want := []string{`+ env[FOO].name: "FOO"`, `+ env[FOO].value: "bar"`}
+	if got := changeStrings(p.Changes); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("changes: want %v, got %v", want, got)
+	}
+
+	// PlanRun does not touch the container.
+	status, err := drv.ContainerStatus(ctx, id)
+	if err != nil {
+		t.Fatalf("ContainerStatus: %v", err)
+	}
+
+	if status.Labels[LabelSpecHash] != mustHashSpec(t, drv, spec) {
+		t.Errorf("container was changed by PlanRun")
+	}
+}
+
+func TestPlanRunNotRecorded(t *testing.T) {
+	ctx := context.Background()
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+
+	// Containers created by older releases only record the spec hash.
+	startContainer(t, drv, spec, "")
+
+	p, err := PlanRun(ctx, drv, spec, PlanOptions{})
+	if err != nil {
+		t.Fatalf("PlanRun: %v", err)
+	}
+
+	if p.Action != ActionRecreated || !p.Drifted || p.Recorded || p.Changes != nil {
+		t.Errorf("unexpected plan %+v", p)
+	}
+}
+
+func TestPlanRunInvalidSpec(t *testing.T) {
+	spec := newSpec("true")
+	spec.Healthcheck = &types.Healthcheck{}
+	drv := newDriver(t, spec)
+
+	_, err := PlanRun(context.Background(), drv, spec, PlanOptions{})
+
+	var specErr *types.SpecError
+	if !errors.As(err, &specErr) {
+		t.Fatalf("want SpecError, got %v", err)
+	}
+}
@@ -0,0 +1,334 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+// sidecarRestartDelay is the time Run waits before restarting a sidecar that
+// exited while the primary container is running.
+const sidecarRestartDelay = time.Second
+
+// sidecarName returns the name of the container of a sidecar of spec.
+func sidecarName(spec *types.Spec, sidecar *types.Sidecar) string {
+	return spec.Name + "-" + sidecar.Name
+}
+
+// sidecarSpec returns the spec of the container of a sidecar, which is pulled
+// and stopped like the primary container of spec.
+func sidecarSpec(spec *types.Spec, sidecar *types.Sidecar) *types.Spec {
+	return &types.Spec{
+		Name:         sidecarName(spec, sidecar),
+		Image:        sidecar.Image,
+		PullPolicy:   spec.PullPolicy,
+		Command:      sidecar.Command,
+		Args:         sidecar.Args,
+		Env:          sidecar.Env,
+		VolumeMounts: sidecar.VolumeMounts,
+		Resources:    sidecar.Resources,
+		StopSignal:   spec.StopSignal,
+		StopTimeout:  spec.StopTimeout,
+	}
+}
+
+// newSidecarDriverSpec converts a sidecar of spec to the driver's
+// representation of a container joining the namespaces of the primary
+// container. Sidecars are labelled with the hash of the whole spec, so that
+// they are recreated along with the primary container.
+func newSidecarDriverSpec(spec *types.Spec, sidecar *types.Sidecar, primaryID, configHash string) (*driver.Spec, error) {
+	driverSpec, err := newDriverSpec(sidecarSpec(spec, sidecar), configHash)
+	if err != nil {
+		return nil, err
+	}
+
+	driverSpec.Labels[LabelPod] = spec.Name
+	driverSpec.Network = driver.Network{}
+	driverSpec.Namespaces = driver.Namespaces{
+		Join:     primaryID,
+		SharePID: spec.SharePid,
+	}
+
+	return driverSpec, nil
+}
+
+func validateSidecars(spec *types.Spec) error {
+	names := make(map[string]bool, len(spec.Sidecars))
+	for i := range spec.Sidecars {
+		sidecar := &spec.Sidecars[i]
+
+		if sidecar.Name == "" {
+			return &types.SpecError{Field: fmt.Sprintf("sidecars[%d].name", i), Err: errors.New("must not be empty")}
+		}
+
+		if names[sidecar.Name] {
+			return &types.SpecError{Field: "sidecars", Err: fmt.Errorf("duplicate sidecar name %q", sidecar.Name)}
+		}
+
+		names[sidecar.Name] = true
+
+		s := sidecarSpec(spec, sidecar)
+		if _, err := newDriverSpec(s, ""); err != nil {
+			return fmt.Errorf("sidecar %s: %w", sidecar.Name, err)
+		}
+
+		if _, err := pinnedDigest(s); err != nil {
+			return fmt.Errorf("sidecar %s: %w", sidecar.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// listSidecars returns the sidecar containers of spec in their declared
+// order, followed by those no longer declared.
+func listSidecars(ctx context.Context, drv driver.Driver, spec *types.Spec) ([]driver.Status, error) {
+	containers, err := drv.ListContainers(ctx, map[string]string{
+		LabelSysCtr: "true",
+		LabelPod:    spec.Name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sidecars: %w", err)
+	}
+
+	byName := make(map[string]driver.Status, len(containers))
+	for _, c := range containers {
+		byName[c.Labels[LabelName]] = c
+	}
+
+	sidecars := make([]driver.Status, 0, len(containers))
+	for i := range spec.Sidecars {
+		name := sidecarName(spec, &spec.Sidecars[i])
+		if c, ok := byName[name]; ok {
+			sidecars = append(sidecars, c)
+			delete(byName, name)
+		}
+	}
+
+	for _, c := range containers {
+		if _, ok := byName[c.Labels[LabelName]]; ok {
+			sidecars = append(sidecars, c)
+		}
+	}
+
+	return sidecars, nil
+}
+
+// sidecarIDs returns the IDs of the sidecar containers of spec in their
+// declared order.
+func sidecarIDs(ctx context.Context, drv driver.Driver, spec *types.Spec) ([]string, error) {
+	if len(spec.Sidecars) == 0 {
+		return nil, nil
+	}
+
+	sidecars, err := listSidecars(ctx, drv, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	declared := make(map[string]bool, len(spec.Sidecars))
+	for i := range spec.Sidecars {
+		declared[sidecarName(spec, &spec.Sidecars[i])] = true
+	}
+
+	ids := make([]string, 0, len(spec.Sidecars))
+	for _, c := range sidecars {
+		if declared[c.Labels[LabelName]] {
+			ids = append(ids, c.ID)
+		}
+	}
+
+	return ids, nil
+}
+
+// removeSidecars stops the sidecars in the reverse of their order, unless
+// force is set, and removes them. A non-zero timeout in seconds takes
+// precedence over the stop timeout of spec.
+func removeSidecars(ctx context.Context, drv driver.Driver, spec *types.Spec, sidecars []driver.Status, force bool, timeout int) error {
+	logger := zerolog.Ctx(ctx)
+
+	if !force {
+		for i := len(sidecars) - 1; i >= 0; i-- {
+			if sidecars[i].Status != driver.Running {
+				continue
+			}
+
+			err := drv.StopContainer(ctx, sidecars[i].ID, stopOptions(spec, timeout))
+			if err != nil {
+				return fmt.Errorf("failed to stop sidecar %s: %w", sidecars[i].Name, err)
+			}
+		}
+	}
+
+	for i := len(sidecars) - 1; i >= 0; i-- {
+		logger.Info().Str("id", sidecars[i].ID).Str("sidecar", sidecars[i].Name).Msg("removing sidecar")
+
+		err := drv.RemoveContainer(ctx, sidecars[i].ID)
+		if err != nil {
+			return fmt.Errorf("failed to remove sidecar %s: %w", sidecars[i].Name, err)
+		}
+	}
+
+	return nil
+}
+
+// ensureSidecars converges the sidecars of spec to running containers
+// joining the primary container, in their declared order. Sidecars created
+// from a different spec or image are recreated and those no longer declared
+// are removed.
+func ensureSidecars(ctx context.Context, drv driver.Driver, spec *types.Spec, primaryID, configHash string, n Notifier) error {
+	logger := zerolog.Ctx(ctx)
+
+	existing, err := listSidecars(ctx, drv, spec)
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]driver.Status, len(existing))
+	for _, c := range existing {
+		byName[c.Labels[LabelName]] = c
+	}
+
+	declared := make(map[string]bool, len(spec.Sidecars))
+	for i := range spec.Sidecars {
+		declared[sidecarName(spec, &spec.Sidecars[i])] = true
+	}
+
+	var stale []driver.Status
+	for _, c := range existing {
+		if !declared[c.Labels[LabelName]] {
+			stale = append(stale, c)
+		}
+	}
+
+	if err := removeSidecars(ctx, drv, spec, stale, false, 0); err != nil {
+		return err
+	}
+
+	for i := range spec.Sidecars {
+		sidecar := &spec.Sidecars[i]
+		name := sidecarName(spec, sidecar)
+
+		imageDigest, err := pullImage(ctx, drv, sidecarSpec(spec, sidecar), n)
+		if err != nil {
+			return fmt.Errorf("sidecar %s: %w", sidecar.Name, err)
+		}
+
+		if c, ok := byName[name]; ok {
+			if c.Labels[LabelSpecHash] == configHash && !imageChanged(imageDigest, c.Labels) {
+				if c.Status != driver.Running {
+					if err := drv.StartContainer(ctx, c.ID); err != nil {
+						return fmt.Errorf("failed to start sidecar %s: %w", sidecar.Name, err)
+					}
+
+					logger.Info().Str("id", c.ID).Str("sidecar", name).Msg("sidecar started")
+				}
+
+				continue
+			}
+
+			if err := removeSidecars(ctx, drv, spec, []driver.Status{c}, false, 0); err != nil {
+				return err
+			}
+		}
+
+		driverSpec, err := newSidecarDriverSpec(spec, sidecar, primaryID, configHash)
+		if err != nil {
+			return err
+		}
+
+		driverSpec.Labels[LabelImageDigest] = imageDigest
+
+		id, err := drv.CreateContainer(ctx, driverSpec)
+		if err != nil {
+			return fmt.Errorf("failed to create sidecar %s: %w", sidecar.Name, err)
+		}
+
+		if err := drv.StartContainer(ctx, id); err != nil {
+			return fmt.Errorf("failed to start sidecar %s: %w", sidecar.Name, err)
+		}
+
+		logger.Info().Str("id", id).Str("sidecar", name).Msg("sidecar started")
+	}
+
+	return nil
+}
+
+// startSidecars starts the sidecars in order once the primary container was
+// restarted.
+func startSidecars(ctx context.Context, drv driver.Driver, sidecars []string) error {
+	for _, id := range sidecars {
+		if err := drv.StartContainer(ctx, id); err != nil {
+			return fmt.Errorf("failed to start sidecar: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// stopSidecars stops the sidecars in the reverse of their order, regardless
+// of whether ctx has been cancelled.
+func stopSidecars(drv driver.Driver, sidecars []string, spec *types.Spec) error {
+	for i := len(sidecars) - 1; i >= 0; i-- {
+		if err := stopContainer(drv, sidecars[i], spec); err != nil {
+			return fmt.Errorf("sidecar %s: %w", sidecars[i], err)
+		}
+	}
+
+	return nil
+}
+
+// superviseSidecar follows the output of a sidecar written since logsSince
+// and restarts the sidecar whenever it exits, until ctx is cancelled.
+func superviseSidecar(ctx context.Context, drv driver.Driver, id string, logsSince time.Time) {
+	logger := zerolog.Ctx(ctx).With().Str("sidecar_id", id).Logger()
+
+	for {
+		// GetLogs follows the output until the sidecar exits.
+		err := drv.GetLogs(ctx, id, driver.LogOptions{
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+			Follow: true,
+			Since:  logsSince,
+			Tail:   driver.TailAll,
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			logger.Warn().Err(err).Msg("failed to get sidecar logs")
+		}
+
+		if err := drv.WaitForExit(ctx, id); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			logger.Warn().Err(err).Msg("failed to wait for sidecar to exit")
+		}
+
+		status, err := drv.ContainerStatus(ctx, id)
+		if err == nil {
+			logger.Warn().Int("exit_code", status.ExitCode).Dur("delay", sidecarRestartDelay).Msg("sidecar exited, restarting")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(sidecarRestartDelay):
+		}
+
+		logsSince = time.Now()
+
+		if err := drv.StartContainer(ctx, id); err != nil && ctx.Err() == nil {
+			logger.Warn().Err(err).Msg("failed to restart sidecar")
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/driver/fake"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+func newPodSpec(script string, sidecars ...string) *types.Spec {
+	spec := newSpec(script)
+	for _, name := range sidecars {
+		spec.Sidecars = append(spec.Sidecars, types.Sidecar{
+			Name:    name,
+			Image:   spec.Image,
+			Command: []string{"/bin/sh", "-c"},
+			Args:    []string{"sleep 3600"},
+		})
+	}
+
+	return spec
+}
+
+// findSidecar returns the container of the named sidecar of spec.
+func findSidecar(t *testing.T, drv *fake.FakeDriver, spec *types.Spec, name string) *driver.Status {
+	t.Helper()
+
+	status, err := drv.FindContainer(context.Background(), spec.Name+"-"+name, map[string]string{
+		LabelSysCtr: "true",
+		LabelPod:    spec.Name,
+	})
+	if err != nil {
+		t.Fatalf("FindContainer %s: %v", name, err)
+	}
+
+	return status
+}
+
+func TestRunPod(t *testing.T) {
+	ctx := context.Background()
+	spec := newPodSpec("sleep 3600", "first", "second")
+	drv := newDriver(t, spec)
+
+	id, action, err := run(ctx, drv, spec, "", nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if action != ActionCreated {
+		t.Errorf("action: want %s, got %s", ActionCreated, action)
+	}
+
+	primary, err := drv.ContainerStatus(ctx, id)
+	if err != nil {
+		t.Fatalf("ContainerStatus: %v", err)
+	}
+
+	first := findSidecar(t, drv, spec, "first")
+	second := findSidecar(t, drv, spec, "second")
+
+	for _, s := range []*driver.Status{primary, first, second} {
+		if s.Status != driver.Running {
+			t.Errorf("%s: want running, got %s", s.Name, s.Status)
+		}
+	}
+
+	// Sidecars start in their declared order, after the primary container.
+	if first.StartedAt.Before(primary.StartedAt) || second.StartedAt.Before(first.StartedAt) {
+		t.Errorf("start order: primary %s, first %s, second %s", primary.StartedAt, first.StartedAt, second.StartedAt)
+	}
+
+	// Attaching leaves the pod untouched.
+	attachedID, action, err := run(ctx, drv, spec, "", nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if action != ActionUnchanged || attachedID != id {
+		t.Errorf("want %s %s, got %s %s", ActionUnchanged, id, action, attachedID)
+	}
+
+	if s := findSidecar(t, drv, spec, "first"); s.ID != first.ID {
+		t.Errorf("first sidecar was recreated: %s -> %s", first.ID, s.ID)
+	}
+
+	// Changing a sidecar recreates the pod.
+	spec.Sidecars[1].Env = []types.EnvVar{{Name: "FOO", Value: "bar"}}
+
+	newID, action, err := run(ctx, drv, spec, "", nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if action != ActionRecreated || newID == id {
+		t.Errorf("want %s with a new container, got %s %s", ActionRecreated, action, newID)
+	}
+
+	if s := findSidecar(t, drv, spec, "first"); s.ID == first.ID {
+		t.Error("first sidecar was not recreated with the primary container")
+	}
+
+	if err := Stop(ctx, drv, spec, StopOptions{}); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	for _, name := range []string{"first", "second"} {
+		if s := findSidecar(t, drv, spec, name); s.Status != driver.Stopped {
+			t.Errorf("%s: want stopped, got %s", name, s.Status)
+		}
+	}
+
+	if err := Remove(ctx, drv, spec, RemoveOptions{}); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	containers, err := drv.ListContainers(ctx, map[string]string{LabelSysCtr: "true"})
+	if err != nil {
+		t.Fatalf("ListContainers: %v", err)
+	}
+
+	if len(containers) != 0 {
+		t.Errorf("want no containers, got %+v", containers)
+	}
+}
+
+func TestRunPodExitsWithPrimary(t *testing.T) {
+	spec := newPodSpec("sleep 0.2; exit 3", "exporter")
+	drv := newDriver(t, spec)
+
+	exitCode, err := Run(context.Background(), drv, spec, RunOptions{Cleanup: true})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if exitCode != 3 {
+		t.Errorf("exit code: want 3, got %d", exitCode)
+	}
+
+	containers, err := drv.ListContainers(context.Background(), map[string]string{LabelSysCtr: "true"})
+	if err != nil {
+		t.Fatalf("ListContainers: %v", err)
+	}
+
+	if len(containers) != 0 {
+		t.Errorf("want no containers, got %+v", containers)
+	}
+}
+
+func TestRunPodRestartsSidecar(t *testing.T) {
+	spec := newPodSpec("sleep 3600", "exporter")
+	spec.Sidecars[0].Args = []string{"sleep 0.1; exit 1"}
+	drv := newDriver(t, spec)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Run(ctx, drv, spec, RunOptions{})
+		done <- err
+	}()
+
+	var sidecar *driver.Status
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := drv.FindContainer(ctx, spec.Name+"-exporter", map[string]string{LabelPod: spec.Name})
+		if err == nil && sidecar == nil {
+			sidecar = status
+		}
+
+		if err == nil && status.StartedAt.After(sidecar.StartedAt) {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("sidecar was not restarted")
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	primary, err := drv.FindContainer(context.Background(), spec.Name, labelsFor(spec))
+	if err != nil {
+		t.Fatalf("FindContainer: %v", err)
+	}
+
+	if primary.Status != driver.Stopped {
+		t.Errorf("primary: want stopped, got %s", primary.Status)
+	}
+}
+
+func TestApplyPod(t *testing.T) {
+	ctx := context.Background()
+	spec := newPodSpec("sleep 3600", "exporter")
+	drv := newDriver(t, spec)
+
+	if _, err := Apply(ctx, drv, []*types.Spec{spec}, ApplyOptions{}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	// Sidecars are kept along with their primary container.
+	results, err := Apply(ctx, drv, []*types.Spec{spec}, ApplyOptions{})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	if len(results) != 1 || results[0].Action != ActionUnchanged {
+		t.Errorf("want %s, got %+v", ActionUnchanged, results)
+	}
+
+	findSidecar(t, drv, spec, "exporter")
+
+	// And pruned with it.
+	results, err = Apply(ctx, drv, nil, ApplyOptions{AllowEmpty: true})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Errorf("want 2 results, got %+v", results)
+	}
+
+	if results[0].Name != spec.Name+"-exporter" {
+		t.Errorf("want the sidecar removed first, got %+v", results)
+	}
+}
+
+func TestValidateSidecars(t *testing.T) {
+	tests := []struct {
+		name     string
+		sidecars []types.Sidecar
+		field    string
+	}{
+		{"empty name", []types.Sidecar{{Image: "busybox"}}, "sidecars[0].name"},
+		{"duplicate", []types.Sidecar{{Name: "a", Image: "busybox"}, {Name: "a", Image: "busybox"}}, "sidecars"},
+		{"invalid image", []types.Sidecar{{Name: "a", Image: "Invalid"}}, "image"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newSpec("sleep 3600")
+			spec.Sidecars = tt.sidecars
+
+			var specErr *types.SpecError
+			if err := validateSidecars(spec); !errors.As(err, &specErr) || specErr.Field != tt.field {
+				t.Errorf("want spec error on %s, got %v", tt.field, err)
+			}
+		})
+	}
+}
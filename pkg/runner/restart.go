@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+const (
+	defaultRestartInitialDelay = 1 * time.Second
+	defaultRestartMaxDelay     = 60 * time.Second
+	defaultRestartResetAfter   = 300 * time.Second
+)
+
+// restartPolicy decides whether an exited container is restarted by Run and
+// how long to wait before doing so.
+type restartPolicy struct {
+	policy       types.RestartPolicy
+	maxRetries   int
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	jitter       float64
+	resetAfter   time.Duration
+
+	// rand returns a number in [0, 1) to compute the jitter.
+	rand func() float64
+
+	// count is the number of restarts since the last reset.
+	count int
+	delay time.Duration
+}
+
+// newRestartPolicy returns the policy of the restart block, nil if the
+// container is never restarted.
+func newRestartPolicy(r *types.Restart) (*restartPolicy, error) {
+	if r == nil || r.Policy == "" || r.Policy == types.RestartPolicyNever {
+		return nil, nil
+	}
+
+	p := &restartPolicy{
+		policy:       r.Policy,
+		maxRetries:   r.MaxRetries,
+		initialDelay: defaultRestartInitialDelay,
+		maxDelay:     defaultRestartMaxDelay,
+		jitter:       r.Jitter,
+		resetAfter:   defaultRestartResetAfter,
+		rand:         rand.Float64,
+	}
+
+	if r.InitialDelay > 0 {
+		p.initialDelay = time.Duration(r.InitialDelay) * time.Second
+	}
+
+	if r.MaxDelay > 0 {
+		p.maxDelay = time.Duration(r.MaxDelay) * time.Second
+	}
+
+	if r.ResetAfter > 0 {
+		p.resetAfter = time.Duration(r.ResetAfter) * time.Second
+	}
+
+	if p.maxDelay < p.initialDelay {
+		return nil, &types.SpecError{Field: "restart.max_delay", Err: errors.New("must not be less than initial_delay")}
+	}
+
+	if p.jitter < 0 || p.jitter > 1 {
+		return nil, &types.SpecError{Field: "restart.jitter", Err: errors.New("must be between 0 and 1")}
+	}
+
+	return p, nil
+}
+
+// next reports whether a container that exited with exitCode after running
+// for ran is restarted, and the delay before restarting it.
+func (p *restartPolicy) next(exitCode int, ran time.Duration) (time.Duration, bool) {
+	if p.policy == types.RestartPolicyOnFailure && exitCode == 0 {
+		return 0, false
+	}
+
+	// A container that ran long enough is considered recovered.
+	if ran >= p.resetAfter {
+		p.count = 0
+		p.delay = 0
+	}
+
+	if p.maxRetries > 0 && p.count >= p.maxRetries {
+		return 0, false
+	}
+
+	if p.delay == 0 {
+		p.delay = p.initialDelay
+	} else {
+		p.delay = min(2*p.delay, p.maxDelay)
+	}
+
+	p.count++
+
+	return p.delay + time.Duration(p.jitter*p.rand()*float64(p.delay)), true
+}
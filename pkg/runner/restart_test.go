@@ -0,0 +1,143 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+func TestNewRestartPolicy(t *testing.T) {
+	for _, r := range []*types.Restart{nil, {}, {Policy: types.RestartPolicyNever}} {
+		p, err := newRestartPolicy(r)
+		if p != nil || err != nil {
+			t.Errorf("%+v: want no policy, got %+v, %v", r, p, err)
+		}
+	}
+
+	_, err := newRestartPolicy(&types.Restart{Policy: types.RestartPolicyAlways, InitialDelay: 10, MaxDelay: 5})
+
+	var specErr *types.SpecError
+	if !errors.As(err, &specErr) || specErr.Field != "restart.max_delay" {
+		t.Errorf("want SpecError for restart.max_delay, got %v", err)
+	}
+}
+
+func TestRestartPolicyBackoff(t *testing.T) {
+	p, err := newRestartPolicy(&types.Restart{
+		Policy:       types.RestartPolicyOnFailure,
+		MaxRetries:   5,
+		InitialDelay: 1,
+		MaxDelay:     5,
+		ResetAfter:   60,
+	})
+	if err != nil {
+		t.Fatalf("newRestartPolicy: %v", err)
+	}
+
+	if _, ok := p.next(0, time.Second); ok {
+		t.Errorf("on-failure: want no restart after exit code 0")
+	}
+
+	want := []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		delay, ok := p.next(1, time.Second)
+		if !ok || delay != w {
+			t.Errorf("restart %d: want %s, got %s (%t)", i+1, w, delay, ok)
+		}
+	}
+
+	if _, ok := p.next(1, time.Second); ok {
+		t.Errorf("want no restart after max_retries")
+	}
+
+	// Running for reset_after resets the count and delay.
+	delay, ok := p.next(1, time.Minute)
+	if !ok || delay != time.Second || p.count != 1 {
+		t.Errorf("after reset: want 1s, got %s (%t), count %d", delay, ok, p.count)
+	}
+}
+
+func TestRestartPolicyJitter(t *testing.T) {
+	p, err := newRestartPolicy(&types.Restart{Policy: types.RestartPolicyAlways, InitialDelay: 10, Jitter: 0.5})
+	if err != nil {
+		t.Fatalf("newRestartPolicy: %v", err)
+	}
+
+	p.rand = func() float64 { return 0.5 }
+
+	if delay, _ := p.next(0, time.Second); delay != 12500*time.Millisecond {
+		t.Errorf("want 12.5s, got %s", delay)
+	}
+}
+
+func TestRunRestartPolicy(t *testing.T) {
+	ctx := context.Background()
+	spec := newSpec("exit 3")
+	spec.Restart = &types.Restart{
+		Policy:       types.RestartPolicyOnFailure,
+		MaxRetries:   2,
+		InitialDelay: 1,
+		MaxDelay:     1,
+	}
+
+	drv := newDriver(t, spec)
+
+	var starts atomic.Int32
+	drv.SetProgram(spec.Image, func(ctx context.Context, stdout, stderr io.Writer) int {
+		starts.Add(1)
+		return 3
+	})
+
+	stateDir := t.TempDir()
+
+	exitCode, err := Run(ctx, drv, spec, RunOptions{StateDir: stateDir})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if exitCode != 3 {
+		t.Errorf("exit code: want 3, got %d", exitCode)
+	}
+
+	if got := starts.Load(); got != 3 {
+		t.Errorf("starts: want 3, got %d", got)
+	}
+
+	status, err := Status(ctx, drv, spec, StatusOptions{StateDir: stateDir})
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+
+	if status.RestartCount == nil || *status.RestartCount != 2 {
+		t.Errorf("restart count: want 2, got %v", status.RestartCount)
+	}
+}
+
+func TestRunRestartPolicyCancel(t *testing.T) {
+	spec := newSpec("exit 1")
+	spec.Restart = &types.Restart{Policy: types.RestartPolicyAlways, InitialDelay: 60}
+	drv := newDriver(t, spec)
+
+	runCtx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	exitCode, err := Run(runCtx, drv, spec, RunOptions{Cleanup: true})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if exitCode != 1 {
+		t.Errorf("exit code: want 1, got %d", exitCode)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run did not return while waiting to restart, took %s", elapsed)
+	}
+}
@@ -2,34 +2,52 @@ package runner
 
 import (
 	"context"
-	"os"
 
-	"github.com/rs/zerolog"
 	"github.com/tmacro/sysctr/pkg/driver"
 	"github.com/tmacro/sysctr/pkg/types"
 )
 
 type RemoveOptions struct {
-	Force   bool
+	// Force removes a running container without stopping it gracefully first.
+	Force bool
+	// Timeout in seconds before the container is killed. Overrides the
+	// stop_timeout of the spec when non-zero.
 	Timeout int
+	// StateDir is where secrets mounted as files are stored.
+	StateDir string
 }
 
 func Remove(ctx context.Context, drv driver.Driver, spec *types.Spec, opts RemoveOptions) error {
-	logger := zerolog.Ctx(ctx)
-
 	status, err := drv.FindContainer(ctx, spec.Name, map[string]string{
 		LabelSysCtr: "true",
 		LabelName:   spec.Name,
 	})
 
-	if err == driver.ErrContainerNotFound {
-		logger.Info().Msg("container not found")
-		os.Exit(1)
+	if err != nil {
+		return err
+	}
+
+	sidecars, err := listSidecars(ctx, drv, spec)
+	if err != nil {
+		return err
+	}
+
+	err = removeSidecars(ctx, drv, spec, sidecars, opts.Force, opts.Timeout)
+	if err != nil {
+		return err
+	}
+
+	if status.Status == driver.Running && !opts.Force {
+		err = drv.StopContainer(ctx, status.ID, stopOptions(spec, opts.Timeout))
+		if err != nil {
+			return err
+		}
 	}
 
+	err = drv.RemoveContainer(ctx, status.ID)
 	if err != nil {
 		return err
 	}
 
-	return drv.RemoveContainer(ctx, status.ID)
+	return removeSecrets(opts.StateDir, spec.Name)
 }
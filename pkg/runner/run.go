@@ -2,16 +2,16 @@ package runner
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
-	"sort"
 	"time"
 
+	units "github.com/docker/go-units"
 	"github.com/rs/zerolog"
 	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/sdnotify"
 	"github.com/tmacro/sysctr/pkg/types"
 	"golang.org/x/sync/errgroup"
 )
@@ -20,138 +20,695 @@ const (
 	LabelSysCtr   = "sh.tmacro.sysctr"
 	LabelName     = "sh.tmacro.sysctr.name"
 	LabelSpecHash = "sh.tmacro.sysctr.specHash"
+	// LabelSecretsDigest holds the digest of the secrets the container was
+	// created with.
+	LabelSecretsDigest = "sh.tmacro.sysctr.secretsDigest"
+	// LabelImageDigest holds the digest of the image the container was
+	// created from.
+	LabelImageDigest = "sh.tmacro.sysctr.imageDigest"
+	// LabelRollbackDigest holds the digest of the image of the spec an
+	// update of the container was rolled back from. The container keeps
+	// running the image it was rolled back to while the image of the spec
+	// has this digest.
+	LabelRollbackDigest = "sh.tmacro.sysctr.rollbackDigest"
+	// LabelPod holds the name of the spec a sidecar container belongs to.
+	LabelPod = "sh.tmacro.sysctr.pod"
+
+	// AnnotationSpec holds the normalized spec the container was created
+	// from, as JSON.
+	AnnotationSpec = "sh.tmacro.sysctr.spec"
 )
 
 type RunOptions struct {
 	Cleanup bool
+	// StateDir is where the health of the container is stored for status
+	// to report, and where secrets mounted as files are stored. The health
+	// is not stored when empty, and secrets can not be mounted as files.
+	StateDir string
+	// Notifier receives the readiness and status of the container, see
+	// package sdnotify. Notifications are discarded when nil.
+	Notifier Notifier
+	// WatchdogInterval is the interval within which the Notifier expects
+	// watchdog notifications while the container is alive. Zero disables
+	// them.
+	WatchdogInterval time.Duration
+}
+
+// Notifier sends notifications to the service manager, such as
+// sdnotify.Ready.
+type Notifier interface {
+	Notify(states ...string) error
+}
+
+func notify(ctx context.Context, n Notifier, states ...string) {
+	if n == nil {
+		return
+	}
+
+	if err := n.Notify(states...); err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Msg("failed to notify service manager")
+	}
 }
 
 func Run(ctx context.Context, drv driver.Driver, spec *types.Spec, opts RunOptions) (int, error) {
-	g, ctx := errgroup.WithContext(ctx)
-	ctx, cancel := context.WithCancel(ctx)
+	logger := zerolog.Ctx(ctx)
 
-	idChan := make(chan string, 1)
-	defer close(idChan)
+	monitor, err := newHealthMonitor(drv, spec.Healthcheck)
+	if err != nil {
+		return 0, err
+	}
 
-	var exitCode int
+	restart, err := newRestartPolicy(spec.Restart)
+	if err != nil {
+		return 0, err
+	}
 
-	g.Go(func() error {
-		containerID, err := run(ctx, drv, spec)
-		if err != nil {
-			idChan <- ""
-			return err
+	unlock, err := lockContainer(ctx, opts.StateDir, spec.Name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock container: %w", err)
+	}
+
+	containerID, _, err := run(ctx, drv, spec, opts.StateDir, opts.Notifier)
+	unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	sidecars, err := sidecarIDs(ctx, drv, spec)
+	if err != nil {
+		return 0, err
+	}
+
+	if monitor == nil {
+		notify(ctx, opts.Notifier, sdnotify.Ready, sdnotify.Status("Running"))
+	} else {
+		notify(ctx, opts.Notifier, sdnotify.Status("Waiting for container to become healthy"))
+
+		// Readiness is only reported once the container is healthy.
+		var previous types.HealthStatus
+		monitor.onChange = func(health types.Health) {
+			if opts.StateDir != "" {
+				err := writeHealthState(opts.StateDir, spec.Name, containerID, health)
+				if err != nil {
+					logger.Warn().Err(err).Msg("failed to store container health")
+				}
+			}
+
+			if health.Status == previous {
+				return
+			}
+
+			previous = health.Status
+
+			switch health.Status {
+			case types.HealthStatusHealthy:
+				notify(ctx, opts.Notifier, sdnotify.Ready, sdnotify.Status("Running (healthy)"))
+			case types.HealthStatusUnhealthy:
+				notify(ctx, opts.Notifier, sdnotify.Status("Running (unhealthy)"))
+			}
 		}
+	}
+
+	// Output of the container written before it was restarted has already
+	// been copied.
+	var logsSince time.Time
 
-		idChan <- containerID
+	startedAt := time.Now()
+	restarts := 0
 
-		for {
-			select {
-			case <-ctx.Done():
-				stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-				defer cancel()
+	for {
+		exited, exitCode, err := supervise(ctx, drv, containerID, sidecars, logsSince, monitor, opts)
 
-				err := drv.StopContainer(stopCtx, containerID)
+		// The container may have been stopped to be replaced by Update,
+		// which leaves behind the container to supervise.
+		if ctx.Err() == nil {
+			replacedBy, replaceErr := replacement(ctx, drv, spec, containerID, opts.StateDir)
+			if replaceErr != nil {
+				return 0, replaceErr
+			}
+
+			if replacedBy != "" {
+				logger.Info().Str("id", replacedBy).Str("previous_id", containerID).Msg("supervising replaced container")
+
+				containerID = replacedBy
+				sidecars, err = sidecarIDs(ctx, drv, spec)
 				if err != nil {
-					return fmt.Errorf("failed to stop container: %w", err)
+					return 0, err
+				}
+
+				logsSince = time.Time{}
+				startedAt = time.Now()
+
+				continue
+			}
+		}
+
+		var unhealthy *errUnhealthy
+		if err != nil && !errors.As(err, &unhealthy) {
+			return 0, err
+		}
+
+		// Sidecars are stopped before the primary container, and along with
+		// it when it exits.
+		if err := stopSidecars(drv, sidecars, spec); err != nil {
+			return 0, err
+		}
+
+		if exited {
+			logger.Info().Str("id", containerID).Int("exit_code", exitCode).Msg("container exited")
+
+			// The container exited as sysctr was being stopped, e.g. to the
+			// signal systemd sent to the whole unit, the stop was requested.
+			stopped := ctx.Err() != nil
+
+			if restart != nil && ctx.Err() == nil {
+				delay, ok := restart.next(exitCode, time.Since(startedAt))
+				if ok {
+					logger.Info().Str("id", containerID).Dur("delay", delay).Msg("restarting container")
+					notify(ctx, opts.Notifier, sdnotify.Status(fmt.Sprintf("Container exited with code %d, restarting in %s", exitCode, delay.Round(time.Second))))
+				} else if exitCode != 0 || restart.policy == types.RestartPolicyAlways {
+					logger.Warn().Str("id", containerID).Int("restarts", restart.count).Msg("giving up restarting container")
 				}
 
-				if opts.Cleanup {
-					remCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-					defer cancel()
+				if ok && sleep(ctx, delay, opts) {
+					logsSince = time.Now()
+					startedAt = logsSince
 
-					err = drv.RemoveContainer(remCtx, containerID)
+					err = drv.StartContainer(ctx, containerID)
 					if err != nil {
-						return fmt.Errorf("failed to remove container: %w", err)
+						return 0, fmt.Errorf("failed to start container: %w", err)
 					}
-				}
 
-				return nil
-			default:
-				err = drv.WaitForExit(ctx, containerID)
-				if errors.Is(err, context.Canceled) {
+					if err := startSidecars(ctx, drv, sidecars); err != nil {
+						return 0, err
+					}
+
+					restarts++
+					if opts.StateDir != "" {
+						if err := writeRestartState(opts.StateDir, spec.Name, containerID, restarts); err != nil {
+							logger.Warn().Err(err).Msg("failed to store restart count")
+						}
+					}
+
+					notify(ctx, opts.Notifier, sdnotify.Status("Running"))
+
 					continue
 				}
-				if err != nil {
-					return fmt.Errorf("failed to wait for container to exit: %w", err)
-				}
+			}
 
-				cancel()
+			notify(ctx, opts.Notifier, sdnotify.Status(fmt.Sprintf("Container exited with code %d", exitCode)))
 
-				statusCtx, statusCancel := context.WithTimeout(context.Background(), 5*time.Second)
-				defer statusCancel()
+			if err := cleanup(drv, spec.Name, containerID, sidecars, opts); err != nil {
+				return 0, err
+			}
 
-				status, err := drv.ContainerStatus(statusCtx, containerID)
-				if err != nil {
-					return fmt.Errorf("failed to get container status: %w", err)
-				}
+			if stopped {
+				return 0, nil
+			}
+
+			return exitCode, nil
+		}
+
+		// The container is still running, sysctr is either being stopped or
+		// the container is unhealthy.
+		if unhealthy != nil && unhealthy.action == types.HealthcheckOnFailureRestart && ctx.Err() == nil {
+			notify(ctx, opts.Notifier, sdnotify.Status("Restarting unhealthy container"))
+		} else {
+			notify(ctx, opts.Notifier, sdnotify.Stopping, sdnotify.Status("Stopping container"))
+		}
 
-				zerolog.Ctx(ctx).Info().Str("id", containerID).Int("exit_code", status.ExitCode).Msg("container exited")
-				exitCode = status.ExitCode
+		err = stopContainer(drv, containerID, spec)
+		if err != nil {
+			return 0, err
+		}
+
+		if unhealthy != nil && unhealthy.action == types.HealthcheckOnFailureRestart && ctx.Err() == nil {
+			logger.Info().Str("id", containerID).Msg("restarting unhealthy container")
 
-				return nil
+			logsSince = time.Now()
+			startedAt = logsSince
+
+			err = drv.StartContainer(ctx, containerID)
+			if err != nil {
+				return 0, fmt.Errorf("failed to start container: %w", err)
 			}
+
+			if err := startSidecars(ctx, drv, sidecars); err != nil {
+				return 0, err
+			}
+
+			continue
+		}
+
+		if err := cleanup(drv, spec.Name, containerID, sidecars, opts); err != nil {
+			return 0, err
+		}
+
+		if unhealthy != nil && ctx.Err() == nil {
+			return 0, ErrUnhealthy
 		}
+
+		return 0, nil
+	}
+}
+
+// replacement returns the ID of the container of spec that replaced the
+// container with containerID, empty if it was not replaced. It waits for an
+// update of the container to finish.
+func replacement(ctx context.Context, drv driver.Driver, spec *types.Spec, containerID, stateDir string) (string, error) {
+	unlock, err := lockContainer(ctx, stateDir, spec.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to lock container: %w", err)
+	}
+
+	defer unlock()
+
+	status, err := drv.FindContainer(ctx, spec.Name, map[string]string{
+		LabelSysCtr: "true",
+		LabelName:   spec.Name,
 	})
+	if errors.Is(err, driver.ErrContainerNotFound) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch containers: %w", err)
+	}
+
+	if status.ID == containerID {
+		return "", nil
+	}
+
+	return status.ID, nil
+}
+
+// supervise follows the output of a running container written since
+// logsSince until it exits, ctx is cancelled or the healthcheck fails. It
+// reports whether the container exited and its exit code. Sidecars exiting
+// in the meantime are restarted.
+func supervise(ctx context.Context, drv driver.Driver, containerID string, sidecars []string, logsSince time.Time, monitor *healthMonitor, opts RunOptions) (bool, int, error) {
+	g, ctx := errgroup.WithContext(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	logsDone := make(chan struct{})
+
+	var exited bool
+	var exitCode int
 
 	g.Go(func() error {
-		select {
-		case <-ctx.Done():
+		err := drv.WaitForExit(ctx, containerID)
+		if ctx.Err() != nil {
 			return nil
-		case containerID := <-idChan:
-			if containerID == "" {
-				return nil
-			}
-			for {
-				select {
-				case <-ctx.Done():
-					return nil
-				default:
-					err := drv.GetLogs(ctx, containerID, os.Stdout, os.Stderr)
-					if err != nil && !errors.Is(err, context.Canceled) {
-						return fmt.Errorf("failed to get logs: %w", err)
-					}
-				}
-			}
 		}
+
+		if err != nil {
+			return fmt.Errorf("failed to wait for container to exit: %w", err)
+		}
+
+		// Give the log follower a chance to drain the remaining output.
+		select {
+		case <-logsDone:
+		case <-time.After(5 * time.Second):
+		}
+
+		cancel()
+
+		statusCtx, statusCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer statusCancel()
+
+		status, err := drv.ContainerStatus(statusCtx, containerID)
+		if err != nil {
+			return fmt.Errorf("failed to get container status: %w", err)
+		}
+
+		exited = true
+		exitCode = status.ExitCode
+
+		return nil
 	})
 
+	g.Go(func() error {
+		defer close(logsDone)
+
+		// GetLogs follows the output until the container exits.
+		err := drv.GetLogs(ctx, containerID, driver.LogOptions{
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+			Follow: true,
+			Since:  logsSince,
+			Tail:   driver.TailAll,
+		})
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("failed to get logs: %w", err)
+		}
+
+		return nil
+	})
+
+	for _, id := range sidecars {
+		g.Go(func() error {
+			superviseSidecar(ctx, drv, id, logsSince)
+			return nil
+		})
+	}
+
+	if monitor != nil {
+		g.Go(func() error {
+			return monitor.run(ctx, containerID)
+		})
+	}
+
+	if opts.WatchdogInterval > 0 {
+		g.Go(func() error {
+			watchdog(ctx, drv, containerID, opts.Notifier, opts.WatchdogInterval)
+			return nil
+		})
+	}
+
 	err := g.Wait()
-	return exitCode, err
+	return exited, exitCode, err
+}
+
+// sleep waits for d, notifying the watchdog in the meantime. It returns
+// false if ctx was cancelled first.
+func sleep(ctx context.Context, d time.Duration, opts RunOptions) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	var tick <-chan time.Time
+	if opts.WatchdogInterval > 0 {
+		ticker := time.NewTicker(opts.WatchdogInterval / 2)
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			return true
+		case <-tick:
+			notify(ctx, opts.Notifier, sdnotify.Watchdog)
+		}
+	}
+}
+
+// watchdog notifies the service manager that the container is alive at half
+// the watchdog interval, until ctx is cancelled. Notifications stop when the
+// container is not running or the driver does not respond, which lets the
+// service manager restart the service.
+func watchdog(ctx context.Context, drv driver.Driver, containerID string, n Notifier, interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		statusCtx, cancel := context.WithTimeout(ctx, interval/2)
+		status, err := drv.ContainerStatus(statusCtx, containerID)
+		cancel()
+
+		if err == nil && status.Status == driver.Running {
+			notify(ctx, n, sdnotify.Watchdog)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stopContainer stops the container of spec, regardless of whether ctx has
+// been cancelled.
+func stopContainer(drv driver.Driver, containerID string, spec *types.Spec) error {
+	stopOpts := stopOptions(spec, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), stopOpts.Timeout+stopGracePeriod)
+	defer cancel()
+
+	err := drv.StopContainer(ctx, containerID, stopOpts)
+	if err != nil {
+		return fmt.Errorf("failed to stop container: %w", err)
+	}
+
+	return nil
+}
+
+func cleanup(drv driver.Driver, name, containerID string, sidecars []string, opts RunOptions) error {
+	if !opts.Cleanup {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := len(sidecars) - 1; i >= 0; i-- {
+		if err := drv.RemoveContainer(ctx, sidecars[i]); err != nil {
+			return fmt.Errorf("failed to remove sidecar: %w", err)
+		}
+	}
+
+	err := drv.RemoveContainer(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to remove container: %w", err)
+	}
+
+	if err := removeSecrets(opts.StateDir, name); err != nil {
+		return fmt.Errorf("failed to remove secrets: %w", err)
+	}
+
+	return nil
+}
+
+// hashExtra returns the configuration outside the spec that is covered by
+// the spec hash. Secrets are covered by the digest of their values.
+func hashExtra(drv driver.Driver, secretsDigest string) map[string]string {
+	extra := map[string]string{
+		"driver": drv.DriverInfo().ID,
+	}
+
+	if secretsDigest != "" {
+		extra["secrets"] = secretsDigest
+	}
+
+	return extra
+}
+
+func hashSpec(drv driver.Driver, spec *types.Spec, secretsDigest string) (string, error) {
+	return types.HashSpec(spec, hashExtra(drv, secretsDigest))
+}
+
+// specChanged reports whether the container was created from a different
+// spec. Hashes are verified with the scheme they were produced with, so
+// that changing the scheme does not recreate every container.
+func specChanged(drv driver.Driver, spec *types.Spec, secretsDigest string, labels map[string]string) (bool, error) {
+	hashLabel, ok := labels[LabelSpecHash]
+	if !ok {
+		return true, nil
+	}
+
+	match, err := types.VerifySpecHash(hashLabel, spec, hashExtra(drv, secretsDigest))
+	if err != nil {
+		return false, err
+	}
+
+	return !match, nil
 }
 
-func hashSpec(spec *types.Spec) string {
-	h := sha256.New()
+// newDriverSpec converts spec to the driver's representation of a container.
+func newDriverSpec(spec *types.Spec, configHash string) (*driver.Spec, error) {
+	env := make(map[string]string, len(spec.Env))
+	for _, e := range spec.Env {
+		env[e.Name] = e.Value
+	}
+
+	volumes := make([]driver.Volume, len(spec.VolumeMounts))
+	for i, v := range spec.VolumeMounts {
+		ro := v.ReadOnly != nil && *v.ReadOnly
+		volumes[i] = driver.Volume{
+			Source:   v.Source,
+			Target:   v.Target,
+			ReadOnly: ro,
+		}
+	}
+
+	network, err := newDriverNetwork(spec.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := newDriverResources(spec.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateSecrets(spec, env); err != nil {
+		return nil, err
+	}
+
+	normalized, err := json.Marshal(types.NormalizeSpec(spec))
+	if err != nil {
+		return nil, err
+	}
+
+	return &driver.Spec{
+		Name:        spec.Name,
+		Image:       spec.Image,
+		Command:     spec.Command,
+		Arguments:   spec.Args,
+		Environment: env,
+		Labels: map[string]string{
+			LabelSysCtr:   "true",
+			LabelName:     spec.Name,
+			LabelSpecHash: configHash,
+		},
+		Annotations: map[string]string{
+			AnnotationSpec: string(normalized),
+		},
+		Volumes:   volumes,
+		Network:   network,
+		Resources: resources,
+		// Sidecars join the IPC namespace of the primary container.
+		Namespaces: driver.Namespaces{Shareable: len(spec.Sidecars) > 0},
+	}, nil
+}
+
+func newDriverResources(resources *types.Resources) (driver.Resources, error) {
+	var res driver.Resources
+
+	if resources == nil {
+		return res, nil
+	}
+
+	if resources.CpuShares != nil {
+		res.CPUShares = int64(*resources.CpuShares)
+	}
+
+	if resources.CpuPeriod != nil {
+		res.CPUPeriod = int64(*resources.CpuPeriod)
+	}
+
+	if resources.CpuQuota != nil {
+		res.CPUQuota = int64(*resources.CpuQuota)
+	}
+
+	if resources.PidsLimit != nil {
+		res.PidsLimit = int64(*resources.PidsLimit)
+	}
+
+	if resources.BlkioWeight != nil {
+		res.BlkioWeight = uint16(*resources.BlkioWeight)
+	}
+
+	var err error
+	if resources.MemoryLimit != nil {
+		res.MemoryLimit, err = units.RAMInBytes(*resources.MemoryLimit)
+		if err != nil {
+			return res, &types.SpecError{Field: "memory_limit", Err: err}
+		}
+	}
+
+	if resources.MemoryReservation != nil {
+		res.MemoryReservation, err = units.RAMInBytes(*resources.MemoryReservation)
+		if err != nil {
+			return res, &types.SpecError{Field: "memory_reservation", Err: err}
+		}
+	}
+
+	if res.MemoryLimit > 0 && res.MemoryReservation > res.MemoryLimit {
+		return res, &types.SpecError{Field: "memory_reservation", Err: errors.New("must not exceed memory_limit")}
+	}
 
-	h.Write([]byte(spec.Name + "\n"))
-	h.Write([]byte(spec.Image + "\n"))
+	return res, nil
+}
+
+func newDriverNetwork(network *types.Network) (driver.Network, error) {
+	if network == nil {
+		return driver.Network{Mode: driver.NetworkHost}, nil
+	}
 
-	for _, m := range spec.Command {
-		h.Write([]byte(m + "\n"))
+	mode := driver.NetworkMode(network.Mode)
+	if mode == "" {
+		mode = driver.NetworkHost
 	}
 
-	for _, m := range spec.Args {
-		h.Write([]byte(m + "\n"))
+	if len(network.Ports) > 0 && mode != driver.NetworkBridge {
+		return driver.Network{}, &types.SpecError{
+			Field: "network.ports",
+			Err:   fmt.Errorf("ports can only be published in %s network mode", driver.NetworkBridge),
+		}
 	}
 
-	envVarNames := make([]string, len(spec.Env))
-	envVars := make(map[string]string, len(spec.Env))
+	ports := make([]driver.Port, len(network.Ports))
+	for i, p := range network.Ports {
+		ports[i] = driver.Port{
+			ContainerPort: p.ContainerPort,
+			HostPort:      p.ContainerPort,
+			Protocol:      string(p.Protocol),
+		}
 
-	for i, m := range spec.Env {
-		envVars[m.Name] = m.Value
-		envVarNames[i] = m.Name
+		if ports[i].Protocol == "" {
+			ports[i].Protocol = string(types.PortMappingProtocolTcp)
+		}
+
+		if p.HostPort != nil {
+			ports[i].HostPort = *p.HostPort
+		}
+
+		if p.HostIp != nil {
+			ports[i].HostIP = *p.HostIp
+		}
 	}
 
-	sort.Strings(envVarNames)
+	return driver.Network{Mode: mode, Ports: ports}, nil
+}
+
+// run converges the container of spec to a running container created from
+// it, reusing a running container that matches the spec and its image. The
+// image is pulled as the pull policy of spec asks. Secrets mounted as files
+// are stored in stateDir.
+func run(ctx context.Context, drv driver.Driver, spec *types.Spec, stateDir string, n Notifier) (string, Action, error) {
+	return converge(ctx, drv, spec, stateDir, n, nil)
+}
+
+// imagePin creates a container from a previous image of its spec, pinned
+// to its digest, after an update was rolled back.
+type imagePin struct {
+	// Digest is the digest of the image the container is created from.
+	Digest string
+	// RolledBack is the digest of the image of the spec the update was
+	// rolled back from.
+	RolledBack string
+}
+
+// rollbackPin returns the pin of the image of a rolled back container, nil
+// unless the local image of its spec is still the image it was rolled back
+// from.
+func rollbackPin(status *driver.Status, imageDigest string) *imagePin {
+	if status == nil || imageDigest == "" {
+		return nil
+	}
 
-	for _, name := range envVarNames {
-		h.Write([]byte(fmt.Sprintf("%s=%s\n", name, envVars[name])))
+	rolledBack, previous := status.Labels[LabelRollbackDigest], status.Labels[LabelImageDigest]
+	if rolledBack != imageDigest || previous == "" {
+		return nil
 	}
 
-	return hex.EncodeToString(h.Sum(nil))
+	return &imagePin{Digest: previous, RolledBack: rolledBack}
 }
 
-func run(ctx context.Context, drv driver.Driver, spec *types.Spec) (string, error) {
+// converge is run creating the container from the image pinned by pin. The
+// container is recreated even if it matches the spec. A nil pin keeps
+// rolled back containers on their image.
+func converge(ctx context.Context, drv driver.Driver, spec *types.Spec, stateDir string, n Notifier, pin *imagePin) (string, Action, error) {
 	logger := zerolog.Ctx(ctx)
+	force := pin != nil
+
+	notify(ctx, n, sdnotify.Status("Looking for existing container"))
 
 	status, err := drv.FindContainer(ctx, spec.Name, map[string]string{
 		LabelSysCtr: "true",
@@ -159,91 +716,158 @@ func run(ctx context.Context, drv driver.Driver, spec *types.Spec) (string, erro
 	})
 
 	if err != nil && !errors.Is(err, driver.ErrContainerNotFound) {
-		return "", fmt.Errorf("failed to fetch containers: %w", err)
+		return "", "", fmt.Errorf("failed to fetch containers: %w", err)
+	}
+
+	driverSpec, err := newDriverSpec(spec, "")
+	if err != nil {
+		return "", "", err
+	}
+
+	secrets, err := readSecrets(spec)
+	if err != nil {
+		return "", "", err
+	}
+
+	var digest string
+	if len(secrets) > 0 {
+		key, err := secretsKey(stateDir)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read secrets key: %w", err)
+		}
+
+		digest = secretsDigest(key, secrets)
+	}
+
+	imageDigest, err := pullImage(ctx, drv, spec, n)
+	if err != nil {
+		return "", "", err
+	}
+
+	driverSpec.Labels[LabelImageDigest] = imageDigest
+
+	if pin == nil {
+		pin = rollbackPin(status, imageDigest)
+	}
+
+	if pin != nil {
+		pinned, err := previousImage(ctx, drv, spec, pin.Digest)
+		if err != nil {
+			return "", "", err
+		}
+
+		if _, err := pullImage(ctx, drv, pinned, n); err != nil {
+			return "", "", err
+		}
+
+		driverSpec.Image = pinned.Image
+		driverSpec.Labels[LabelImageDigest] = pin.Digest
+		driverSpec.Labels[LabelRollbackDigest] = pin.RolledBack
 	}
 
-	configHash := hashSpec(spec)
+	driverSpec.Labels[LabelSpecHash], err = hashSpec(drv, spec, digest)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to hash spec: %w", err)
+	}
+
+	if digest != "" {
+		driverSpec.Labels[LabelSecretsDigest] = digest
+	}
 
-	containerID := ""
-	needsStart := true
+	action := ActionCreated
+	var changes []types.SpecChange
 
 	if status != nil {
-		containerID = status.ID
-		needsRemoval := status.Status != driver.Running
+		p, err := plan(drv, spec, digest, imageDigest, status)
+		if err != nil {
+			return "", "", err
+		}
 
-		if status.Status == driver.Running {
-			hashLabel, ok := status.Labels[LabelSpecHash]
-			fmt.Println(configHash)
-			fmt.Println(hashLabel)
-			fmt.Println(ok)
-			if !ok || hashLabel != configHash {
-				needsRemoval = true
-				logger.Info().Str("id", containerID).Msg("recreating container")
-				err = drv.StopContainer(ctx, status.ID)
-				if err != nil {
-					return "", fmt.Errorf("failed to stop container: %w", err)
-				}
-			} else {
-				needsStart = false
-				logger.Info().Str("id", containerID).Msg("attaching to running container")
-			}
+		action = p.Action
+		changes = p.Changes
+
+		if force {
+			action = ActionRecreated
 		}
 
-		if needsRemoval {
-			logger.Info().Str("id", containerID).Msg("removing container")
-			err = drv.RemoveContainer(ctx, status.ID)
+		if action == ActionUnchanged {
+			logger.Info().Str("id", status.ID).Msg("attaching to running container")
+
+			err := ensureSidecars(ctx, drv, spec, status.ID, driverSpec.Labels[LabelSpecHash], n)
 			if err != nil {
-				return "", fmt.Errorf("failed to remove container: %w", err)
+				return "", "", err
 			}
-			containerID = ""
+
+			return status.ID, action, nil
 		}
 	}
 
-	if containerID == "" {
-		env := make(map[string]string, len(spec.Env))
-		for _, e := range spec.Env {
-			env[e.Name] = e.Value
+	// Sidecars of an outdated container, or left behind by one removed
+	// outside of sysctr, are removed before it.
+	sidecars, err := listSidecars(ctx, drv, spec)
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(sidecars) > 0 {
+		notify(ctx, n, sdnotify.Status("Removing sidecars"))
+		if err := removeSidecars(ctx, drv, spec, sidecars, false, 0); err != nil {
+			return "", "", err
 		}
+	}
 
-		volumes := make([]driver.Volume, len(spec.VolumeMounts))
-		for i, v := range spec.VolumeMounts {
-			ro := v.ReadOnly != nil && *v.ReadOnly
-			volumes[i] = driver.Volume{
-				Source:   v.Source,
-				Target:   v.Target,
-				ReadOnly: ro,
+	if status != nil {
+		if status.Status == driver.Running {
+			logger.Info().Str("id", status.ID).Strs("changes", changeStrings(changes)).Msg("recreating container")
+			notify(ctx, n, sdnotify.Status("Stopping outdated container"))
+			err = drv.StopContainer(ctx, status.ID, stopOptions(spec, 0))
+			if err != nil {
+				return "", "", fmt.Errorf("failed to stop container: %w", err)
 			}
 		}
 
-		containerID, err = drv.CreateContainer(ctx, &driver.Spec{
-			Name:        spec.Name,
-			Image:       spec.Image,
-			Command:     spec.Command,
-			Arguments:   spec.Args,
-			Environment: env,
-			Labels: map[string]string{
-				LabelSysCtr:   "true",
-				LabelName:     spec.Name,
-				LabelSpecHash: configHash,
-			},
-			Volumes: volumes,
-		})
-
+		logger.Info().Str("id", status.ID).Msg("removing container")
+		notify(ctx, n, sdnotify.Status("Removing container"))
+		err = drv.RemoveContainer(ctx, status.ID)
 		if err != nil {
-			return "", fmt.Errorf("failed to create container: %w", err)
+			return "", "", fmt.Errorf("failed to remove container: %w", err)
 		}
+	}
+
+	if err := addSecrets(driverSpec, secrets, stateDir); err != nil {
+		return "", "", fmt.Errorf("failed to store secrets: %w", err)
+	}
 
-		logger.Info().Str("id", containerID).Msg("created container")
+	// Rolled back containers are created from a kept image already.
+	if pin == nil {
+		keepImage(ctx, drv, spec, imageDigest)
 	}
 
-	if needsStart {
-		err = drv.StartContainer(ctx, containerID)
+	notify(ctx, n, sdnotify.Status("Creating container"))
+
+	containerID, err := drv.CreateContainer(ctx, driverSpec)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create container: %w", err)
+	}
+
+	logger.Info().Str("id", containerID).Msg("created container")
+
+	notify(ctx, n, sdnotify.Status("Starting container"))
+
+	err = drv.StartContainer(ctx, containerID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to start container: %w", err)
+	}
+
+	logger.Info().Str("id", containerID).Msg("container started")
+
+	if len(spec.Sidecars) > 0 {
+		notify(ctx, n, sdnotify.Status("Starting sidecars"))
+		err := ensureSidecars(ctx, drv, spec, containerID, driverSpec.Labels[LabelSpecHash], n)
 		if err != nil {
-			return "", fmt.Errorf("failed to start container: %w", err)
+			return "", "", err
 		}
-
-		logger.Info().Str("id", containerID).Msg("container started")
 	}
 
-	return containerID, nil
+	return containerID, action, nil
 }
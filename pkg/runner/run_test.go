@@ -0,0 +1,388 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/driver/fake"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+func newSpec(script string) *types.Spec {
+	return &types.Spec{
+		Name:    "test",
+		Image:   "busybox:latest",
+		Command: []string{"/bin/sh", "-c"},
+		Args:    []string{script},
+	}
+}
+
+func newDriver(t *testing.T, spec *types.Spec) *fake.FakeDriver {
+	t.Helper()
+
+	drv := fake.New()
+	if err := drv.PullImage(context.Background(), spec.Image); err != nil {
+		t.Fatalf("PullImage: %v", err)
+	}
+
+	return drv
+}
+
+func mustHashSpec(t *testing.T, drv driver.Driver, spec *types.Spec) string {
+	t.Helper()
+
+	hash, err := hashSpec(drv, spec, "")
+	if err != nil {
+		t.Fatalf("hashSpec: %v", err)
+	}
+
+	return hash
+}
+
+func labelsFor(spec *types.Spec) map[string]string {
+	return map[string]string{
+		LabelSysCtr: "true",
+		LabelName:   spec.Name,
+	}
+}
+
+func TestRunExitCode(t *testing.T) {
+	spec := newSpec("echo hello; exit 3")
+	drv := newDriver(t, spec)
+
+	exitCode, err := Run(context.Background(), drv, spec, RunOptions{Cleanup: true})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if exitCode != 3 {
+		t.Errorf("exit code: want 3, got %d", exitCode)
+	}
+
+	if _, err := drv.FindContainer(context.Background(), spec.Name, labelsFor(spec)); err != driver.ErrContainerNotFound {
+		t.Errorf("FindContainer: want ErrContainerNotFound, got %v", err)
+	}
+}
+
+func TestRunKeepsExitedContainer(t *testing.T) {
+	spec := newSpec("exit 3")
+	drv := newDriver(t, spec)
+
+	if _, err := Run(context.Background(), drv, spec, RunOptions{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// Without Cleanup the exited container is kept, to be inspected.
+	status, err := drv.FindContainer(context.Background(), spec.Name, labelsFor(spec))
+	if err != nil {
+		t.Fatalf("FindContainer: %v", err)
+	}
+
+	if status.Status != driver.Stopped || status.ExitCode != 3 {
+		t.Errorf("want stopped with code 3, got %s with code %d", status.Status, status.ExitCode)
+	}
+}
+
+func TestRunDrainsOutput(t *testing.T) {
+	spec := newSpec("")
+	drv := newDriver(t, spec)
+
+	// More output than a pipe buffers, so that writing it blocks until the
+	// output is read, and a last line written just before the container
+	// exits.
+	first := strings.Repeat("x", 1<<17) + "\n"
+	drv.SetProgram(spec.Image, func(ctx context.Context, stdout, stderr io.Writer) int {
+		io.WriteString(stdout, first)
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(stdout, "last\n")
+		return 0
+	})
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe: %v", err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	// The output is read once the container exited.
+	output := make(chan string, 1)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+
+	_, err = Run(context.Background(), drv, spec, RunOptions{Cleanup: true})
+	os.Stdout = stdout
+	w.Close()
+
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// Run reports the exit only once the output was written.
+	if out := <-output; out != first+"last\n" {
+		t.Errorf("output was not drained, got %d bytes", len(out))
+	}
+}
+
+func TestRunStopsContainerOnCancel(t *testing.T) {
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	if _, err := Run(ctx, drv, spec, RunOptions{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	status, err := drv.FindContainer(context.Background(), spec.Name, labelsFor(spec))
+	if err != nil {
+		t.Fatalf("FindContainer: %v", err)
+	}
+
+	if status.Status != driver.Stopped {
+		t.Errorf("status: want %s, got %s", driver.Stopped, status.Status)
+	}
+}
+
+// stoppingDriver calls stop once a container exited, before Run inspects
+// it for its exit code.
+type stoppingDriver struct {
+	*fake.FakeDriver
+	stop   func()
+	exited atomic.Bool
+}
+
+func (d *stoppingDriver) WaitForExit(ctx context.Context, id string) error {
+	err := d.FakeDriver.WaitForExit(ctx, id)
+	if err == nil {
+		d.exited.Store(true)
+	}
+
+	return err
+}
+
+func (d *stoppingDriver) ContainerStatus(ctx context.Context, id string) (*driver.Status, error) {
+	if d.exited.Load() {
+		d.stop()
+	}
+
+	return d.FakeDriver.ContainerStatus(ctx, id)
+}
+
+// TestRunExitsZeroOnStop checks that Run exits with 0 when the container
+// exits as sysctr is stopped, as when systemd signals every process of the
+// unit.
+func TestRunExitsZeroOnStop(t *testing.T) {
+	spec := newSpec("exit 143")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	drv := &stoppingDriver{FakeDriver: newDriver(t, spec), stop: cancel}
+
+	exitCode, err := Run(ctx, drv, spec, RunOptions{Cleanup: true})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if exitCode != 0 {
+		t.Errorf("exit code: want 0, got %d", exitCode)
+	}
+}
+
+func TestRunAttachesToRunningContainer(t *testing.T) {
+	ctx := context.Background()
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+
+	id := startContainer(t, drv, spec, mustHashSpec(t, drv, spec))
+
+	runCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	if _, err := Run(runCtx, drv, spec, RunOptions{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	status, err := drv.FindContainer(ctx, spec.Name, labelsFor(spec))
+	if err != nil {
+		t.Fatalf("FindContainer: %v", err)
+	}
+
+	if status.ID != id {
+		t.Errorf("container was recreated: want %s, got %s", id, status.ID)
+	}
+}
+
+func TestRunRecreatesOnSpecChange(t *testing.T) {
+	ctx := context.Background()
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+
+	id := startContainer(t, drv, spec, "stale")
+
+	runCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	if _, err := Run(runCtx, drv, spec, RunOptions{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	status, err := drv.FindContainer(ctx, spec.Name, labelsFor(spec))
+	if err != nil {
+		t.Fatalf("FindContainer: %v", err)
+	}
+
+	if status.ID == id {
+		t.Errorf("container was not recreated")
+	}
+
+	if hash := mustHashSpec(t, drv, spec); status.Labels[LabelSpecHash] != hash {
+		t.Errorf("spec hash label: want %s, got %s", hash, status.Labels[LabelSpecHash])
+	}
+}
+
+func startContainer(t *testing.T, drv driver.Driver, spec *types.Spec, hash string) string {
+	t.Helper()
+
+	ctx := context.Background()
+	labels := labelsFor(spec)
+	labels[LabelSpecHash] = hash
+
+	id, err := drv.CreateContainer(ctx, &driver.Spec{
+		Name:      spec.Name,
+		Image:     spec.Image,
+		Command:   spec.Command,
+		Arguments: spec.Args,
+		Labels:    labels,
+	})
+	if err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+
+	if err := drv.StartContainer(ctx, id); err != nil {
+		t.Fatalf("StartContainer: %v", err)
+	}
+
+	return id
+}
+
+func TestNewDriverNetwork(t *testing.T) {
+	network, err := newDriverNetwork(nil)
+	if err != nil || network.Mode != driver.NetworkHost {
+		t.Errorf("default: want host network, got %+v (%v)", network, err)
+	}
+
+	hostPort := 8080
+	network, err = newDriverNetwork(&types.Network{
+		Mode: types.NetworkModeBridge,
+		Ports: []types.PortMapping{
+			{ContainerPort: 80, HostPort: &hostPort},
+			{ContainerPort: 53, Protocol: types.PortMappingProtocolUdp},
+		},
+	})
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+
+	want := []driver.Port{
+		{ContainerPort: 80, HostPort: 8080, Protocol: "tcp"},
+		{ContainerPort: 53, HostPort: 53, Protocol: "udp"},
+	}
+
+	for i, p := range want {
+		if network.Ports[i] != p {
+			t.Errorf("port %d: want %+v, got %+v", i, p, network.Ports[i])
+		}
+	}
+
+	_, err = newDriverNetwork(&types.Network{
+		Mode:  types.NetworkModeHost,
+		Ports: []types.PortMapping{{ContainerPort: 80}},
+	})
+	if err == nil {
+		t.Errorf("host: want error publishing ports")
+	}
+}
+
+func TestNewDriverResources(t *testing.T) {
+	limit, reservation, pids := "512m", "256m", 100
+	res, err := newDriverResources(&types.Resources{
+		MemoryLimit:       &limit,
+		MemoryReservation: &reservation,
+		PidsLimit:         &pids,
+	})
+	if err != nil {
+		t.Fatalf("newDriverResources: %v", err)
+	}
+
+	if res.MemoryLimit != 512<<20 || res.MemoryReservation != 256<<20 || res.PidsLimit != 100 {
+		t.Errorf("unexpected resources: %+v", res)
+	}
+
+	reservation = "1g"
+	if _, err := newDriverResources(&types.Resources{MemoryLimit: &limit, MemoryReservation: &reservation}); err == nil {
+		t.Errorf("want error for reservation above limit")
+	}
+
+	invalid := "lots"
+	if _, err := newDriverResources(&types.Resources{MemoryLimit: &invalid}); err == nil {
+		t.Errorf("want error for invalid memory_limit")
+	}
+}
+
+func TestRunRecreatesOnVolumeChange(t *testing.T) {
+	ctx := context.Background()
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+
+	id := startContainer(t, drv, spec, mustHashSpec(t, drv, spec))
+
+	spec.VolumeMounts = []types.VolumeMount{{Source: "/srv/data", Target: "/data"}}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	if _, err := Run(runCtx, drv, spec, RunOptions{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	status, err := drv.FindContainer(ctx, spec.Name, labelsFor(spec))
+	if err != nil {
+		t.Fatalf("FindContainer: %v", err)
+	}
+
+	if status.ID == id {
+		t.Errorf("container was not recreated")
+	}
+}
+
+func TestRunInvalidSpec(t *testing.T) {
+	spec := newSpec("sleep 3600")
+	spec.Resources = &types.Resources{MemoryLimit: new(string)}
+	*spec.Resources.MemoryLimit = "lots"
+
+	drv := newDriver(t, spec)
+
+	var specErr *types.SpecError
+	if _, err := Run(context.Background(), drv, spec, RunOptions{}); !errors.As(err, &specErr) {
+		t.Fatalf("Run: want SpecError, got %v", err)
+	}
+
+	if specErr.Field != "memory_limit" {
+		t.Errorf("field: want memory_limit, got %s", specErr.Field)
+	}
+}
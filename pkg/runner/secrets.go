@@ -0,0 +1,312 @@
+package runner
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/types"
+	"golang.org/x/sys/unix"
+)
+
+// defaultSecretDir is where secrets are mounted in the container when the
+// spec does not say otherwise.
+const defaultSecretDir = "/run/secrets"
+
+// secret is a secret of a spec with its value. Values must never be logged.
+type secret struct {
+	types.Secret
+	value []byte
+}
+
+// secretsDir is where the secrets of a container mounted as files are stored
+// on the host.
+func secretsDir(stateDir, name string) string {
+	return filepath.Join(stateDir, name, "secrets")
+}
+
+// validateSecrets checks the secrets of spec without reading them.
+func validateSecrets(spec *types.Spec, env map[string]string) error {
+	names := make(map[string]bool, len(spec.Secrets))
+
+	for i, s := range spec.Secrets {
+		field := fmt.Sprintf("secrets[%d]", i)
+
+		if s.Name == "" || s.Name == "." || s.Name == ".." || strings.ContainsRune(s.Name, '/') {
+			return &types.SpecError{Field: field + ".name", Err: fmt.Errorf("invalid secret name %q", s.Name)}
+		}
+
+		if names[s.Name] {
+			return &types.SpecError{Field: field + ".name", Err: fmt.Errorf("duplicate secret %s", s.Name)}
+		}
+
+		names[s.Name] = true
+
+		sources := 0
+		for _, source := range []*string{s.Credential, s.File, s.Env} {
+			if source != nil {
+				sources++
+			}
+		}
+
+		if sources != 1 {
+			return &types.SpecError{Field: field, Err: errors.New("exactly one of credential, file and env must be set")}
+		}
+
+		if s.Target == nil {
+			continue
+		}
+
+		if s.Target.Env != nil {
+			if _, ok := env[*s.Target.Env]; ok {
+				return &types.SpecError{Field: field + ".target.env", Err: fmt.Errorf("%s is also set in env", *s.Target.Env)}
+			}
+		}
+
+		if s.Target.Path != nil && !path.IsAbs(*s.Target.Path) {
+			return &types.SpecError{Field: field + ".target.path", Err: errors.New("must be an absolute path")}
+		}
+	}
+
+	return nil
+}
+
+// readSecrets reads the values of the secrets of spec.
+func readSecrets(spec *types.Spec) ([]secret, error) {
+	secrets := make([]secret, len(spec.Secrets))
+
+	for i, s := range spec.Secrets {
+		value, err := readSecret(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret %s: %w", s.Name, err)
+		}
+
+		secrets[i] = secret{Secret: s, value: value}
+	}
+
+	return secrets, nil
+}
+
+func readSecret(s types.Secret) ([]byte, error) {
+	switch {
+	case s.Credential != nil:
+		dir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if dir == "" {
+			return nil, errors.New("$CREDENTIALS_DIRECTORY is not set, the credential must be passed with LoadCredential=")
+		}
+
+		return os.ReadFile(filepath.Join(dir, *s.Credential))
+	case s.File != nil:
+		return os.ReadFile(*s.File)
+	case s.Env != nil:
+		value, ok := os.LookupEnv(*s.Env)
+		if !ok {
+			return nil, fmt.Errorf("$%s is not set", *s.Env)
+		}
+
+		return []byte(value), nil
+	}
+
+	return nil, errors.New("secret has no source")
+}
+
+// secretsKeyFile is the file of the state directory holding the key of the
+// digests of secrets. Names of containers can not start with a dot.
+const secretsKeyFile = ".secrets.key"
+
+// readSecretsKey returns the key of the digests of secrets stored in
+// stateDir.
+func readSecretsKey(stateDir string) ([]byte, error) {
+	if stateDir == "" {
+		return nil, errors.New("a state directory is required to use secrets")
+	}
+
+	return os.ReadFile(filepath.Join(stateDir, secretsKeyFile))
+}
+
+// secretsKey returns the key of the digests of secrets stored in stateDir,
+// creating a random key if there is none. The digests are recorded on
+// containers, the key keeps secrets from being guessed from them.
+func secretsKey(stateDir string) ([]byte, error) {
+	key, err := readSecretsKey(stateDir)
+	if !errors.Is(err, os.ErrNotExist) {
+		return key, err
+	}
+
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return nil, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(stateDir, secretsKeyFile+".*")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(key)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Linking fails if another process created the key first, whose key
+	// is used instead.
+	err = os.Link(tmp.Name(), filepath.Join(stateDir, secretsKeyFile))
+	if errors.Is(err, os.ErrExist) {
+		return readSecretsKey(stateDir)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// secretsDigest returns a digest of the names and values of secrets keyed
+// by key, empty if there are none. It stands in for the values in the spec
+// hash.
+func secretsDigest(key []byte, secrets []secret) string {
+	if len(secrets) == 0 {
+		return ""
+	}
+
+	sorted := append([]secret{}, secrets...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	h := hmac.New(sha256.New, key)
+	for _, s := range sorted {
+		// Lengths keep name and value boundaries unambiguous.
+		fmt.Fprintf(h, "%d:%s%d:", len(s.Name), s.Name, len(s.value))
+		h.Write(s.value)
+	}
+
+	return "hmac-sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// recordedSecretsDigest returns the digest of the secrets of spec, falling
+// back to the digest recorded on the container when they or the key in
+// stateDir can not be read, e.g. because credentials are only available to
+// the unit.
+func recordedSecretsDigest(spec *types.Spec, stateDir string, labels map[string]string) string {
+	secrets, err := readSecrets(spec)
+	if err != nil {
+		return labels[LabelSecretsDigest]
+	}
+
+	if len(secrets) == 0 {
+		return ""
+	}
+
+	key, err := readSecretsKey(stateDir)
+	if err != nil {
+		return labels[LabelSecretsDigest]
+	}
+
+	return secretsDigest(key, secrets)
+}
+
+// addSecrets exposes secrets to the container of driverSpec, storing the
+// ones mounted as files in the state directory.
+func addSecrets(driverSpec *driver.Spec, secrets []secret, stateDir string) error {
+	if len(secrets) == 0 {
+		return nil
+	}
+
+	dir := secretsDir(stateDir, driverSpec.Name)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	for _, s := range secrets {
+		target := s.Target
+		if target == nil || (target.Env == nil && target.Path == nil) {
+			p := path.Join(defaultSecretDir, s.Name)
+			target = &types.SecretTarget{Path: &p}
+		}
+
+		if target.Env != nil {
+			if driverSpec.Environment == nil {
+				driverSpec.Environment = map[string]string{}
+			}
+
+			driverSpec.Environment[*target.Env] = string(s.value)
+		}
+
+		if target.Path == nil {
+			continue
+		}
+
+		if stateDir == "" {
+			return fmt.Errorf("secret %s: a state directory is required to mount secrets", s.Name)
+		}
+
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+
+		if err := checkTmpfs(dir); err != nil {
+			return fmt.Errorf("secret %s: %w", s.Name, err)
+		}
+
+		// The directory keeps other users of the host out, the file
+		// must be readable by any user of the container.
+		source := filepath.Join(dir, s.Name)
+		if err := os.WriteFile(source, s.value, 0444); err != nil {
+			return err
+		}
+
+		driverSpec.Volumes = append(driverSpec.Volumes, driver.Volume{
+			Source:   source,
+			Target:   *target.Path,
+			ReadOnly: true,
+		})
+	}
+
+	return nil
+}
+
+// checkTmpfs returns an error unless dir is on a file system kept in memory,
+// so that secret values are never written to disk.
+func checkTmpfs(dir string) error {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(dir, &fs); err != nil {
+		return err
+	}
+
+	if fs.Type != unix.TMPFS_MAGIC && fs.Type != unix.RAMFS_MAGIC {
+		return fmt.Errorf("%s is not on a tmpfs, state_dir must be on a tmpfs to mount secrets", dir)
+	}
+
+	return nil
+}
+
+// removeSecrets removes the secrets of a container from the state
+// directory.
+func removeSecrets(stateDir, name string) error {
+	if stateDir == "" || name == "" {
+		return nil
+	}
+
+	return os.RemoveAll(secretsDir(stateDir, name))
+}
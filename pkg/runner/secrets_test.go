@@ -0,0 +1,310 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// tmpfsDir returns a temporary directory on a tmpfs, where secrets may be
+// written, skipping the test if there is none.
+func tmpfsDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("/dev/shm", "sysctr-test-")
+	if err != nil {
+		t.Skipf("no tmpfs available: %v", err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if err := checkTmpfs(dir); err != nil {
+		t.Skipf("no tmpfs available: %v", err)
+	}
+
+	return dir
+}
+
+func TestValidateSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets []types.Secret
+		field   string
+	}{
+		{"valid", []types.Secret{{Name: "token", Env: strPtr("TOKEN")}}, ""},
+		{"invalid name", []types.Secret{{Name: "a/b", Env: strPtr("TOKEN")}}, "secrets[0].name"},
+		{"duplicate", []types.Secret{{Name: "token", Env: strPtr("A")}, {Name: "token", Env: strPtr("B")}}, "secrets[1].name"},
+		{"no source", []types.Secret{{Name: "token"}}, "secrets[0]"},
+		{"two sources", []types.Secret{{Name: "token", Env: strPtr("A"), File: strPtr("/a")}}, "secrets[0]"},
+		{"env clash", []types.Secret{{Name: "token", Env: strPtr("A"), Target: &types.SecretTarget{Env: strPtr("FOO")}}}, "secrets[0].target.env"},
+		{"relative path", []types.Secret{{Name: "token", Env: strPtr("A"), Target: &types.SecretTarget{Path: strPtr("token")}}}, "secrets[0].target.path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newSpec("true")
+			spec.Secrets = tt.secrets
+
+			err := validateSecrets(spec, map[string]string{"FOO": "bar"})
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("want no error, got %v", err)
+				}
+
+				return
+			}
+
+			var specErr *types.SpecError
+			if !errors.As(err, &specErr) || specErr.Field != tt.field {
+				t.Fatalf("want SpecError for %s, got %v", tt.field, err)
+			}
+		})
+	}
+}
+
+func TestReadSecrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "db"), []byte("credential"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("file"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+	t.Setenv("SYSCTR_TEST_SECRET", "env")
+
+	spec := newSpec("true")
+	spec.Secrets = []types.Secret{
+		{Name: "a", Credential: strPtr("db")},
+		{Name: "b", File: strPtr(filepath.Join(dir, "file"))},
+		{Name: "c", Env: strPtr("SYSCTR_TEST_SECRET")},
+	}
+
+	secrets, err := readSecrets(spec)
+	if err != nil {
+		t.Fatalf("readSecrets: %v", err)
+	}
+
+	for i, want := range []string{"credential", "file", "env"} {
+		if got := string(secrets[i].value); got != want {
+			t.Errorf("%s: want %q, got %q", secrets[i].Name, want, got)
+		}
+	}
+
+	spec.Secrets = []types.Secret{{Name: "missing", Env: strPtr("SYSCTR_TEST_UNSET")}}
+	if _, err := readSecrets(spec); err == nil {
+		t.Errorf("want error for unset variable")
+	}
+}
+
+func TestSecretsDigest(t *testing.T) {
+	key := []byte("key")
+	a := []secret{{Secret: types.Secret{Name: "a"}, value: []byte("1")}, {Secret: types.Secret{Name: "b"}, value: []byte("2")}}
+	b := []secret{a[1], a[0]}
+	c := []secret{{Secret: types.Secret{Name: "a"}, value: []byte("12")}, {Secret: types.Secret{Name: "b"}, value: []byte("")}}
+
+	if secretsDigest(key, nil) != "" {
+		t.Errorf("want empty digest without secrets")
+	}
+
+	if secretsDigest(key, a) != secretsDigest(key, b) {
+		t.Errorf("digest depends on the order of secrets")
+	}
+
+	if secretsDigest(key, a) == secretsDigest(key, c) {
+		t.Errorf("digest does not separate names and values")
+	}
+
+	if secretsDigest(key, a) == secretsDigest([]byte("other"), a) {
+		t.Errorf("digest does not depend on the key")
+	}
+}
+
+func TestSecretsKey(t *testing.T) {
+	stateDir := t.TempDir()
+
+	key, err := secretsKey(stateDir)
+	if err != nil {
+		t.Fatalf("secretsKey: %v", err)
+	}
+
+	if len(key) != 32 {
+		t.Errorf("want a 32 byte key, got %d bytes", len(key))
+	}
+
+	info, err := os.Stat(filepath.Join(stateDir, secretsKeyFile))
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key file: want mode 0600, got %o", info.Mode().Perm())
+	}
+
+	again, err := secretsKey(stateDir)
+	if err != nil {
+		t.Fatalf("secretsKey: %v", err)
+	}
+
+	if !bytes.Equal(key, again) {
+		t.Errorf("key changed once stored")
+	}
+
+	if _, err := secretsKey(""); err == nil {
+		t.Errorf("want error without a state directory")
+	}
+}
+
+func TestAddSecrets(t *testing.T) {
+	stateDir := tmpfsDir(t)
+	driverSpec := &driver.Spec{Name: "test"}
+
+	secrets := []secret{
+		{Secret: types.Secret{Name: "token", Target: &types.SecretTarget{Env: strPtr("TOKEN")}}, value: []byte("s3cret")},
+		{Secret: types.Secret{Name: "key"}, value: []byte("private")},
+	}
+
+	if err := addSecrets(driverSpec, secrets, stateDir); err != nil {
+		t.Fatalf("addSecrets: %v", err)
+	}
+
+	if driverSpec.Environment["TOKEN"] != "s3cret" {
+		t.Errorf("env: want s3cret, got %q", driverSpec.Environment["TOKEN"])
+	}
+
+	if len(driverSpec.Volumes) != 1 {
+		t.Fatalf("want 1 volume, got %d", len(driverSpec.Volumes))
+	}
+
+	v := driverSpec.Volumes[0]
+	if v.Target != "/run/secrets/key" || !v.ReadOnly {
+		t.Errorf("unexpected volume %+v", v)
+	}
+
+	data, err := os.ReadFile(v.Source)
+	if err != nil || string(data) != "private" {
+		t.Errorf("secret file: want private, got %q (%v)", data, err)
+	}
+
+	if err := removeSecrets(stateDir, "test"); err != nil {
+		t.Fatalf("removeSecrets: %v", err)
+	}
+
+	if _, err := os.Stat(v.Source); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("secret file was not removed: %v", err)
+	}
+
+	if err := addSecrets(&driver.Spec{Name: "test"}, secrets, ""); err == nil {
+		t.Errorf("want error without a state directory")
+	}
+}
+
+func TestAddSecretsRequiresTmpfs(t *testing.T) {
+	stateDir := t.TempDir()
+	if checkTmpfs(stateDir) == nil {
+		t.Skip("the temporary directory is on a tmpfs")
+	}
+
+	secrets := []secret{{Secret: types.Secret{Name: "key"}, value: []byte("private")}}
+	if err := addSecrets(&driver.Spec{Name: "test"}, secrets, stateDir); err == nil {
+		t.Fatal("want error when the state directory is not on a tmpfs")
+	}
+
+	if _, err := os.Stat(filepath.Join(secretsDir(stateDir, "test"), "key")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("secret was written outside of a tmpfs: %v", err)
+	}
+
+	// Secrets only exposed as environment variables are not written.
+	secrets[0].Target = &types.SecretTarget{Env: strPtr("KEY")}
+	if err := addSecrets(&driver.Spec{Name: "test"}, secrets, stateDir); err != nil {
+		t.Errorf("addSecrets: %v", err)
+	}
+}
+
+func TestRunRecreatesOnSecretChange(t *testing.T) {
+	ctx := context.Background()
+	stateDir := tmpfsDir(t)
+
+	spec := newSpec("sleep 3600")
+	spec.Secrets = []types.Secret{{Name: "token", Env: strPtr("SYSCTR_TEST_SECRET")}}
+	drv := newDriver(t, spec)
+
+	t.Setenv("SYSCTR_TEST_SECRET", "first")
+
+	id, _, err := run(ctx, drv, spec, stateDir, nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	_, action, err := run(ctx, drv, spec, stateDir, nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if action != ActionUnchanged {
+		t.Errorf("same secret: want %s, got %s", ActionUnchanged, action)
+	}
+
+	t.Setenv("SYSCTR_TEST_SECRET", "second")
+
+	p, err := PlanRun(ctx, drv, spec, PlanOptions{StateDir: stateDir})
+	if err != nil {
+		t.Fatalf("PlanRun: %v", err)
+	}
+
+	if p.Action != ActionRecreated || !p.SecretsChanged || len(p.Changes) != 0 {
+		t.Errorf("changed secret: unexpected plan %+v", p)
+	}
+
+	newID, action, err := run(ctx, drv, spec, stateDir, nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if action != ActionRecreated || newID == id {
+		t.Errorf("changed secret: want a new container, got %s %s", action, newID)
+	}
+
+	// Secret values are never recorded on the container.
+	status, err := drv.ContainerStatus(ctx, newID)
+	if err != nil {
+		t.Fatalf("ContainerStatus: %v", err)
+	}
+
+	for k, v := range status.Labels {
+		if strings.Contains(v, "second") {
+			t.Errorf("label %s contains the secret", k)
+		}
+	}
+
+	for k, v := range status.Annotations {
+		if strings.Contains(v, "second") {
+			t.Errorf("annotation %s contains the secret", k)
+		}
+	}
+
+	// Without access to the secret, the recorded digest is used.
+	os.Unsetenv("SYSCTR_TEST_SECRET")
+
+	p, err = PlanRun(ctx, drv, spec, PlanOptions{StateDir: stateDir})
+	if err != nil {
+		t.Fatalf("PlanRun: %v", err)
+	}
+
+	if p.Drifted {
+		t.Errorf("unreadable secret: unexpected plan %+v", p)
+	}
+}
@@ -0,0 +1,118 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+// DefaultStateDir holds the runtime state sysctr keeps about its containers,
+// such as their health, so that it can be reported by other invocations.
+const DefaultStateDir = "/run/sysctr"
+
+// healthState is the health of a container as stored in the state
+// directory.
+type healthState struct {
+	ContainerID string       `json:"container_id"`
+	Health      types.Health `json:"health"`
+}
+
+func healthStatePath(stateDir, name string) string {
+	return filepath.Join(stateDir, name, "health.json")
+}
+
+func writeHealthState(stateDir, name, containerID string, health types.Health) error {
+	return writeState(healthStatePath(stateDir, name), healthState{
+		ContainerID: containerID,
+		Health:      health,
+	})
+}
+
+// readHealthState returns the stored health of the container, nil if none
+// was stored for it.
+func readHealthState(stateDir, name, containerID string) (*types.Health, error) {
+	var state healthState
+	err := readState(healthStatePath(stateDir, name), &state)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if state.ContainerID != containerID {
+		return nil, nil
+	}
+
+	return &state.Health, nil
+}
+
+// restartState is the number of times Run restarted a container, as stored
+// in the state directory.
+type restartState struct {
+	ContainerID string `json:"container_id"`
+	Count       int    `json:"count"`
+}
+
+func restartStatePath(stateDir, name string) string {
+	return filepath.Join(stateDir, name, "restarts.json")
+}
+
+func writeRestartState(stateDir, name, containerID string, count int) error {
+	return writeState(restartStatePath(stateDir, name), restartState{
+		ContainerID: containerID,
+		Count:       count,
+	})
+}
+
+// readRestartState returns the stored restart count of the container, nil
+// if none was stored for it.
+func readRestartState(stateDir, name, containerID string) (*int, error) {
+	var state restartState
+	err := readState(restartStatePath(stateDir, name), &state)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if state.ContainerID != containerID {
+		return nil, nil
+	}
+
+	return &state.Count, nil
+}
+
+// writeState atomically replaces the state file at path.
+func writeState(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func readState(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -2,41 +2,101 @@ package runner
 
 import (
 	"context"
-	"os"
 
-	"github.com/rs/zerolog"
 	"github.com/tmacro/sysctr/pkg/driver"
 	"github.com/tmacro/sysctr/pkg/types"
 )
 
-func Status(ctx context.Context, drv driver.Driver, spec *types.Spec) (types.ContainerState, error) {
-	logger := zerolog.Ctx(ctx)
+type StatusOptions struct {
+	// StateDir is where Run stores the health and restart count of the
+	// container.
+	StateDir string
+}
 
+func Status(ctx context.Context, drv driver.Driver, spec *types.Spec, opts StatusOptions) (types.ContainerState, error) {
 	container, err := drv.FindContainer(ctx, spec.Name, map[string]string{
 		LabelSysCtr: "true",
 		LabelName:   spec.Name,
 	})
 
-	if err == driver.ErrContainerNotFound {
-		logger.Info().Msg("container not found")
-		os.Exit(1)
+	if err != nil {
+		return types.ContainerState{}, err
+	}
+
+	status := containerState(container)
+
+	drifted, err := specChanged(drv, spec, recordedSecretsDigest(spec, opts.StateDir, container.Labels), container.Labels)
+	if err != nil {
+		return types.ContainerState{}, err
 	}
 
+	imageDigest, err := localImageDigest(ctx, drv, spec)
 	if err != nil {
 		return types.ContainerState{}, err
 	}
 
-	hashLabel := container.Labels[LabelSpecHash]
+	drifted = drifted || imageChanged(imageDigest, container.Labels)
+	status.Drifted = &drifted
+
+	if spec.Healthcheck != nil && container.Status == driver.Running && opts.StateDir != "" {
+		status.Health, err = readHealthState(opts.StateDir, spec.Name, container.ID)
+		if err != nil {
+			return types.ContainerState{}, err
+		}
+	}
+
+	if spec.Restart != nil && opts.StateDir != "" {
+		status.RestartCount, err = readRestartState(opts.StateDir, spec.Name, container.ID)
+		if err != nil {
+			return types.ContainerState{}, err
+		}
+	}
+
+	return status, nil
+}
+
+// List returns the state of every container managed by sysctr.
+func List(ctx context.Context, drv driver.Driver) ([]types.ContainerState, error) {
+	containers, err := drv.ListContainers(ctx, map[string]string{
+		LabelSysCtr: "true",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]types.ContainerState, len(containers))
+	for i := range containers {
+		states[i] = containerState(&containers[i])
+	}
+
+	return states, nil
+}
+
+func containerState(container *driver.Status) types.ContainerState {
+	name := container.Labels[LabelName]
+	if name == "" {
+		name = container.Name
+	}
 
 	status := types.ContainerState{
 		Id:         container.ID,
+		Name:       name,
+		Image:      container.Image,
 		Status:     container.Status.String(),
-		ConfigHash: hashLabel,
+		ConfigHash: container.Labels[LabelSpecHash],
+	}
+
+	if digest := container.Labels[LabelImageDigest]; digest != "" {
+		status.ImageDigest = &digest
 	}
 
 	if container.Status == driver.Stopped {
 		status.ExitCode = &container.ExitCode
 	}
 
-	return status, nil
+	if container.Status == driver.Running && !container.StartedAt.IsZero() {
+		status.StartedAt = &container.StartedAt
+	}
+
+	return status
 }
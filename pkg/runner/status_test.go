@@ -0,0 +1,103 @@
+package runner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+
+	running := newSpec("sleep 3600")
+	drv := newDriver(t, running)
+	startContainer(t, drv, running, mustHashSpec(t, drv, running))
+
+	exited := newSpec("exit 3")
+	exited.Name = "exited"
+	id := startContainer(t, drv, exited, mustHashSpec(t, drv, exited))
+	if err := drv.WaitForExit(ctx, id); err != nil {
+		t.Fatalf("WaitForExit: %v", err)
+	}
+
+	// Not managed by sysctr.
+	if _, err := drv.CreateContainer(ctx, &driver.Spec{Name: "other", Image: running.Image}); err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+
+	states, err := List(ctx, drv)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	if len(states) != 2 {
+		t.Fatalf("want 2 containers, got %d", len(states))
+	}
+
+	for _, state := range states {
+		switch state.Name {
+		case running.Name:
+			if state.Status != driver.Running.String() || state.StartedAt == nil || state.ExitCode != nil {
+				t.Errorf("running container: unexpected state %+v", state)
+			}
+		case exited.Name:
+			if state.Status != driver.Stopped.String() || state.ExitCode == nil || *state.ExitCode != 3 {
+				t.Errorf("exited container: unexpected state %+v", state)
+			}
+		default:
+			t.Errorf("unexpected container %s", state.Name)
+		}
+
+		if state.Image != running.Image {
+			t.Errorf("image: want %s, got %s", running.Image, state.Image)
+		}
+
+		if state.ConfigHash == "" {
+			t.Errorf("%s: missing spec hash", state.Name)
+		}
+	}
+}
+
+func TestStatusHealth(t *testing.T) {
+	ctx := context.Background()
+	spec := newSpec("sleep 3600")
+	spec.Healthcheck = &types.Healthcheck{Tcp: &types.TcpProbe{Port: 80}}
+
+	drv := newDriver(t, spec)
+	id := startContainer(t, drv, spec, mustHashSpec(t, drv, spec))
+
+	stateDir := t.TempDir()
+	opts := StatusOptions{StateDir: stateDir}
+
+	state, err := Status(ctx, drv, spec, opts)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+
+	if state.Health != nil {
+		t.Errorf("health: want none before the first probe, got %+v", state.Health)
+	}
+
+	if err := writeHealthState(stateDir, spec.Name, "previous", types.Health{Status: types.HealthStatusUnhealthy}); err != nil {
+		t.Fatal(err)
+	}
+
+	if state, _ := Status(ctx, drv, spec, opts); state.Health != nil {
+		t.Errorf("health: want none for a previous container, got %+v", state.Health)
+	}
+
+	if err := writeHealthState(stateDir, spec.Name, id, types.Health{Status: types.HealthStatusHealthy}); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = Status(ctx, drv, spec, opts)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+
+	if state.Health == nil || state.Health.Status != types.HealthStatusHealthy {
+		t.Errorf("health: want %s, got %+v", types.HealthStatusHealthy, state.Health)
+	}
+}
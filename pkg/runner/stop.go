@@ -2,33 +2,74 @@ package runner
 
 import (
 	"context"
-	"os"
+	"time"
 
-	"github.com/rs/zerolog"
 	"github.com/tmacro/sysctr/pkg/driver"
 	"github.com/tmacro/sysctr/pkg/types"
 )
 
+// stopGracePeriod is the extra time given to the driver to kill and reap a
+// container once its stop timeout has elapsed.
+const stopGracePeriod = 5 * time.Second
+
 type StopOptions struct {
+	// Timeout in seconds before the container is killed. Overrides the
+	// stop_timeout of the spec when non-zero.
 	Timeout int
 }
 
 func Stop(ctx context.Context, drv driver.Driver, spec *types.Spec, opts StopOptions) error {
-	logger := zerolog.Ctx(ctx)
-
 	status, err := drv.FindContainer(ctx, spec.Name, map[string]string{
 		LabelSysCtr: "true",
 		LabelName:   spec.Name,
 	})
 
-	if err == driver.ErrContainerNotFound {
-		logger.Info().Msg("container not found")
-		os.Exit(1)
+	if err != nil {
+		return err
 	}
 
+	sidecars, err := sidecarIDs(ctx, drv, spec)
 	if err != nil {
 		return err
 	}
 
-	return drv.StopContainer(ctx, status.ID)
+	// Sidecars are stopped first, in the reverse of their start order.
+	for i := len(sidecars) - 1; i >= 0; i-- {
+		err := drv.StopContainer(ctx, sidecars[i], stopOptions(spec, opts.Timeout))
+		if err != nil {
+			return err
+		}
+	}
+
+	return drv.StopContainer(ctx, status.ID, stopOptions(spec, opts.Timeout))
+}
+
+// StopTimeout returns the longest time stopping the container of spec may
+// take, including killing it once its stop timeout elapsed. Sidecars are
+// stopped one after the other before it.
+func StopTimeout(spec *types.Spec) time.Duration {
+	return time.Duration(len(spec.Sidecars)+1) * (stopOptions(spec, 0).Timeout + stopGracePeriod)
+}
+
+// stopOptions returns the options used to stop the container of spec. A
+// non-zero timeout in seconds takes precedence over the spec.
+func stopOptions(spec *types.Spec, timeout int) driver.StopOptions {
+	opts := driver.StopOptions{
+		Signal:  driver.DefaultStopSignal,
+		Timeout: driver.DefaultStopTimeout,
+	}
+
+	if spec.StopSignal != nil && *spec.StopSignal != "" {
+		opts.Signal = *spec.StopSignal
+	}
+
+	if spec.StopTimeout != nil {
+		opts.Timeout = time.Duration(*spec.StopTimeout) * time.Second
+	}
+
+	if timeout > 0 {
+		opts.Timeout = time.Duration(timeout) * time.Second
+	}
+
+	return opts
 }
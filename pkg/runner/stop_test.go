@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+)
+
+func TestStopKillsAfterTimeout(t *testing.T) {
+	ctx := context.Background()
+	spec := newSpec("ignored")
+	drv := newDriver(t, spec)
+
+	// The program ignores the stop signal.
+	drv.SetProgram(spec.Image, func(ctx context.Context, stdout, stderr io.Writer) int {
+		time.Sleep(time.Minute)
+		return 0
+	})
+
+	timeout := 1
+	spec.StopTimeout = &timeout
+
+	startContainer(t, drv, spec, mustHashSpec(t, drv, spec))
+
+	start := time.Now()
+	if err := Stop(ctx, drv, spec, StopOptions{}); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 5*time.Second {
+		t.Errorf("Stop took %s, want about 1s", elapsed)
+	}
+
+	status, err := drv.FindContainer(ctx, spec.Name, labelsFor(spec))
+	if err != nil {
+		t.Fatalf("FindContainer: %v", err)
+	}
+
+	if status.Status != driver.Stopped || status.ExitCode != 137 {
+		t.Errorf("want stopped with exit code 137, got %s with %d", status.Status, status.ExitCode)
+	}
+}
+
+func TestStopOptions(t *testing.T) {
+	spec := newSpec("")
+
+	opts := stopOptions(spec, 0)
+	if opts.Signal != driver.DefaultStopSignal || opts.Timeout != driver.DefaultStopTimeout {
+		t.Errorf("defaults: got %+v", opts)
+	}
+
+	signal, timeout := "SIGINT", 30
+	spec.StopSignal = &signal
+	spec.StopTimeout = &timeout
+
+	opts = stopOptions(spec, 0)
+	if opts.Signal != "SIGINT" || opts.Timeout != 30*time.Second {
+		t.Errorf("spec: got %+v", opts)
+	}
+
+	if opts = stopOptions(spec, 5); opts.Timeout != 5*time.Second {
+		t.Errorf("override: got %+v", opts)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	ctx := context.Background()
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+
+	if err := Stop(ctx, drv, spec, StopOptions{}); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("Stop: want ErrContainerNotFound, got %v", err)
+	}
+
+	if err := Remove(ctx, drv, spec, RemoveOptions{}); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("Remove: want ErrContainerNotFound, got %v", err)
+	}
+
+	if _, err := Status(ctx, drv, spec, StatusOptions{}); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("Status: want ErrContainerNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,375 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/rs/zerolog"
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+// DefaultUpdateWindow is how long a container without a healthcheck must
+// keep running after an update before it is considered healthy.
+const DefaultUpdateWindow = 10 * time.Second
+
+type UpdateOptions struct {
+	// StateDir is where secrets mounted as files are stored, and where the
+	// lock coordinating with Run is kept.
+	StateDir string
+	// Window is how long a container without a healthcheck must keep
+	// running after it was updated. Defaults to DefaultUpdateWindow.
+	Window time.Duration
+}
+
+// UpdateResult is the outcome of Update for a single container.
+type UpdateResult struct {
+	Name   string `json:"name"`
+	ID     string `json:"id,omitempty"`
+	Action Action `json:"action"`
+	// PreviousDigest is the digest of the image the container was created
+	// from before the update.
+	PreviousDigest string `json:"previous_digest,omitempty"`
+	// Digest is the digest of the image the container now runs.
+	Digest string `json:"digest,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Update pulls the image of spec and, if its digest differs from the image
+// the container was created from, recreates the container from it. When
+// the new container fails its first health window, the container is
+// recreated from the previous image and ErrRolledBack is returned. The
+// previous image is kept under a tag of its own when the container is
+// created, so that rollbacks need no registry; the image pinned to its
+// digest is pulled otherwise. The rolled back container keeps the previous
+// image, and Update skips the image it was rolled back from, until the
+// image of spec changes again. Images are only inspected when the pull
+// policy of spec is never, so that images loaded offline can be rolled out.
+//
+// A Run supervising the container waits for the update to finish and
+// supervises the container it leaves behind.
+//
+// The health window ends with the first result of the healthcheck of spec:
+// the update fails if the container is unhealthy, regardless of the action
+// on failure. Containers without a healthcheck must keep running for the
+// window of opts.
+func Update(ctx context.Context, drv driver.Driver, spec *types.Spec, opts UpdateOptions) (UpdateResult, error) {
+	if err := validateSpec(drv, spec); err != nil {
+		return UpdateResult{Name: spec.Name, Action: ActionFailed, Error: err.Error()}, err
+	}
+
+	result, err := update(ctx, drv, spec, opts)
+	if err != nil && result.Action == "" {
+		result.Action = ActionFailed
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result, err
+}
+
+// UpdateAll updates the containers of specs. A failure to update one
+// container does not stop the others; the results report every container
+// and the returned error joins the failures.
+func UpdateAll(ctx context.Context, drv driver.Driver, specs []*types.Spec, opts UpdateOptions) ([]UpdateResult, error) {
+	logger := zerolog.Ctx(ctx)
+
+	// Invalid specs are rejected before any container is touched.
+	for _, spec := range specs {
+		if err := validateSpec(drv, spec); err != nil {
+			return nil, fmt.Errorf("%s: %w", spec.Name, err)
+		}
+	}
+
+	results := make([]UpdateResult, 0, len(specs))
+	var errs []error
+
+	for _, spec := range specs {
+		specLogger := logger.With().Str("name", spec.Name).Logger()
+
+		result, err := Update(specLogger.WithContext(ctx), drv, spec, opts)
+		if err != nil {
+			specLogger.Error().Err(err).Msg("failed to update container")
+			errs = append(errs, fmt.Errorf("%s: %w", spec.Name, err))
+		}
+
+		results = append(results, result)
+	}
+
+	return results, errors.Join(errs...)
+}
+
+func update(ctx context.Context, drv driver.Driver, spec *types.Spec, opts UpdateOptions) (UpdateResult, error) {
+	logger := zerolog.Ctx(ctx)
+	result := UpdateResult{Name: spec.Name}
+
+	unlock, err := lockContainer(ctx, opts.StateDir, spec.Name)
+	if err != nil {
+		return result, fmt.Errorf("failed to lock container: %w", err)
+	}
+
+	defer unlock()
+
+	status, err := drv.FindContainer(ctx, spec.Name, map[string]string{
+		LabelSysCtr: "true",
+		LabelName:   spec.Name,
+	})
+	if errors.Is(err, driver.ErrContainerNotFound) {
+		return result, err
+	}
+
+	if err != nil {
+		return result, fmt.Errorf("failed to fetch containers: %w", err)
+	}
+
+	result.ID = status.ID
+	result.PreviousDigest = status.Labels[LabelImageDigest]
+
+	// Containers created by older releases of sysctr did not keep their
+	// image.
+	keepImage(ctx, drv, spec, result.PreviousDigest)
+
+	// The image is pulled even if it is present, unless the spec forbids
+	// pulling it.
+	pull := *spec
+	if pullPolicy(spec) != types.SpecPullPolicyNever {
+		always := types.SpecPullPolicyAlways
+		pull.PullPolicy = &always
+	}
+
+	result.Digest, err = pullImage(ctx, drv, &pull, nil)
+	if err != nil {
+		return result, err
+	}
+
+	if result.Digest == result.PreviousDigest {
+		logger.Info().Str("id", status.ID).Str("digest", result.Digest).Msg("image is up to date")
+		result.Action = ActionUnchanged
+		return result, nil
+	}
+
+	if result.Digest == status.Labels[LabelRollbackDigest] {
+		logger.Info().Str("id", status.ID).Str("digest", result.Digest).Msg("skipping image the container was rolled back from")
+		result.Action = ActionUnchanged
+		result.Digest = result.PreviousDigest
+		return result, nil
+	}
+
+	logger.Info().Str("id", status.ID).Str("previous_digest", result.PreviousDigest).Str("digest", result.Digest).Msg("updating container")
+
+	// The image was just pulled, run must not pull it again.
+	never := types.SpecPullPolicyNever
+	current := *spec
+	current.PullPolicy = &never
+
+	result.ID, _, err = run(ctx, drv, &current, opts.StateDir, nil)
+	if err != nil {
+		return result, err
+	}
+
+	healthErr := checkUpdate(ctx, drv, spec, result.ID, opts.Window)
+	if healthErr == nil {
+		logger.Info().Str("id", result.ID).Msg("container updated")
+		result.Action = ActionUpdated
+		return result, nil
+	}
+
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+
+	// Containers created by older releases of sysctr do not record the
+	// digest of their image.
+	if result.PreviousDigest == "" {
+		return result, fmt.Errorf("updated container failed and the previous image is unknown: %w", healthErr)
+	}
+
+	logger.Warn().Err(healthErr).Str("id", result.ID).Str("digest", result.PreviousDigest).Msg("rolling back container")
+
+	result.ID, _, err = converge(ctx, drv, spec, opts.StateDir, nil, &imagePin{
+		Digest:     result.PreviousDigest,
+		RolledBack: result.Digest,
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to roll back: %w", err)
+	}
+
+	result.Action = ActionRolledBack
+	result.Digest = result.PreviousDigest
+
+	return result, fmt.Errorf("%w: %w", ErrRolledBack, healthErr)
+}
+
+// pinImage returns image pinned to digest, e.g. busybox@sha256:<digest>.
+func pinImage(image, digest string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+
+	return reference.FamiliarName(named) + "@" + digest, nil
+}
+
+// keptImage returns the reference the image with digest is kept under by
+// keepImage, e.g. busybox:sysctr-rollback-sha256-<hex>.
+func keptImage(image, digest string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+
+	tagged, err := reference.WithTag(reference.TrimNamed(named), "sysctr-rollback-"+strings.Replace(digest, ":", "-", 1))
+	if err != nil {
+		return "", err
+	}
+
+	return reference.FamiliarString(tagged), nil
+}
+
+// keepImage tags the local image of spec, if its digest is digest, so that
+// containers can be rolled back to it once the image of spec is pulled or
+// loaded again. Images loaded offline or inspected by ID can not be pulled
+// by their digest. Drivers unable to tag images roll back by pulling the
+// image pinned to its digest.
+func keepImage(ctx context.Context, drv driver.Driver, spec *types.Spec, digest string) {
+	tagger, ok := drv.(driver.ImageTagger)
+	if !ok || digest == "" {
+		return
+	}
+
+	logger := zerolog.Ctx(ctx)
+
+	local, err := localImageDigest(ctx, drv, spec)
+	if err != nil || local != digest {
+		return
+	}
+
+	kept, err := keptImage(spec.Image, digest)
+	if err == nil {
+		err = tagger.TagImage(ctx, spec.Image, kept)
+	}
+
+	if err != nil {
+		logger.Warn().Err(err).Str("image", spec.Image).Str("digest", digest).Msg("failed to keep image for rollbacks")
+	}
+}
+
+// previousImage returns the spec of the image with digest a container is
+// rolled back to: the image kept by keepImage if it is present, the image
+// of spec pinned to digest otherwise.
+func previousImage(ctx context.Context, drv driver.Driver, spec *types.Spec, digest string) (*types.Spec, error) {
+	previous := *spec
+
+	kept, err := keptImage(spec.Image, digest)
+	if err != nil {
+		return nil, &types.SpecError{Field: "image", Err: err}
+	}
+
+	previous.Image = kept
+
+	local, err := localImageDigest(ctx, drv, &previous)
+	if err != nil {
+		return nil, err
+	}
+
+	if local == digest {
+		// The kept image only exists locally.
+		never := types.SpecPullPolicyNever
+		previous.PullPolicy = &never
+		return &previous, nil
+	}
+
+	previous.Image, err = pinImage(spec.Image, digest)
+	if err != nil {
+		return nil, &types.SpecError{Field: "image", Err: err}
+	}
+
+	return &previous, nil
+}
+
+// checkUpdate waits for the first health window of the container of spec to
+// end and returns an error if the container exited with a non-zero code or
+// became unhealthy within it.
+func checkUpdate(ctx context.Context, drv driver.Driver, spec *types.Spec, containerID string, window time.Duration) error {
+	monitor, err := newHealthMonitor(drv, spec.Healthcheck)
+	if err != nil {
+		return err
+	}
+
+	if window == 0 {
+		window = DefaultUpdateWindow
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Every sender may report once.
+	results := make(chan error, 3)
+
+	go func() {
+		err := drv.WaitForExit(ctx, containerID)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			results <- fmt.Errorf("failed to wait for container to exit: %w", err)
+			return
+		}
+
+		status, err := drv.ContainerStatus(ctx, containerID)
+		if err != nil {
+			results <- fmt.Errorf("failed to get container status: %w", err)
+			return
+		}
+
+		if status.ExitCode != 0 {
+			results <- fmt.Errorf("container exited with code %d", status.ExitCode)
+			return
+		}
+
+		results <- nil
+	}()
+
+	if monitor == nil {
+		select {
+		case err := <-results:
+			return err
+		case <-time.After(window):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// The first unhealthy result ends the window, whatever the action on
+	// failure of the healthcheck.
+	monitor.onFailure = types.HealthcheckOnFailureExit
+
+	healthy := false
+	monitor.onChange = func(health types.Health) {
+		if health.Status == types.HealthStatusHealthy && !healthy {
+			healthy = true
+			results <- nil
+		}
+	}
+
+	go func() {
+		if err := monitor.run(ctx, containerID); err != nil {
+			results <- ErrUnhealthy
+		}
+	}()
+
+	select {
+	case err := <-results:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
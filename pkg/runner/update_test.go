@@ -0,0 +1,321 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tmacro/sysctr/pkg/driver"
+	"github.com/tmacro/sysctr/pkg/driver/fake"
+	"github.com/tmacro/sysctr/pkg/types"
+)
+
+var testUpdateOptions = UpdateOptions{Window: 100 * time.Millisecond}
+
+// runForUpdate runs the container of spec and returns its ID and the digest
+// of its image.
+func runForUpdate(t *testing.T, drv driver.Driver, spec *types.Spec) (string, string) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	id, _, err := run(ctx, drv, spec, "", nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	status, err := drv.ContainerStatus(ctx, id)
+	if err != nil {
+		t.Fatalf("ContainerStatus: %v", err)
+	}
+
+	return id, status.Labels[LabelImageDigest]
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+	id, first := runForUpdate(t, drv, spec)
+
+	result, err := Update(ctx, drv, spec, testUpdateOptions)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if result.Action != ActionUnchanged || result.ID != id {
+		t.Errorf("same image: unexpected result %+v", result)
+	}
+
+	// A new version of the tag is pushed to the registry.
+	drv.SetImageDigest(spec.Image, testDigest)
+
+	result, err = Update(ctx, drv, spec, testUpdateOptions)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if result.Action != ActionUpdated || result.ID == id || result.PreviousDigest != first || result.Digest != testDigest {
+		t.Errorf("new image: unexpected result %+v", result)
+	}
+
+	status, err := drv.ContainerStatus(ctx, result.ID)
+	if err != nil {
+		t.Fatalf("ContainerStatus: %v", err)
+	}
+
+	if status.Status != driver.Running || status.Labels[LabelImageDigest] != testDigest {
+		t.Errorf("updated container: unexpected status %+v", status)
+	}
+}
+
+func TestUpdateRollback(t *testing.T) {
+	ctx := context.Background()
+
+	spec := newSpec("sleep 3600")
+	spec.Healthcheck = &types.Healthcheck{
+		Exec:     &types.ExecProbe{Command: []string{"true"}},
+		Interval: 1,
+		Retries:  1,
+	}
+
+	drv := newDriver(t, spec)
+	_, first := runForUpdate(t, drv, spec)
+
+	// The new version of the image never becomes healthy.
+	drv.SetImageDigest(spec.Image, testDigest)
+	drv.SetExec(spec.Image, func(ctx context.Context, command []string, stdin io.Reader, stdout, stderr io.Writer) int {
+		return 1
+	})
+
+	result, err := Update(ctx, drv, spec, testUpdateOptions)
+	if !errors.Is(err, ErrRolledBack) {
+		t.Fatalf("Update: want ErrRolledBack, got %v", err)
+	}
+
+	if result.Action != ActionRolledBack || result.Digest != first {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	status, err := drv.ContainerStatus(ctx, result.ID)
+	if err != nil {
+		t.Fatalf("ContainerStatus: %v", err)
+	}
+
+	kept, err := keptImage(spec.Image, first)
+	if err != nil {
+		t.Fatalf("keptImage: %v", err)
+	}
+
+	if status.Status != driver.Running || status.Image != kept || status.Labels[LabelImageDigest] != first {
+		t.Errorf("rolled back container: unexpected status %+v", status)
+	}
+
+	// The rolled back container matches the spec while the image of the
+	// spec is the image it was rolled back from.
+	p, err := PlanRun(ctx, drv, spec, PlanOptions{})
+	if err != nil {
+		t.Fatalf("PlanRun: %v", err)
+	}
+
+	if p.Action != ActionUnchanged || p.Drifted {
+		t.Errorf("plan: unexpected %+v", p)
+	}
+
+	// It is recreated from the previous image, such as when the unit
+	// running it restarts.
+	if err := drv.StopContainer(ctx, result.ID, stopOptions(spec, 0)); err != nil {
+		t.Fatalf("StopContainer: %v", err)
+	}
+
+	id, action, err := run(ctx, drv, spec, "", nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	status, err = drv.ContainerStatus(ctx, id)
+	if err != nil {
+		t.Fatalf("ContainerStatus: %v", err)
+	}
+
+	if action != ActionRecreated || status.Image != kept || status.Labels[LabelRollbackDigest] != testDigest {
+		t.Errorf("recreated container: unexpected %s %+v", action, status)
+	}
+
+	// Updates skip the image it was rolled back from.
+	result, err = Update(ctx, drv, spec, testUpdateOptions)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if result.Action != ActionUnchanged || result.ID != id || result.Digest != first {
+		t.Errorf("update of rolled back container: unexpected result %+v", result)
+	}
+
+	// Until the image of the spec changes again.
+	drv.SetImageDigest(spec.Image, otherDigest)
+	drv.SetExec(spec.Image, func(ctx context.Context, command []string, stdin io.Reader, stdout, stderr io.Writer) int {
+		return 0
+	})
+
+	result, err = Update(ctx, drv, spec, testUpdateOptions)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if result.Action != ActionUpdated || result.Digest != otherDigest {
+		t.Errorf("update to a new image: unexpected result %+v", result)
+	}
+}
+
+// TestUpdateRollbackOffline checks that containers are rolled back to an
+// image loaded offline, which can not be pulled by its digest.
+func TestUpdateRollbackOffline(t *testing.T) {
+	ctx := context.Background()
+
+	spec := newSpec("sleep 3600")
+	never := types.SpecPullPolicyNever
+	spec.PullPolicy = &never
+
+	drv := fake.New()
+
+	// The image is exported on a host with access to the registry.
+	var archive bytes.Buffer
+	if err := newDriver(t, spec).SaveImages(ctx, &archive, []string{spec.Image}); err != nil {
+		t.Fatalf("SaveImages: %v", err)
+	}
+
+	if _, err := drv.LoadImages(ctx, &archive); err != nil {
+		t.Fatalf("LoadImages: %v", err)
+	}
+
+	drv.FailOn("PullImage", errors.New("registry unreachable"))
+
+	_, first := runForUpdate(t, drv, spec)
+
+	// A new version of the image is loaded, and exits right away.
+	drv.SetImageDigest(spec.Image, testDigest)
+	drv.SetProgram(spec.Image, func(ctx context.Context, stdout, stderr io.Writer) int {
+		return 1
+	})
+
+	result, err := Update(ctx, drv, spec, testUpdateOptions)
+	if !errors.Is(err, ErrRolledBack) {
+		t.Fatalf("Update: want ErrRolledBack, got %v", err)
+	}
+
+	status, err := drv.ContainerStatus(ctx, result.ID)
+	if err != nil {
+		t.Fatalf("ContainerStatus: %v", err)
+	}
+
+	if status.Status != driver.Running || status.Labels[LabelImageDigest] != first {
+		t.Errorf("rolled back container: unexpected status %+v", status)
+	}
+}
+
+func TestUpdateSupervised(t *testing.T) {
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+	stateDir := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Run(ctx, drv, spec, RunOptions{StateDir: stateDir})
+		done <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := drv.FindContainer(ctx, spec.Name, labelsFor(spec))
+		if err == nil && status.Status == driver.Running {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("container was not started")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	drv.SetImageDigest(spec.Image, testDigest)
+
+	opts := testUpdateOptions
+	opts.StateDir = stateDir
+
+	result, err := Update(ctx, drv, spec, opts)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if result.Action != ActionUpdated {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	// Run keeps supervising the updated container.
+	select {
+	case err := <-done:
+		t.Fatalf("Run returned after the update: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	status, err := drv.ContainerStatus(context.Background(), result.ID)
+	if err != nil {
+		t.Fatalf("ContainerStatus: %v", err)
+	}
+
+	if status.Status != driver.Stopped {
+		t.Errorf("updated container: want stopped once Run returned, got %s", status.Status)
+	}
+}
+
+func TestUpdateRollbackExited(t *testing.T) {
+	ctx := context.Background()
+
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+	_, first := runForUpdate(t, drv, spec)
+
+	// The new version of the image exits right away.
+	drv.SetImageDigest(spec.Image, testDigest)
+	drv.SetProgram(spec.Image, func(ctx context.Context, stdout, stderr io.Writer) int {
+		return 1
+	})
+
+	results, err := UpdateAll(ctx, drv, []*types.Spec{spec}, UpdateOptions{Window: time.Second})
+	if !errors.Is(err, ErrRolledBack) {
+		t.Fatalf("UpdateAll: want ErrRolledBack, got %v", err)
+	}
+
+	if len(results) != 1 || results[0].Action != ActionRolledBack || results[0].Digest != first {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
+
+func TestUpdateNotFound(t *testing.T) {
+	spec := newSpec("sleep 3600")
+	drv := newDriver(t, spec)
+
+	result, err := Update(context.Background(), drv, spec, testUpdateOptions)
+	if !errors.Is(err, ErrContainerNotFound) {
+		t.Fatalf("Update: want ErrContainerNotFound, got %v", err)
+	}
+
+	if result.Action != ActionFailed {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
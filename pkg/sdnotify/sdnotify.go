@@ -0,0 +1,90 @@
+// Package sdnotify implements the client side of the systemd notification
+// protocol, see sd_notify(3). It lets a service run with Type=notify report
+// its readiness, status and liveness to the service manager.
+package sdnotify
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Status returns the state describing the service's status in a human
+// readable form, shown by systemctl status.
+func Status(status string) string {
+	return "STATUS=" + status
+}
+
+// Notifier sends notifications to the service manager. The zero value, as
+// well as a nil Notifier, discards them.
+type Notifier struct {
+	addr *net.UnixAddr
+}
+
+// FromEnv returns a Notifier for the socket in NOTIFY_SOCKET. It discards
+// notifications when the service was not started by a service manager
+// expecting them.
+func FromEnv() *Notifier {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return &Notifier{}
+	}
+
+	// Abstract sockets are denoted by a leading @.
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	return &Notifier{addr: &net.UnixAddr{Name: socket, Net: "unixgram"}}
+}
+
+// Notify sends the states to the service manager in a single message.
+func (n *Notifier) Notify(states ...string) error {
+	if n == nil || n.addr == nil {
+		return nil
+	}
+
+	conn, err := net.DialUnix(n.addr.Net, nil, n.addr)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(strings.Join(states, "\n")))
+	return err
+}
+
+// WatchdogInterval returns the interval within which the service manager
+// expects Watchdog notifications, zero if the watchdog is disabled for this
+// process.
+func WatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid WATCHDOG_USEC: " + usec)
+	}
+
+	if n <= 0 {
+		return 0, errors.New("invalid WATCHDOG_USEC: " + usec)
+	}
+
+	return time.Duration(n) * time.Microsecond, nil
+}
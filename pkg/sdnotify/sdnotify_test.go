@@ -0,0 +1,84 @@
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	if err := FromEnv().Notify(Ready, Status("running")); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	if got, want := string(buf[:n]), "READY=1\nSTATUS=running"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestNotifyDisabled(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	if err := FromEnv().Notify(Ready); err != nil {
+		t.Errorf("Notify: %v", err)
+	}
+
+	var n *Notifier
+	if err := n.Notify(Ready); err != nil {
+		t.Errorf("nil Notify: %v", err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		usec    string
+		pid     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"Disabled", "", "", 0, false},
+		{"Enabled", "30000000", "", 30 * time.Second, false},
+		{"ThisProcess", "30000000", strconv.Itoa(os.Getpid()), 30 * time.Second, false},
+		{"OtherProcess", "30000000", "1", 0, false},
+		{"Invalid", "soon", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+
+			got, err := WatchdogInterval()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error: want %v, got %v", tt.wantErr, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("want %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Package systemd generates systemd service units running a container with
+// sysctr.
+package systemd
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// UnitOptions describes the service unit of a container.
+type UnitOptions struct {
+	// Name of the container.
+	Name string
+	// Executable is the absolute path of the sysctr binary.
+	Executable string
+	// SpecPath is the absolute path of the container's spec.
+	SpecPath string
+	// ConfigPath is the absolute path of the sysctr configuration, if any.
+	ConfigPath string
+
+	// Dependencies are the units of the services the driver relies on.
+	Dependencies []string
+	// Mounts are paths that must be mounted before the container starts.
+	Mounts []string
+
+	// Pull pulls the image before the container is started, for specs
+	// whose pull policy is always.
+	Pull bool
+
+	// Notify makes the unit wait for sysctr to report the container as
+	// ready, see package sdnotify.
+	Notify bool
+	// Watchdog enables the service watchdog when non-zero. It requires
+	// Notify.
+	Watchdog time.Duration
+	// StopTimeout is the longest time stopping the container may take.
+	StopTimeout time.Duration
+	// RestartPreventExitStatus lists exit codes of sysctr that indicate
+	// restarting would not help.
+	RestartPreventExitStatus []int
+}
+
+var unitTemplate = template.Must(template.New("unit").Funcs(template.FuncMap{
+	"join":    joinQuoted,
+	"seconds": seconds,
+	"ints":    joinInts,
+}).Parse(`[Unit]
+Description=sysctr container {{ .Name }}
+Wants=network-online.target
+After=network-online.target{{ range .Dependencies }} {{ . }}{{ end }}
+{{- if .Dependencies }}
+Requires={{ join .Dependencies }}
+{{- end }}
+{{- if .Mounts }}
+RequiresMountsFor={{ join .Mounts }}
+{{- end }}
+
+[Service]
+Type={{ if .Notify }}notify{{ else }}simple{{ end }}
+{{- if .Notify }}
+NotifyAccess=main
+{{- end }}
+TimeoutStartSec=0
+TimeoutStopSec={{ seconds .StopTimeout }}
+{{- if .Watchdog }}
+WatchdogSec={{ seconds .Watchdog }}
+{{- end }}
+{{- if .Pull }}
+ExecStartPre={{ .Command "pull" }}
+{{- end }}
+ExecStart={{ .Command "run" }}
+KillMode=mixed
+Restart=always
+RestartSec=5s
+{{- if .RestartPreventExitStatus }}
+RestartPreventExitStatus={{ ints .RestartPreventExitStatus }}
+{{- end }}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+type unit struct {
+	UnitOptions
+}
+
+// Command returns the command line running the sysctr command for the
+// container.
+func (u unit) Command(command string) string {
+	args := []string{u.Executable}
+	if u.ConfigPath != "" {
+		args = append(args, "--config", u.ConfigPath)
+	}
+
+	args = append(args, command, "--spec", u.SpecPath)
+
+	return joinQuoted(args)
+}
+
+// WriteUnit writes the service unit described by opts to w.
+func WriteUnit(w io.Writer, opts UnitOptions) error {
+	if opts.Watchdog > 0 && !opts.Notify {
+		return fmt.Errorf("the watchdog requires notify")
+	}
+
+	return unitTemplate.Execute(w, unit{opts})
+}
+
+// quote escapes s as a single word of a unit file setting.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "%", "%%")
+
+	if s != "" && !strings.ContainsAny(s, " \t\"'") {
+		return s
+	}
+
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func joinQuoted(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = quote(w)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+func joinInts(ints []int) string {
+	words := make([]string, len(ints))
+	for i, n := range ints {
+		words[i] = strconv.Itoa(n)
+	}
+
+	return strings.Join(words, " ")
+}
+
+// seconds formats d as a time span in whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds()))) + "s"
+}
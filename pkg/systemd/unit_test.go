@@ -0,0 +1,92 @@
+package systemd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteUnit(t *testing.T) {
+	var b strings.Builder
+	err := WriteUnit(&b, UnitOptions{
+		Name:                     "postgres",
+		Executable:               "/usr/local/bin/sysctr",
+		SpecPath:                 "/opt/sysctr/specs/postgres.yaml",
+		ConfigPath:               "/etc/sysctr/config.json",
+		Dependencies:             []string{"containerd.service"},
+		Mounts:                   []string{"/srv/postgres", "/srv/my backups"},
+		Pull:                     true,
+		Notify:                   true,
+		Watchdog:                 30 * time.Second,
+		StopTimeout:              65 * time.Second,
+		RestartPreventExitStatus: []int{65, 78},
+	})
+	if err != nil {
+		t.Fatalf("WriteUnit: %v", err)
+	}
+
+	want := `[Unit]
+Description=sysctr container postgres
+Wants=network-online.target
+After=network-online.target containerd.service
+Requires=containerd.service
+RequiresMountsFor=/srv/postgres "/srv/my backups"
+
+[Service]
+Type=notify
+NotifyAccess=main
+TimeoutStartSec=0
+TimeoutStopSec=65s
+WatchdogSec=30s
+ExecStartPre=/usr/local/bin/sysctr --config /etc/sysctr/config.json pull --spec /opt/sysctr/specs/postgres.yaml
+ExecStart=/usr/local/bin/sysctr --config /etc/sysctr/config.json run --spec /opt/sysctr/specs/postgres.yaml
+KillMode=mixed
+Restart=always
+RestartSec=5s
+RestartPreventExitStatus=65 78
+
+[Install]
+WantedBy=multi-user.target
+`
+
+	if got := b.String(); got != want {
+		t.Errorf("unit mismatch\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestWriteUnitMinimal(t *testing.T) {
+	var b strings.Builder
+	err := WriteUnit(&b, UnitOptions{
+		Name:        "app",
+		Executable:  "/usr/bin/sysctr",
+		SpecPath:    "/specs/100%.yaml",
+		StopTimeout: 15 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("WriteUnit: %v", err)
+	}
+
+	unit := b.String()
+	for _, line := range []string{
+		"After=network-online.target\n",
+		"Type=simple\n",
+		"ExecStart=/usr/bin/sysctr run --spec /specs/100%%.yaml\n",
+	} {
+		if !strings.Contains(unit, line) {
+			t.Errorf("unit is missing %q:\n%s", line, unit)
+		}
+	}
+
+	for _, key := range []string{"Requires=", "RequiresMountsFor=", "NotifyAccess=", "WatchdogSec=", "ExecStartPre=", "ExecStop=", "RestartPreventExitStatus="} {
+		if strings.Contains(unit, key) {
+			t.Errorf("unit unexpectedly sets %s:\n%s", key, unit)
+		}
+	}
+}
+
+func TestWriteUnitWatchdogRequiresNotify(t *testing.T) {
+	var b strings.Builder
+	if err := WriteUnit(&b, UnitOptions{Watchdog: time.Second}); err == nil {
+		t.Errorf("want error")
+	}
+}
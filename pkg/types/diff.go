@@ -0,0 +1,155 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// SpecChange is a field that differs between two specs. Path names the
+// field, e.g. "env[FOO].value" or "network.ports[0].host_port". Old is nil
+// for added fields and New is nil for removed ones.
+type SpecChange struct {
+	Path string `json:"path"`
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+func (c SpecChange) String() string {
+	switch {
+	case c.Old == nil:
+		return fmt.Sprintf("+ %s: %s", c.Path, formatValue(c.New))
+	case c.New == nil:
+		return fmt.Sprintf("- %s: %s", c.Path, formatValue(c.Old))
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Path, formatValue(c.Old), formatValue(c.New))
+	}
+}
+
+func formatValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(b)
+}
+
+// listKeys names the field identifying the elements of lists, so that adding
+// an element does not show up as a change to the elements following it.
+var listKeys = map[string]string{
+	"env":           "name",
+	"volume_mounts": "target",
+	"sidecars":      "name",
+}
+
+// DiffSpecs returns the fields that differ between the normalized old and
+// new specs, sorted by path.
+func DiffSpecs(old, new *Spec) ([]SpecChange, error) {
+	oldFields, err := flattenSpec(old)
+	if err != nil {
+		return nil, err
+	}
+
+	newFields, err := flattenSpec(new)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(oldFields)+len(newFields))
+	for path := range oldFields {
+		paths = append(paths, path)
+	}
+
+	for path := range newFields {
+		if _, ok := oldFields[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+
+	sort.Strings(paths)
+
+	changes := []SpecChange{}
+	for _, path := range paths {
+		o, n := oldFields[path], newFields[path]
+		if !reflect.DeepEqual(o, n) {
+			changes = append(changes, SpecChange{Path: path, Old: o, New: n})
+		}
+	}
+
+	return changes, nil
+}
+
+// flattenSpec maps the path of every field set in the normalized spec to its
+// value. Lists of scalars, such as command, are a single field.
+func flattenSpec(spec *Spec) (map[string]any, error) {
+	fields := map[string]any{}
+	if spec == nil {
+		return fields, nil
+	}
+
+	b, err := json.Marshal(NormalizeSpec(spec))
+	if err != nil {
+		return nil, err
+	}
+
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	flatten("", v, fields)
+
+	return fields, nil
+}
+
+func flatten(path string, v any, fields map[string]any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if path != "" {
+				k = path + "." + k
+			}
+
+			flatten(k, child, fields)
+		}
+	case []any:
+		if !hasObjects(v) {
+			fields[path] = v
+			return
+		}
+
+		for i, child := range v {
+			flatten(path+"["+elementKey(path, i, child)+"]", child, fields)
+		}
+	case nil:
+	default:
+		fields[path] = v
+	}
+}
+
+func hasObjects(list []any) bool {
+	for _, v := range list {
+		if _, ok := v.(map[string]any); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// elementKey returns the key of the i-th element of the list at path, its
+// index unless the list has a key field.
+func elementKey(path string, i int, element any) string {
+	if key, ok := listKeys[path]; ok {
+		if obj, ok := element.(map[string]any); ok {
+			if s, ok := obj[key].(string); ok {
+				return s
+			}
+		}
+	}
+
+	return strconv.Itoa(i)
+}
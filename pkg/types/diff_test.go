@@ -0,0 +1,63 @@
+package types
+
+import (
+	"testing"
+)
+
+func TestDiffSpecs(t *testing.T) {
+	old := newSpec()
+	old.VolumeMounts = []VolumeMount{{Source: "/srv/a", Target: "/a"}}
+
+	timeout := 60
+	readOnly := true
+	new := newSpec()
+	new.Image = "busybox:1.36"
+	new.Env = []EnvVar{
+		{Name: "B", Value: "3"},
+		{Name: "0", Value: "first"},
+	}
+	new.VolumeMounts = []VolumeMount{{Source: "/srv/a", Target: "/a", ReadOnly: &readOnly}}
+	new.StopTimeout = &timeout
+
+	changes, err := DiffSpecs(old, new)
+	if err != nil {
+		t.Fatalf("DiffSpecs: %v", err)
+	}
+
+	want := []string{
+		`+ env[0].name: "0"`,
+		`+ env[0].value: "first"`,
+		`- env[A].name: "A"`,
+		`- env[A].value: "1"`,
+		`~ env[B].value: "2" -> "3"`,
+		`~ image: "busybox:latest" -> "busybox:1.36"`,
+		`+ stop_timeout: 60`,
+		`+ volume_mounts[/a].read_only: true`,
+	}
+
+	if len(changes) != len(want) {
+		t.Fatalf("want %d changes, got %v", len(want), changes)
+	}
+
+	for i, change := range changes {
+		if change.String() != want[i] {
+			t.Errorf("change %d: want %s, got %s", i, want[i], change)
+		}
+	}
+}
+
+func TestDiffSpecsEquivalent(t *testing.T) {
+	spec := newSpec()
+	explicit := newSpec()
+	explicit.Network = &Network{Mode: NetworkModeHost}
+	explicit.Env[0], explicit.Env[1] = explicit.Env[1], explicit.Env[0]
+
+	changes, err := DiffSpecs(spec, explicit)
+	if err != nil {
+		t.Fatalf("DiffSpecs: %v", err)
+	}
+
+	if len(changes) != 0 {
+		t.Errorf("want no changes, got %v", changes)
+	}
+}
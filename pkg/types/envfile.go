@@ -0,0 +1,106 @@
+package types
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReadEnvFile reads environment variables from a file in dotenv format.
+func ReadEnvFile(path string) ([]EnvVar, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	env, err := parseEnvFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return env, nil
+}
+
+// parseEnvFile parses lines of NAME=value, optionally prefixed with export.
+// Values may be quoted, escape sequences are only interpreted within double
+// quotes. Blank lines and lines starting with # are ignored, as is the rest
+// of an unquoted value following " #".
+func parseEnvFile(r io.Reader) ([]EnvVar, error) {
+	var env []EnvVar
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !validVariableName(name) {
+			return nil, fmt.Errorf("line %d: expected NAME=value", n)
+		}
+
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		env = append(env, EnvVar{Name: name, Value: value})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+func parseEnvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	switch quote := value[0]; quote {
+	case '\'':
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+
+		return value[1 : 1+end], nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(value); i++ {
+			switch c := value[i]; {
+			case c == '"':
+				return b.String(), nil
+			case c == '\\' && i+1 < len(value):
+				i++
+				switch value[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(value[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+
+		return "", fmt.Errorf("unterminated quoted value")
+	}
+
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+
+	return value, nil
+}
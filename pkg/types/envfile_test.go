@@ -0,0 +1,56 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	input := `# database
+POSTGRES_USER=postgres
+export POSTGRES_DB = app
+
+EMPTY=
+UNQUOTED=value # comment
+HASH=a#b
+SINGLE='$literal \n # kept'
+DOUBLE="line\nnext \"quoted\" # not a comment"
+`
+
+	env, err := parseEnvFile(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseEnvFile: %v", err)
+	}
+
+	want := []EnvVar{
+		{Name: "POSTGRES_USER", Value: "postgres"},
+		{Name: "POSTGRES_DB", Value: "app"},
+		{Name: "EMPTY", Value: ""},
+		{Name: "UNQUOTED", Value: "value"},
+		{Name: "HASH", Value: "a#b"},
+		{Name: "SINGLE", Value: `$literal \n # kept`},
+		{Name: "DOUBLE", Value: "line\nnext \"quoted\" # not a comment"},
+	}
+
+	if len(env) != len(want) {
+		t.Fatalf("want %d variables, got %+v", len(want), env)
+	}
+
+	for i := range want {
+		if env[i] != want[i] {
+			t.Errorf("variable %d: want %+v, got %+v", i, want[i], env[i])
+		}
+	}
+}
+
+func TestParseEnvFileInvalid(t *testing.T) {
+	for _, input := range []string{
+		"NO_VALUE",
+		"1NAME=value",
+		`OPEN="unterminated`,
+	} {
+		if _, err := parseEnvFile(strings.NewReader(input)); err == nil {
+			t.Errorf("%q: want error", input)
+		}
+	}
+}
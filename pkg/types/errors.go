@@ -0,0 +1,20 @@
+package types
+
+// SpecError reports a spec that can not be loaded or turned into a container.
+type SpecError struct {
+	// Field is the name of the offending field, if known.
+	Field string
+	Err   error
+}
+
+func (e *SpecError) Error() string {
+	if e.Field == "" {
+		return "invalid spec: " + e.Err.Error()
+	}
+
+	return "invalid spec: " + e.Field + ": " + e.Err.Error()
+}
+
+func (e *SpecError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,151 @@
+package types
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SpecHashVersion identifies the hashing scheme used by HashSpec. It prefixes
+// every hash, so that hashes produced by an older scheme can still be
+// verified after the scheme changes.
+const SpecHashVersion = "v1"
+
+type specHasher func(spec *Spec, extra map[string]string) (string, error)
+
+// errNotCovered is returned by a hashing scheme for specs setting fields it
+// does not cover.
+var errNotCovered = errors.New("spec sets fields not covered by the hash scheme")
+
+// specHashers holds every supported hashing scheme by version. Schemes must
+// never change once released, add a new version instead. Each scheme hashes
+// a frozen projection of the spec, so that fields added to the spec do not
+// change the hashes it produces.
+var specHashers = map[string]specHasher{
+	"v1": hashSpecV1,
+}
+
+// HashSpec returns a hash covering every field of the normalized spec and
+// the extra values, which callers use for configuration outside the spec
+// that affects the container.
+func HashSpec(spec *Spec, extra map[string]string) (string, error) {
+	hash, err := hashSpecVersion(SpecHashVersion, spec, extra)
+	if errors.Is(err, errNotCovered) {
+		// The current scheme must cover every field of the spec.
+		return "", fmt.Errorf("hash scheme %s is out of date: %w", SpecHashVersion, err)
+	}
+
+	return hash, err
+}
+
+// VerifySpecHash reports whether hash was computed from spec and extra, using
+// the hashing scheme the hash was produced with. Hashes without a version
+// were produced by releases that predate SpecHashVersion. Hashes of unknown
+// schemes, or of schemes that do not cover every field set in spec, never
+// match.
+func VerifySpecHash(hash string, spec *Spec, extra map[string]string) (bool, error) {
+	var expected string
+	var err error
+
+	version, _, ok := strings.Cut(hash, ":")
+	switch {
+	case !ok:
+		expected, err = hashSpecLegacy(spec)
+	case specHashers[version] != nil:
+		expected, err = hashSpecVersion(version, spec, extra)
+	default:
+		return false, nil
+	}
+
+	if errors.Is(err, errNotCovered) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return hash == expected, nil
+}
+
+func hashSpecVersion(version string, spec *Spec, extra map[string]string) (string, error) {
+	sum, err := specHashers[version](spec, extra)
+	if err != nil {
+		return "", err
+	}
+
+	return version + ":" + sum, nil
+}
+
+// projectSpec decodes spec into v, the fields of spec covered by a hashing
+// scheme. It returns errNotCovered if spec sets fields outside of v.
+func projectSpec(spec *Spec, v any) error {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %w", errNotCovered, err)
+	}
+
+	return nil
+}
+
+// specLegacy holds the fields covered by the unversioned hash of releases
+// that predate SpecHashVersion. Volume mounts were part of the spec but not
+// of the hash, so specs with volume mounts never match a legacy hash.
+type specLegacy struct {
+	Args    []string   `json:"args,omitempty"`
+	Command []string   `json:"command,omitempty"`
+	Env     []envVarV1 `json:"env,omitempty"`
+	Image   string     `json:"image"`
+	Name    string     `json:"name"`
+}
+
+// hashSpecLegacy returns the unversioned hash of spec. It did not cover
+// values outside the spec.
+func hashSpecLegacy(spec *Spec) (string, error) {
+	if err := projectSpec(NormalizeSpec(spec), &specLegacy{}); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+
+	h.Write([]byte(spec.Name + "\n"))
+	h.Write([]byte(spec.Image + "\n"))
+
+	for _, m := range spec.Command {
+		h.Write([]byte(m + "\n"))
+	}
+
+	for _, m := range spec.Args {
+		h.Write([]byte(m + "\n"))
+	}
+
+	// Variables defined more than once are written once per definition,
+	// with the value of the last one.
+	envVarNames := make([]string, len(spec.Env))
+	envVars := make(map[string]string, len(spec.Env))
+
+	for i, m := range spec.Env {
+		envVars[m.Name] = m.Value
+		envVarNames[i] = m.Name
+	}
+
+	sort.Strings(envVarNames)
+
+	for _, name := range envVarNames {
+		h.Write([]byte(fmt.Sprintf("%s=%s\n", name, envVars[name])))
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
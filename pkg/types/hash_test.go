@@ -0,0 +1,354 @@
+package types
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newSpec() *Spec {
+	return &Spec{
+		Name:  "test",
+		Image: "busybox:latest",
+		Env: []EnvVar{
+			{Name: "A", Value: "1"},
+			{Name: "B", Value: "2"},
+		},
+	}
+}
+
+func mustHash(t *testing.T, spec *Spec, extra map[string]string) string {
+	t.Helper()
+
+	hash, err := HashSpec(spec, extra)
+	if err != nil {
+		t.Fatalf("HashSpec: %v", err)
+	}
+
+	return hash
+}
+
+func TestHashSpecVersion(t *testing.T) {
+	hash := mustHash(t, newSpec(), nil)
+	if !strings.HasPrefix(hash, SpecHashVersion+":") {
+		t.Errorf("hash %s is missing version prefix %s", hash, SpecHashVersion)
+	}
+}
+
+func TestHashSpecEnvOrder(t *testing.T) {
+	spec := newSpec()
+	reordered := newSpec()
+	reordered.Env[0], reordered.Env[1] = reordered.Env[1], reordered.Env[0]
+
+	if mustHash(t, spec, nil) != mustHash(t, reordered, nil) {
+		t.Errorf("env order changed the spec hash")
+	}
+}
+
+func TestHashSpecDefaults(t *testing.T) {
+	spec := newSpec()
+	explicit := newSpec()
+
+	readOnly := false
+	explicit.VolumeMounts = []VolumeMount{}
+	explicit.Network = &Network{Mode: NetworkModeHost}
+	explicit.Env = append(explicit.Env, EnvVar{Name: "A", Value: "0"})
+	explicit.Env[0], explicit.Env[2] = explicit.Env[2], explicit.Env[0]
+
+	if mustHash(t, spec, nil) != mustHash(t, explicit, nil) {
+		t.Errorf("explicit defaults changed the spec hash")
+	}
+
+	spec.VolumeMounts = []VolumeMount{{Source: "/src", Target: "/dst"}}
+	explicit.VolumeMounts = []VolumeMount{{Source: "/src", Target: "/dst", ReadOnly: &readOnly}}
+
+	if mustHash(t, spec, nil) != mustHash(t, explicit, nil) {
+		t.Errorf("read_only false changed the spec hash")
+	}
+}
+
+func TestHashSpecCoversFields(t *testing.T) {
+	before := mustHash(t, newSpec(), nil)
+
+	pids := 100
+	timeout := 30
+	changes := map[string]func(*Spec){
+		"volume_mounts": func(s *Spec) { s.VolumeMounts = []VolumeMount{{Source: "/src", Target: "/dst"}} },
+		"resources":     func(s *Spec) { s.Resources = &Resources{PidsLimit: &pids} },
+		"stop_timeout":  func(s *Spec) { s.StopTimeout = &timeout },
+		"env":           func(s *Spec) { s.Env[0].Value = "changed" },
+		"network":       func(s *Spec) { s.Network = &Network{Mode: NetworkModeNone} },
+	}
+
+	for name, change := range changes {
+		spec := newSpec()
+		change(spec)
+
+		if mustHash(t, spec, nil) == before {
+			t.Errorf("changing %s did not change the spec hash", name)
+		}
+	}
+
+	if mustHash(t, newSpec(), map[string]string{"driver": "docker"}) == before {
+		t.Errorf("extra values did not change the spec hash")
+	}
+}
+
+func TestVerifySpecHash(t *testing.T) {
+	spec := newSpec()
+	extra := map[string]string{"driver": "docker"}
+	hash := mustHash(t, spec, extra)
+
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{"Current", hash, true},
+		{"Unversioned", strings.TrimPrefix(hash, SpecHashVersion+":"), false},
+		{"UnknownVersion", "v0:" + strings.TrimPrefix(hash, SpecHashVersion+":"), false},
+		{"Mismatch", SpecHashVersion + ":stale", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifySpecHash(tt.hash, spec, extra)
+			if err != nil {
+				t.Fatalf("VerifySpecHash: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// fullSpec returns a spec setting every field known to the v1 hash.
+func fullSpec() *Spec {
+	str := func(s string) *string { return &s }
+	num := func(n int) *int { return &n }
+	yes := true
+	always := SpecPullPolicyAlways
+
+	return &Spec{
+		Name:    "full",
+		Image:   "busybox:latest",
+		Command: []string{"/bin/sh", "-c"},
+		Args:    []string{"sleep 3600"},
+		Env:     []EnvVar{{Name: "B", Value: "2"}, {Name: "A", Value: "1"}},
+		EnvFile: []string{"/etc/full.env"},
+		Healthcheck: &Healthcheck{
+			Exec:        &ExecProbe{Command: []string{"true"}},
+			Http:        &HttpProbe{Host: "localhost", Path: "/health", Port: 8080, Scheme: HttpProbeSchemeHttp},
+			Tcp:         &TcpProbe{Host: "localhost", Port: 8081},
+			Interval:    10,
+			OnFailure:   HealthcheckOnFailureRestart,
+			Retries:     3,
+			StartPeriod: 5,
+			Timeout:     2,
+		},
+		Network: &Network{
+			Mode:  NetworkModeBridge,
+			Ports: []PortMapping{{ContainerPort: 80, HostIp: str("127.0.0.1"), HostPort: num(8080), Protocol: PortMappingProtocolUdp}},
+		},
+		PullPolicy: &always,
+		Resources: &Resources{
+			BlkioWeight:       num(500),
+			CpuPeriod:         num(100000),
+			CpuQuota:          num(50000),
+			CpuShares:         num(512),
+			MemoryLimit:       str("512m"),
+			MemoryReservation: str("256m"),
+			PidsLimit:         num(100),
+		},
+		Restart: &Restart{
+			InitialDelay: 1,
+			Jitter:       0.25,
+			MaxDelay:     60,
+			MaxRetries:   5,
+			Policy:       RestartPolicyAlways,
+			ResetAfter:   300,
+		},
+		Secrets: []Secret{
+			{Name: "token", Env: str("TOKEN"), Target: &SecretTarget{Env: str("API_TOKEN")}},
+			{Name: "key", File: str("/etc/key"), Target: &SecretTarget{Path: str("/run/key")}},
+			{Name: "cred", Credential: str("cred")},
+		},
+		SharePid: true,
+		Sidecars: []Sidecar{{
+			Name:    "exporter",
+			Image:   "busybox:latest",
+			Command: []string{"/bin/sh", "-c"},
+			Args:    []string{"sleep 3600"},
+			Env:     []EnvVar{{Name: "C", Value: "3"}},
+			Resources: &Resources{
+				BlkioWeight:       num(100),
+				CpuPeriod:         num(100000),
+				CpuQuota:          num(10000),
+				CpuShares:         num(128),
+				MemoryLimit:       str("64m"),
+				MemoryReservation: str("32m"),
+				PidsLimit:         num(10),
+			},
+			VolumeMounts: []VolumeMount{{Source: "/data", Target: "/data", ReadOnly: &yes}},
+		}},
+		StopSignal:   str("SIGINT"),
+		StopTimeout:  num(30),
+		VolumeMounts: []VolumeMount{{Source: "/data", Target: "/data", ReadOnly: &yes}},
+	}
+}
+
+func TestHashSpecV1Golden(t *testing.T) {
+	// Hashes of a released scheme must never change, or every container
+	// created with it is recreated. Changes to NormalizeSpec or to the fields
+	// of the spec that alter this hash need a new scheme.
+	const want = "v1:0b03f325c54d6823e9e70b48e803d04041f89f199cd0b62717943e725f9df07f"
+
+	got, err := hashSpecVersion("v1", fullSpec(), map[string]string{"driver": "docker"})
+	if err != nil {
+		t.Fatalf("hashSpecVersion: %v", err)
+	}
+
+	if got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+// legacyHash is the hash of newSpec produced by releases that predate
+// SpecHashVersion.
+const legacyHash = "3e1f8ae24a3c38703fc94673b0cafe815917b801bef11f3d3cb425a6adb02dc4"
+
+func TestVerifySpecHashLegacy(t *testing.T) {
+	extra := map[string]string{"driver": "docker"}
+
+	readOnly := false
+	host := &Network{Mode: NetworkModeHost}
+	mounts := []VolumeMount{{Source: "/src", Target: "/dst"}}
+	pids := 100
+
+	tests := []struct {
+		name   string
+		change func(*Spec)
+		want   bool
+	}{
+		{"Unchanged", func(s *Spec) {}, true},
+		{"EnvOrder", func(s *Spec) { s.Env[0], s.Env[1] = s.Env[1], s.Env[0] }, true},
+		{"Defaults", func(s *Spec) { s.Network = host }, true},
+		{"Env", func(s *Spec) { s.Env[0].Value = "changed" }, false},
+		{"Image", func(s *Spec) { s.Image = "busybox:1.36" }, false},
+		// Fields the legacy hash did not cover can not be verified.
+		{"VolumeMounts", func(s *Spec) { s.VolumeMounts = mounts }, false},
+		{"ReadOnly", func(s *Spec) { s.VolumeMounts = []VolumeMount{{Source: "/src", Target: "/dst", ReadOnly: &readOnly}} }, false},
+		{"Resources", func(s *Spec) { s.Resources = &Resources{PidsLimit: &pids} }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newSpec()
+			tt.change(spec)
+
+			got, err := VerifySpecHash(legacyHash, spec, extra)
+			if err != nil {
+				t.Fatalf("VerifySpecHash: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// unsetFields returns the fields of the structs reachable from values that
+// are not set in any of them.
+func unsetFields(path string, values []reflect.Value) []string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	switch values[0].Kind() {
+	case reflect.Pointer:
+		var elems []reflect.Value
+		for _, v := range values {
+			if !v.IsNil() {
+				elems = append(elems, v.Elem())
+			}
+		}
+
+		return unsetFields(path, elems)
+	case reflect.Slice:
+		var elems []reflect.Value
+		for _, v := range values {
+			for i := 0; i < v.Len(); i++ {
+				elems = append(elems, v.Index(i))
+			}
+		}
+
+		return unsetFields(path, elems)
+	case reflect.Struct:
+		var unset []string
+
+		typ := values[0].Type()
+		for i := 0; i < typ.NumField(); i++ {
+			fieldPath := path + "." + typ.Field(i).Name
+
+			var set []reflect.Value
+			for _, v := range values {
+				if f := v.Field(i); !f.IsZero() {
+					set = append(set, f)
+				}
+			}
+
+			if len(set) == 0 {
+				unset = append(unset, fieldPath)
+				continue
+			}
+
+			unset = append(unset, unsetFields(fieldPath, set)...)
+		}
+
+		return unset
+	default:
+		return nil
+	}
+}
+
+func TestHashSpecCoversSpec(t *testing.T) {
+	spec := fullSpec()
+
+	// fullSpec must set every field of the spec, so that HashSpec fails when
+	// the spec has fields the current scheme does not cover.
+	if unset := unsetFields("Spec", []reflect.Value{reflect.ValueOf(spec)}); len(unset) > 0 {
+		t.Fatalf("fullSpec does not set %v", unset)
+	}
+
+	if _, err := HashSpec(spec, nil); err != nil {
+		t.Fatalf("HashSpec: %v", err)
+	}
+}
+
+func TestProjectSpecNotCovered(t *testing.T) {
+	// The projection of a scheme released before a field was added to the
+	// spec lacks the field.
+	var v struct {
+		Name  string `json:"name"`
+		Image string `json:"image"`
+	}
+
+	if err := projectSpec(newSpec(), &v); !errors.Is(err, errNotCovered) {
+		t.Errorf("want %v, got %v", errNotCovered, err)
+	}
+
+	spec := newSpec()
+	spec.Env = nil
+
+	if err := projectSpec(spec, &v); err != nil {
+		t.Errorf("projectSpec: %v", err)
+	}
+
+	if v.Name != spec.Name || v.Image != spec.Image {
+		t.Errorf("want %s %s, got %+v", spec.Name, spec.Image, v)
+	}
+}
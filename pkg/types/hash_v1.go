@@ -0,0 +1,147 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// The v1 hash covers the fields of the spec below, as normalized by
+// NormalizeSpec. They are a frozen copy of the spec when v1 was released:
+// fields added to the spec since are not covered by v1, and specs setting
+// them can not be verified against a v1 hash. Do not change these types,
+// add a new scheme instead.
+
+type specV1 struct {
+	Args         []string        `json:"args,omitempty"`
+	Command      []string        `json:"command,omitempty"`
+	Env          []envVarV1      `json:"env,omitempty"`
+	EnvFile      []string        `json:"env_file,omitempty"`
+	Healthcheck  *healthcheckV1  `json:"healthcheck,omitempty"`
+	Image        string          `json:"image"`
+	Name         string          `json:"name"`
+	Network      *networkV1      `json:"network,omitempty"`
+	PullPolicy   *string         `json:"pull_policy,omitempty"`
+	Resources    *resourcesV1    `json:"resources,omitempty"`
+	Restart      *restartV1      `json:"restart,omitempty"`
+	Secrets      []secretV1      `json:"secrets,omitempty"`
+	SharePid     bool            `json:"share_pid,omitempty"`
+	Sidecars     []sidecarV1     `json:"sidecars,omitempty"`
+	StopSignal   *string         `json:"stop_signal,omitempty"`
+	StopTimeout  *int            `json:"stop_timeout,omitempty"`
+	VolumeMounts []volumeMountV1 `json:"volume_mounts,omitempty"`
+}
+
+type envVarV1 struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type healthcheckV1 struct {
+	Exec        *execProbeV1 `json:"exec,omitempty"`
+	Http        *httpProbeV1 `json:"http,omitempty"`
+	Interval    int          `json:"interval,omitempty"`
+	OnFailure   string       `json:"on_failure,omitempty"`
+	Retries     int          `json:"retries,omitempty"`
+	StartPeriod int          `json:"start_period,omitempty"`
+	Tcp         *tcpProbeV1  `json:"tcp,omitempty"`
+	Timeout     int          `json:"timeout,omitempty"`
+}
+
+type execProbeV1 struct {
+	Command []string `json:"command"`
+}
+
+type httpProbeV1 struct {
+	Host   string `json:"host,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Port   int    `json:"port"`
+	Scheme string `json:"scheme,omitempty"`
+}
+
+type tcpProbeV1 struct {
+	Host string `json:"host,omitempty"`
+	Port int    `json:"port"`
+}
+
+type networkV1 struct {
+	Mode  string          `json:"mode,omitempty"`
+	Ports []portMappingV1 `json:"ports,omitempty"`
+}
+
+type portMappingV1 struct {
+	ContainerPort int     `json:"container_port"`
+	HostIp        *string `json:"host_ip,omitempty"`
+	HostPort      *int    `json:"host_port,omitempty"`
+	Protocol      string  `json:"protocol,omitempty"`
+}
+
+type resourcesV1 struct {
+	BlkioWeight       *int    `json:"blkio_weight,omitempty"`
+	CpuPeriod         *int    `json:"cpu_period,omitempty"`
+	CpuQuota          *int    `json:"cpu_quota,omitempty"`
+	CpuShares         *int    `json:"cpu_shares,omitempty"`
+	MemoryLimit       *string `json:"memory_limit,omitempty"`
+	MemoryReservation *string `json:"memory_reservation,omitempty"`
+	PidsLimit         *int    `json:"pids_limit,omitempty"`
+}
+
+type restartV1 struct {
+	InitialDelay int     `json:"initial_delay,omitempty"`
+	Jitter       float64 `json:"jitter,omitempty"`
+	MaxDelay     int     `json:"max_delay,omitempty"`
+	MaxRetries   int     `json:"max_retries,omitempty"`
+	Policy       string  `json:"policy,omitempty"`
+	ResetAfter   int     `json:"reset_after,omitempty"`
+}
+
+type secretV1 struct {
+	Credential *string         `json:"credential,omitempty"`
+	Env        *string         `json:"env,omitempty"`
+	File       *string         `json:"file,omitempty"`
+	Name       string          `json:"name"`
+	Target     *secretTargetV1 `json:"target,omitempty"`
+}
+
+type secretTargetV1 struct {
+	Env  *string `json:"env,omitempty"`
+	Path *string `json:"path,omitempty"`
+}
+
+type sidecarV1 struct {
+	Args         []string        `json:"args,omitempty"`
+	Command      []string        `json:"command,omitempty"`
+	Env          []envVarV1      `json:"env,omitempty"`
+	Image        string          `json:"image"`
+	Name         string          `json:"name"`
+	Resources    *resourcesV1    `json:"resources,omitempty"`
+	VolumeMounts []volumeMountV1 `json:"volume_mounts,omitempty"`
+}
+
+type volumeMountV1 struct {
+	ReadOnly *bool  `json:"read_only,omitempty"`
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+}
+
+func hashSpecV1(spec *Spec, extra map[string]string) (string, error) {
+	var v specV1
+	if err := projectSpec(NormalizeSpec(spec), &v); err != nil {
+		return "", err
+	}
+
+	// Struct fields and map keys are marshalled in a fixed order.
+	data, err := json.Marshal(struct {
+		Spec  *specV1           `json:"spec"`
+		Extra map[string]string `json:"extra,omitempty"`
+	}{
+		Spec:  &v,
+		Extra: extra,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:]), nil
+}
@@ -0,0 +1,72 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// interpolate replaces ${VAR} in s with the value of the variable VAR and
+// ${VAR:-default} with default when VAR is unset or empty. $$ is a literal
+// $. Undefined variables are replaced with an empty string unless strict is
+// set.
+func interpolate(s string, lookup func(string) (string, bool), strict bool) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable reference in %q", s)
+			}
+
+			name, def, hasDefault := strings.Cut(s[i+2:i+2+end], ":-")
+			if !validVariableName(name) {
+				return "", fmt.Errorf("invalid variable name %q", name)
+			}
+
+			value, ok := lookup(name)
+			switch {
+			case hasDefault && value == "":
+				value = def
+			case !ok && strict:
+				return "", fmt.Errorf("variable %s is not set", name)
+			}
+
+			b.WriteString(value)
+			i += 2 + end
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String(), nil
+}
+
+func validVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
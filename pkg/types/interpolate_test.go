@@ -0,0 +1,60 @@
+package types
+
+import (
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	env := map[string]string{
+		"NAME":  "postgres",
+		"EMPTY": "",
+	}
+
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		in      string
+		want    string
+		strict  bool
+		wantErr bool
+	}{
+		{in: "plain", want: "plain"},
+		{in: "${NAME}:16", want: "postgres:16"},
+		{in: "a${NAME}b${NAME}", want: "apostgresbpostgres"},
+		{in: "${MISSING}", want: ""},
+		{in: "${MISSING:-default}", want: "default"},
+		{in: "${EMPTY:-default}", want: "default"},
+		{in: "${NAME:-default}", want: "postgres"},
+		{in: "$$NAME $${NAME}", want: "$NAME ${NAME}"},
+		{in: "$NAME", want: "$NAME"},
+		{in: "cost: 5$", want: "cost: 5$"},
+		{in: "${EMPTY}", want: "", strict: true},
+		{in: "${MISSING:-x}", want: "x", strict: true},
+		{in: "${MISSING}", strict: true, wantErr: true},
+		{in: "${NAME", wantErr: true},
+		{in: "${1NAME}", wantErr: true},
+		{in: "${}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := interpolate(tt.in, lookup, tt.strict)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: want error, got %q", tt.in, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("%q: want %q, got %q", tt.in, tt.want, got)
+		}
+	}
+}
@@ -1,58 +1,228 @@
 package types
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+// LoadOptions control how specs are read.
+type LoadOptions struct {
+	// LookupEnv returns the value of variables referenced by the spec. It
+	// defaults to os.LookupEnv.
+	LookupEnv func(string) (string, bool)
+	// Strict fails loading a spec referencing a variable that is not set
+	// and has no default.
+	Strict bool
+}
+
 func ReadSpecFromFile(path string) (*Spec, error) {
+	return ReadSpecFromFileWithOptions(path, LoadOptions{})
+}
+
+// ReadSpecFromFileWithOptions reads a YAML or JSON spec. ${VAR} references in
+// string values are replaced with environment variables and the variables of
+// env_file are added to env.
+func ReadSpecFromFileWithOptions(path string, opts LoadOptions) (*Spec, error) {
+	if opts.LookupEnv == nil {
+		opts.LookupEnv = os.LookupEnv
+	}
+
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
+	var spec *Spec
 	if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") {
-		return loadYAML(file)
+		spec, err = loadYAML(file, opts)
+	} else {
+		spec, err = loadJSON(file, opts)
 	}
 
-	return loadJSON(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadEnvFiles(spec, filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+
+	// Secrets are read when the container is created, by then the working
+	// directory may differ.
+	for i, secret := range spec.Secrets {
+		if secret.File != nil && *secret.File != "" && !filepath.IsAbs(*secret.File) {
+			dir, err := filepath.Abs(filepath.Dir(path))
+			if err != nil {
+				return nil, err
+			}
+
+			file := filepath.Join(dir, *secret.File)
+			spec.Secrets[i].File = &file
+		}
+	}
+
+	return spec, nil
 }
 
-func loadJSON(f *os.File) (*Spec, error) {
-	var v Spec
+func loadJSON(f *os.File, opts LoadOptions) (*Spec, error) {
+	var doc any
 	decoder := json.NewDecoder(f)
-	err := decoder.Decode(&v)
+	decoder.UseNumber()
+	err := decoder.Decode(&doc)
+	if err != nil {
+		return nil, &SpecError{Err: err}
+	}
+
+	doc, err = interpolateJSON(doc, "", opts)
 	if err != nil {
 		return nil, err
 	}
 
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, &SpecError{Err: err}
+	}
+
+	var v Spec
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return nil, &SpecError{Err: err}
+	}
+
 	return &v, nil
 }
 
-func loadYAML(f *os.File) (*Spec, error) {
-	var v Spec
+func loadYAML(f *os.File, opts LoadOptions) (*Spec, error) {
+	var node yaml.Node
 	decoder := yaml.NewDecoder(f)
-	err := decoder.Decode(&v)
+	err := decoder.Decode(&node)
 	if err != nil {
+		return nil, &SpecError{Err: err}
+	}
+
+	if err := interpolateYAML(&node, "", opts); err != nil {
 		return nil, err
 	}
 
+	var v Spec
+	err = node.Decode(&v)
+	if err != nil {
+		return nil, &SpecError{Err: err}
+	}
+
 	return &v, nil
 }
 
-func HashSpec(spec *Spec) (string, error) {
-	specJson, err := json.Marshal(spec)
-	if err != nil {
-		return "", err
+func interpolateJSON(v any, path string, opts LoadOptions) (any, error) {
+	switch v := v.(type) {
+	case string:
+		s, err := interpolate(v, opts.LookupEnv, opts.Strict)
+		if err != nil {
+			return nil, &SpecError{Field: path, Err: err}
+		}
+
+		return s, nil
+	case map[string]any:
+		for k, child := range v {
+			child, err := interpolateJSON(child, fieldPath(path, k), opts)
+			if err != nil {
+				return nil, err
+			}
+
+			v[k] = child
+		}
+	case []any:
+		for i, child := range v {
+			child, err := interpolateJSON(child, fmt.Sprintf("%s[%d]", path, i), opts)
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = child
+		}
 	}
 
-	h := sha256.New()
-	h.Write(specJson)
-	return hex.EncodeToString(h.Sum(nil)), nil
+	return v, nil
+}
+
+func interpolateYAML(node *yaml.Node, path string, opts LoadOptions) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := interpolateYAML(child, path, opts); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := interpolateYAML(node.Content[i+1], fieldPath(path, node.Content[i].Value), opts); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			if err := interpolateYAML(child, fmt.Sprintf("%s[%d]", path, i), opts); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if node.ShortTag() != "!!str" {
+			return nil
+		}
+
+		value, err := interpolate(node.Value, opts.LookupEnv, opts.Strict)
+		if err != nil {
+			return &SpecError{Field: path, Err: err}
+		}
+
+		if value != node.Value && node.Style == 0 {
+			// Resolve the type of unquoted values again, so that
+			// variables can be used for numbers and booleans.
+			node.Tag = ""
+		}
+
+		node.Value = value
+	}
+
+	return nil
+}
+
+func fieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+
+	return path + "." + field
+}
+
+// loadEnvFiles adds the variables of the env files of spec, relative to dir,
+// to its env. Variables of later files and of env take precedence.
+func loadEnvFiles(spec *Spec, dir string) error {
+	if len(spec.EnvFile) == 0 {
+		return nil
+	}
+
+	var env []EnvVar
+	for i, path := range spec.EnvFile {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		vars, err := ReadEnvFile(path)
+		if err != nil {
+			return &SpecError{Field: fmt.Sprintf("env_file[%d]", i), Err: err}
+		}
+
+		env = append(env, vars...)
+	}
+
+	spec.Env = append(env, spec.Env...)
+
+	return nil
 }
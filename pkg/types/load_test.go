@@ -0,0 +1,172 @@
+package types
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func lookupMap(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+}
+
+func TestReadSpecInterpolation(t *testing.T) {
+	dir := t.TempDir()
+
+	specs := map[string]string{
+		"spec.yaml": `
+name: postgres
+image: postgres:${PG_VERSION:-16}
+env:
+  - name: POSTGRES_PASSWORD
+    value: ${PASSWORD}
+  - name: LITERAL
+    value: "$${PASSWORD}"
+stop_timeout: ${STOP_TIMEOUT}
+`,
+		"spec.json": `{
+  "name": "postgres",
+  "image": "postgres:${PG_VERSION:-16}",
+  "env": [
+    {"name": "POSTGRES_PASSWORD", "value": "${PASSWORD}"},
+    {"name": "LITERAL", "value": "$${PASSWORD}"}
+  ],
+  "stop_timeout": 60
+}`,
+	}
+
+	opts := LoadOptions{
+		LookupEnv: lookupMap(map[string]string{"PASSWORD": "secret", "STOP_TIMEOUT": "60"}),
+	}
+
+	for name, content := range specs {
+		t.Run(name, func(t *testing.T) {
+			spec, err := ReadSpecFromFileWithOptions(writeFile(t, dir, name, content), opts)
+			if err != nil {
+				t.Fatalf("ReadSpecFromFileWithOptions: %v", err)
+			}
+
+			if spec.Image != "postgres:16" {
+				t.Errorf("image: want postgres:16, got %s", spec.Image)
+			}
+
+			if spec.Env[0].Value != "secret" || spec.Env[1].Value != "${PASSWORD}" {
+				t.Errorf("env: unexpected %+v", spec.Env)
+			}
+
+			if spec.StopTimeout == nil || *spec.StopTimeout != 60 {
+				t.Errorf("stop_timeout: want 60, got %v", spec.StopTimeout)
+			}
+		})
+	}
+}
+
+func TestReadSpecStrict(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "spec.yaml", `
+name: test
+image: busybox
+env:
+  - name: FOO
+    value: ${UNDEFINED}
+`)
+
+	opts := LoadOptions{LookupEnv: lookupMap(nil)}
+	spec, err := ReadSpecFromFileWithOptions(path, opts)
+	if err != nil {
+		t.Fatalf("ReadSpecFromFileWithOptions: %v", err)
+	}
+
+	if spec.Env[0].Value != "" {
+		t.Errorf("undefined variable: want empty value, got %q", spec.Env[0].Value)
+	}
+
+	opts.Strict = true
+	_, err = ReadSpecFromFileWithOptions(path, opts)
+
+	var specErr *SpecError
+	if !errors.As(err, &specErr) || specErr.Field != "env[0].value" {
+		t.Fatalf("want SpecError for env[0].value, got %v", err)
+	}
+}
+
+func TestReadSpecEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "common.env", "A=common\nB=common\n")
+	writeFile(t, dir, "local.env", "B=local\nC=local\n")
+
+	path := writeFile(t, dir, "spec.yaml", `
+name: test
+image: busybox
+env_file:
+  - common.env
+  - ${ENV_DIR}/local.env
+env:
+  - name: C
+    value: spec
+`)
+
+	opts := LoadOptions{LookupEnv: lookupMap(map[string]string{"ENV_DIR": dir})}
+	spec, err := ReadSpecFromFileWithOptions(path, opts)
+	if err != nil {
+		t.Fatalf("ReadSpecFromFileWithOptions: %v", err)
+	}
+
+	want := map[string]string{"A": "common", "B": "local", "C": "spec"}
+	env := NormalizeSpec(spec).Env
+	if len(env) != len(want) {
+		t.Fatalf("want %d variables, got %+v", len(want), env)
+	}
+
+	for _, e := range env {
+		if want[e.Name] != e.Value {
+			t.Errorf("%s: want %q, got %q", e.Name, want[e.Name], e.Value)
+		}
+	}
+
+	writeFile(t, dir, "spec.yaml", "name: test\nimage: busybox\nenv_file: [missing.env]\n")
+	_, err = ReadSpecFromFileWithOptions(path, opts)
+
+	var specErr *SpecError
+	if !errors.As(err, &specErr) || specErr.Field != "env_file[0]" {
+		t.Fatalf("missing env file: want SpecError for env_file[0], got %v", err)
+	}
+}
+
+func TestReadSpecSecretFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "spec.yaml", `
+name: test
+image: busybox
+secrets:
+  - name: relative
+    file: token
+  - name: absolute
+    file: /etc/token
+`)
+
+	spec, err := ReadSpecFromFile(path)
+	if err != nil {
+		t.Fatalf("ReadSpecFromFile: %v", err)
+	}
+
+	for i, want := range []string{filepath.Join(dir, "token"), "/etc/token"} {
+		if got := *spec.Secrets[i].File; got != want {
+			t.Errorf("secrets[%d].file: want %s, got %s", i, want, got)
+		}
+	}
+}
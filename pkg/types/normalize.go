@@ -0,0 +1,117 @@
+package types
+
+import (
+	"sort"
+)
+
+// NormalizeSpec returns a copy of spec with defaults filled in and fields
+// whose order carries no meaning sorted, so that equivalent specs are equal.
+func NormalizeSpec(spec *Spec) *Spec {
+	n := *spec
+
+	n.Command = nonEmpty(spec.Command)
+	n.Args = nonEmpty(spec.Args)
+	n.Env = normalizeEnv(spec.Env)
+
+	n.VolumeMounts = normalizeVolumeMounts(spec.VolumeMounts)
+	n.Network = normalizeNetwork(spec.Network)
+
+	// The order of sidecars is their start order.
+	if len(spec.Sidecars) > 0 {
+		n.Sidecars = make([]Sidecar, len(spec.Sidecars))
+		for i, s := range spec.Sidecars {
+			n.Sidecars[i] = s
+			n.Sidecars[i].Command = nonEmpty(s.Command)
+			n.Sidecars[i].Args = nonEmpty(s.Args)
+			n.Sidecars[i].Env = normalizeEnv(s.Env)
+			n.Sidecars[i].VolumeMounts = normalizeVolumeMounts(s.VolumeMounts)
+		}
+	} else {
+		n.Sidecars = nil
+	}
+
+	// The pull policy only decides where the image comes from.
+	n.PullPolicy = nil
+
+	return &n
+}
+
+func nonEmpty(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+
+	return append([]string{}, s...)
+}
+
+func normalizeVolumeMounts(mounts []VolumeMount) []VolumeMount {
+	if len(mounts) == 0 {
+		return nil
+	}
+
+	n := make([]VolumeMount, len(mounts))
+	for i, v := range mounts {
+		n[i] = v
+		if v.ReadOnly != nil && !*v.ReadOnly {
+			n[i].ReadOnly = nil
+		}
+	}
+
+	return n
+}
+
+// normalizeEnv sorts environment variables by name. When a variable is
+// defined more than once the last definition wins.
+func normalizeEnv(env []EnvVar) []EnvVar {
+	if len(env) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(env))
+	out := make([]EnvVar, 0, len(env))
+	for _, e := range env {
+		if i, ok := index[e.Name]; ok {
+			out[i] = e
+			continue
+		}
+
+		index[e.Name] = len(out)
+		out = append(out, e)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
+
+func normalizeNetwork(network *Network) *Network {
+	if network == nil {
+		return nil
+	}
+
+	n := Network{Mode: network.Mode}
+	if n.Mode == "" {
+		n.Mode = NetworkModeHost
+	}
+
+	if n.Mode == NetworkModeHost && len(network.Ports) == 0 {
+		return nil
+	}
+
+	for _, p := range network.Ports {
+		if p.Protocol == "" {
+			p.Protocol = PortMappingProtocolTcp
+		}
+
+		if p.HostPort == nil {
+			hostPort := p.ContainerPort
+			p.HostPort = &hostPort
+		}
+
+		n.Ports = append(n.Ports, p)
+	}
+
+	return &n
+}
@@ -5,116 +5,1070 @@ package types
 import "encoding/json"
 import "fmt"
 import yaml "gopkg.in/yaml.v3"
+import "reflect"
+import "time"
 
 type ContainerState struct {
 	// ConfigHash corresponds to the JSON schema field "config_hash".
 	ConfigHash string `json:"config_hash" yaml:"config_hash" mapstructure:"config_hash"`
 
+	// Whether the container was created from a different spec.
+	Drifted *bool `json:"drifted,omitempty" yaml:"drifted,omitempty" mapstructure:"drifted,omitempty"`
+
 	// ExitCode corresponds to the JSON schema field "exit_code".
 	ExitCode *int `json:"exit_code,omitempty" yaml:"exit_code,omitempty" mapstructure:"exit_code,omitempty"`
 
-	// Id corresponds to the JSON schema field "id".
-	Id string `json:"id" yaml:"id" mapstructure:"id"`
+	// Health corresponds to the JSON schema field "health".
+	Health *Health `json:"health,omitempty" yaml:"health,omitempty" mapstructure:"health,omitempty"`
+
+	// Id corresponds to the JSON schema field "id".
+	Id string `json:"id" yaml:"id" mapstructure:"id"`
+
+	// Image corresponds to the JSON schema field "image".
+	Image string `json:"image" yaml:"image" mapstructure:"image"`
+
+	// Digest of the image the container was created from.
+	ImageDigest *string `json:"image_digest,omitempty" yaml:"image_digest,omitempty" mapstructure:"image_digest,omitempty"`
+
+	// Name corresponds to the JSON schema field "name".
+	Name string `json:"name" yaml:"name" mapstructure:"name"`
+
+	// Times the container was restarted by its restart policy since sysctr started
+	// it.
+	RestartCount *int `json:"restart_count,omitempty" yaml:"restart_count,omitempty" mapstructure:"restart_count,omitempty"`
+
+	// When the container was last started.
+	StartedAt *time.Time `json:"started_at,omitempty" yaml:"started_at,omitempty" mapstructure:"started_at,omitempty"`
+
+	// Status corresponds to the JSON schema field "status".
+	Status string `json:"status" yaml:"status" mapstructure:"status"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *ContainerState) UnmarshalYAML(value *yaml.Node) error {
+	var raw map[string]interface{}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	if _, ok := raw["config_hash"]; raw != nil && !ok {
+		return fmt.Errorf("field config_hash in ContainerState: required")
+	}
+	if _, ok := raw["id"]; raw != nil && !ok {
+		return fmt.Errorf("field id in ContainerState: required")
+	}
+	if _, ok := raw["image"]; raw != nil && !ok {
+		return fmt.Errorf("field image in ContainerState: required")
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in ContainerState: required")
+	}
+	if _, ok := raw["status"]; raw != nil && !ok {
+		return fmt.Errorf("field status in ContainerState: required")
+	}
+	type Plain ContainerState
+	var plain Plain
+	if err := value.Decode(&plain); err != nil {
+		return err
+	}
+	*j = ContainerState(plain)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *ContainerState) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["config_hash"]; raw != nil && !ok {
+		return fmt.Errorf("field config_hash in ContainerState: required")
+	}
+	if _, ok := raw["id"]; raw != nil && !ok {
+		return fmt.Errorf("field id in ContainerState: required")
+	}
+	if _, ok := raw["image"]; raw != nil && !ok {
+		return fmt.Errorf("field image in ContainerState: required")
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in ContainerState: required")
+	}
+	if _, ok := raw["status"]; raw != nil && !ok {
+		return fmt.Errorf("field status in ContainerState: required")
+	}
+	type Plain ContainerState
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	*j = ContainerState(plain)
+	return nil
+}
+
+type EnvVar struct {
+	// Name corresponds to the JSON schema field "name".
+	Name string `json:"name" yaml:"name" mapstructure:"name"`
+
+	// Value corresponds to the JSON schema field "value".
+	Value string `json:"value" yaml:"value" mapstructure:"value"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *EnvVar) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in EnvVar: required")
+	}
+	if _, ok := raw["value"]; raw != nil && !ok {
+		return fmt.Errorf("field value in EnvVar: required")
+	}
+	type Plain EnvVar
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	*j = EnvVar(plain)
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *EnvVar) UnmarshalYAML(value *yaml.Node) error {
+	var raw map[string]interface{}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in EnvVar: required")
+	}
+	if _, ok := raw["value"]; raw != nil && !ok {
+		return fmt.Errorf("field value in EnvVar: required")
+	}
+	type Plain EnvVar
+	var plain Plain
+	if err := value.Decode(&plain); err != nil {
+		return err
+	}
+	*j = EnvVar(plain)
+	return nil
+}
+
+// Runs a command in the container, healthy if it exits with 0.
+type ExecProbe struct {
+	// Command corresponds to the JSON schema field "command".
+	Command []string `json:"command" yaml:"command" mapstructure:"command"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *ExecProbe) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["command"]; raw != nil && !ok {
+		return fmt.Errorf("field command in ExecProbe: required")
+	}
+	type Plain ExecProbe
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	if plain.Command != nil && len(plain.Command) < 1 {
+		return fmt.Errorf("field %s length: must be >= %d", "command", 1)
+	}
+	*j = ExecProbe(plain)
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *ExecProbe) UnmarshalYAML(value *yaml.Node) error {
+	var raw map[string]interface{}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	if _, ok := raw["command"]; raw != nil && !ok {
+		return fmt.Errorf("field command in ExecProbe: required")
+	}
+	type Plain ExecProbe
+	var plain Plain
+	if err := value.Decode(&plain); err != nil {
+		return err
+	}
+	if plain.Command != nil && len(plain.Command) < 1 {
+		return fmt.Errorf("field %s length: must be >= %d", "command", 1)
+	}
+	*j = ExecProbe(plain)
+	return nil
+}
+
+type Health struct {
+	// Number of consecutive failed probes.
+	FailingStreak int `json:"failing_streak" yaml:"failing_streak" mapstructure:"failing_streak"`
+
+	// LastChecked corresponds to the JSON schema field "last_checked".
+	LastChecked *time.Time `json:"last_checked,omitempty" yaml:"last_checked,omitempty" mapstructure:"last_checked,omitempty"`
+
+	// Output or error of the last probe.
+	LastOutput *string `json:"last_output,omitempty" yaml:"last_output,omitempty" mapstructure:"last_output,omitempty"`
+
+	// Status corresponds to the JSON schema field "status".
+	Status HealthStatus `json:"status" yaml:"status" mapstructure:"status"`
+}
+
+type HealthStatus string
+
+const HealthStatusHealthy HealthStatus = "healthy"
+const HealthStatusStarting HealthStatus = "starting"
+const HealthStatusUnhealthy HealthStatus = "unhealthy"
+
+var enumValues_HealthStatus = []interface{}{
+	"starting",
+	"healthy",
+	"unhealthy",
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *HealthStatus) UnmarshalYAML(value *yaml.Node) error {
+	var v string
+	if err := value.Decode(&v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_HealthStatus {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_HealthStatus, v)
+	}
+	*j = HealthStatus(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *HealthStatus) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_HealthStatus {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_HealthStatus, v)
+	}
+	*j = HealthStatus(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *Health) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["failing_streak"]; raw != nil && !ok {
+		return fmt.Errorf("field failing_streak in Health: required")
+	}
+	if _, ok := raw["status"]; raw != nil && !ok {
+		return fmt.Errorf("field status in Health: required")
+	}
+	type Plain Health
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	*j = Health(plain)
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *Health) UnmarshalYAML(value *yaml.Node) error {
+	var raw map[string]interface{}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	if _, ok := raw["failing_streak"]; raw != nil && !ok {
+		return fmt.Errorf("field failing_streak in Health: required")
+	}
+	if _, ok := raw["status"]; raw != nil && !ok {
+		return fmt.Errorf("field status in Health: required")
+	}
+	type Plain Health
+	var plain Plain
+	if err := value.Decode(&plain); err != nil {
+		return err
+	}
+	*j = Health(plain)
+	return nil
+}
+
+// Probes run by sysctr while the container is running. Exactly one of exec, http
+// and tcp must be set.
+type Healthcheck struct {
+	// Exec corresponds to the JSON schema field "exec".
+	Exec *ExecProbe `json:"exec,omitempty" yaml:"exec,omitempty" mapstructure:"exec,omitempty"`
+
+	// Http corresponds to the JSON schema field "http".
+	Http *HttpProbe `json:"http,omitempty" yaml:"http,omitempty" mapstructure:"http,omitempty"`
+
+	// Seconds between probes.
+	Interval int `json:"interval,omitempty" yaml:"interval,omitempty" mapstructure:"interval,omitempty"`
+
+	// Action taken once the container is unhealthy.
+	OnFailure HealthcheckOnFailure `json:"on_failure,omitempty" yaml:"on_failure,omitempty" mapstructure:"on_failure,omitempty"`
+
+	// Consecutive failures before the container is unhealthy.
+	Retries int `json:"retries,omitempty" yaml:"retries,omitempty" mapstructure:"retries,omitempty"`
+
+	// Seconds after start during which failures are not counted.
+	StartPeriod int `json:"start_period,omitempty" yaml:"start_period,omitempty" mapstructure:"start_period,omitempty"`
+
+	// Tcp corresponds to the JSON schema field "tcp".
+	Tcp *TcpProbe `json:"tcp,omitempty" yaml:"tcp,omitempty" mapstructure:"tcp,omitempty"`
+
+	// Seconds before a probe is considered failed.
+	Timeout int `json:"timeout,omitempty" yaml:"timeout,omitempty" mapstructure:"timeout,omitempty"`
+}
+
+type HealthcheckOnFailure string
+
+const HealthcheckOnFailureExit HealthcheckOnFailure = "exit"
+const HealthcheckOnFailureLog HealthcheckOnFailure = "log"
+const HealthcheckOnFailureRestart HealthcheckOnFailure = "restart"
+
+var enumValues_HealthcheckOnFailure = []interface{}{
+	"log",
+	"restart",
+	"exit",
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *HealthcheckOnFailure) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_HealthcheckOnFailure {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_HealthcheckOnFailure, v)
+	}
+	*j = HealthcheckOnFailure(v)
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *HealthcheckOnFailure) UnmarshalYAML(value *yaml.Node) error {
+	var v string
+	if err := value.Decode(&v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_HealthcheckOnFailure {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_HealthcheckOnFailure, v)
+	}
+	*j = HealthcheckOnFailure(v)
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *Healthcheck) UnmarshalYAML(value *yaml.Node) error {
+	var raw map[string]interface{}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	type Plain Healthcheck
+	var plain Plain
+	if err := value.Decode(&plain); err != nil {
+		return err
+	}
+	if v, ok := raw["interval"]; !ok || v == nil {
+		plain.Interval = 30.0
+	}
+	if v, ok := raw["on_failure"]; !ok || v == nil {
+		plain.OnFailure = "log"
+	}
+	if v, ok := raw["retries"]; !ok || v == nil {
+		plain.Retries = 3.0
+	}
+	if v, ok := raw["start_period"]; !ok || v == nil {
+		plain.StartPeriod = 0.0
+	}
+	if v, ok := raw["timeout"]; !ok || v == nil {
+		plain.Timeout = 5.0
+	}
+	*j = Healthcheck(plain)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *Healthcheck) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	type Plain Healthcheck
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	if v, ok := raw["interval"]; !ok || v == nil {
+		plain.Interval = 30.0
+	}
+	if v, ok := raw["on_failure"]; !ok || v == nil {
+		plain.OnFailure = "log"
+	}
+	if v, ok := raw["retries"]; !ok || v == nil {
+		plain.Retries = 3.0
+	}
+	if v, ok := raw["start_period"]; !ok || v == nil {
+		plain.StartPeriod = 0.0
+	}
+	if v, ok := raw["timeout"]; !ok || v == nil {
+		plain.Timeout = 5.0
+	}
+	*j = Healthcheck(plain)
+	return nil
+}
+
+// Sends a GET request from the host, healthy on a 2xx or 3xx response.
+type HttpProbe struct {
+	// Host corresponds to the JSON schema field "host".
+	Host string `json:"host,omitempty" yaml:"host,omitempty" mapstructure:"host,omitempty"`
+
+	// Path corresponds to the JSON schema field "path".
+	Path string `json:"path,omitempty" yaml:"path,omitempty" mapstructure:"path,omitempty"`
+
+	// Port corresponds to the JSON schema field "port".
+	Port int `json:"port" yaml:"port" mapstructure:"port"`
+
+	// Scheme corresponds to the JSON schema field "scheme".
+	Scheme HttpProbeScheme `json:"scheme,omitempty" yaml:"scheme,omitempty" mapstructure:"scheme,omitempty"`
+}
+
+type HttpProbeScheme string
+
+const HttpProbeSchemeHttp HttpProbeScheme = "http"
+const HttpProbeSchemeHttps HttpProbeScheme = "https"
+
+var enumValues_HttpProbeScheme = []interface{}{
+	"http",
+	"https",
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *HttpProbeScheme) UnmarshalYAML(value *yaml.Node) error {
+	var v string
+	if err := value.Decode(&v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_HttpProbeScheme {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_HttpProbeScheme, v)
+	}
+	*j = HttpProbeScheme(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *HttpProbeScheme) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_HttpProbeScheme {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_HttpProbeScheme, v)
+	}
+	*j = HttpProbeScheme(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *HttpProbe) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["port"]; raw != nil && !ok {
+		return fmt.Errorf("field port in HttpProbe: required")
+	}
+	type Plain HttpProbe
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	if v, ok := raw["host"]; !ok || v == nil {
+		plain.Host = "127.0.0.1"
+	}
+	if v, ok := raw["path"]; !ok || v == nil {
+		plain.Path = "/"
+	}
+	if v, ok := raw["scheme"]; !ok || v == nil {
+		plain.Scheme = "http"
+	}
+	*j = HttpProbe(plain)
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *HttpProbe) UnmarshalYAML(value *yaml.Node) error {
+	var raw map[string]interface{}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	if _, ok := raw["port"]; raw != nil && !ok {
+		return fmt.Errorf("field port in HttpProbe: required")
+	}
+	type Plain HttpProbe
+	var plain Plain
+	if err := value.Decode(&plain); err != nil {
+		return err
+	}
+	if v, ok := raw["host"]; !ok || v == nil {
+		plain.Host = "127.0.0.1"
+	}
+	if v, ok := raw["path"]; !ok || v == nil {
+		plain.Path = "/"
+	}
+	if v, ok := raw["scheme"]; !ok || v == nil {
+		plain.Scheme = "http"
+	}
+	*j = HttpProbe(plain)
+	return nil
+}
+
+type Network struct {
+	// Mode corresponds to the JSON schema field "mode".
+	Mode NetworkMode `json:"mode,omitempty" yaml:"mode,omitempty" mapstructure:"mode,omitempty"`
+
+	// Ports corresponds to the JSON schema field "ports".
+	Ports []PortMapping `json:"ports,omitempty" yaml:"ports,omitempty" mapstructure:"ports,omitempty"`
+}
+
+type NetworkMode string
+
+const NetworkModeBridge NetworkMode = "bridge"
+const NetworkModeHost NetworkMode = "host"
+const NetworkModeNone NetworkMode = "none"
+
+var enumValues_NetworkMode = []interface{}{
+	"host",
+	"none",
+	"bridge",
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *NetworkMode) UnmarshalYAML(value *yaml.Node) error {
+	var v string
+	if err := value.Decode(&v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_NetworkMode {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_NetworkMode, v)
+	}
+	*j = NetworkMode(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *NetworkMode) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_NetworkMode {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_NetworkMode, v)
+	}
+	*j = NetworkMode(v)
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *Network) UnmarshalYAML(value *yaml.Node) error {
+	var raw map[string]interface{}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	type Plain Network
+	var plain Plain
+	if err := value.Decode(&plain); err != nil {
+		return err
+	}
+	if v, ok := raw["mode"]; !ok || v == nil {
+		plain.Mode = "host"
+	}
+	*j = Network(plain)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *Network) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	type Plain Network
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	if v, ok := raw["mode"]; !ok || v == nil {
+		plain.Mode = "host"
+	}
+	*j = Network(plain)
+	return nil
+}
+
+type PortMapping struct {
+	// ContainerPort corresponds to the JSON schema field "container_port".
+	ContainerPort int `json:"container_port" yaml:"container_port" mapstructure:"container_port"`
+
+	// HostIp corresponds to the JSON schema field "host_ip".
+	HostIp *string `json:"host_ip,omitempty" yaml:"host_ip,omitempty" mapstructure:"host_ip,omitempty"`
+
+	// HostPort corresponds to the JSON schema field "host_port".
+	HostPort *int `json:"host_port,omitempty" yaml:"host_port,omitempty" mapstructure:"host_port,omitempty"`
+
+	// Protocol corresponds to the JSON schema field "protocol".
+	Protocol PortMappingProtocol `json:"protocol,omitempty" yaml:"protocol,omitempty" mapstructure:"protocol,omitempty"`
+}
+
+type PortMappingProtocol string
+
+const PortMappingProtocolTcp PortMappingProtocol = "tcp"
+const PortMappingProtocolUdp PortMappingProtocol = "udp"
+
+var enumValues_PortMappingProtocol = []interface{}{
+	"tcp",
+	"udp",
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *PortMappingProtocol) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_PortMappingProtocol {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_PortMappingProtocol, v)
+	}
+	*j = PortMappingProtocol(v)
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *PortMappingProtocol) UnmarshalYAML(value *yaml.Node) error {
+	var v string
+	if err := value.Decode(&v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_PortMappingProtocol {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_PortMappingProtocol, v)
+	}
+	*j = PortMappingProtocol(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *PortMapping) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["container_port"]; raw != nil && !ok {
+		return fmt.Errorf("field container_port in PortMapping: required")
+	}
+	type Plain PortMapping
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	if v, ok := raw["protocol"]; !ok || v == nil {
+		plain.Protocol = "tcp"
+	}
+	*j = PortMapping(plain)
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *PortMapping) UnmarshalYAML(value *yaml.Node) error {
+	var raw map[string]interface{}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	if _, ok := raw["container_port"]; raw != nil && !ok {
+		return fmt.Errorf("field container_port in PortMapping: required")
+	}
+	type Plain PortMapping
+	var plain Plain
+	if err := value.Decode(&plain); err != nil {
+		return err
+	}
+	if v, ok := raw["protocol"]; !ok || v == nil {
+		plain.Protocol = "tcp"
+	}
+	*j = PortMapping(plain)
+	return nil
+}
 
-	// Status corresponds to the JSON schema field "status".
-	Status string `json:"status" yaml:"status" mapstructure:"status"`
+type Resources struct {
+	// BlkioWeight corresponds to the JSON schema field "blkio_weight".
+	BlkioWeight *int `json:"blkio_weight,omitempty" yaml:"blkio_weight,omitempty" mapstructure:"blkio_weight,omitempty"`
+
+	// CpuPeriod corresponds to the JSON schema field "cpu_period".
+	CpuPeriod *int `json:"cpu_period,omitempty" yaml:"cpu_period,omitempty" mapstructure:"cpu_period,omitempty"`
+
+	// CpuQuota corresponds to the JSON schema field "cpu_quota".
+	CpuQuota *int `json:"cpu_quota,omitempty" yaml:"cpu_quota,omitempty" mapstructure:"cpu_quota,omitempty"`
+
+	// CpuShares corresponds to the JSON schema field "cpu_shares".
+	CpuShares *int `json:"cpu_shares,omitempty" yaml:"cpu_shares,omitempty" mapstructure:"cpu_shares,omitempty"`
+
+	// MemoryLimit corresponds to the JSON schema field "memory_limit".
+	MemoryLimit *string `json:"memory_limit,omitempty" yaml:"memory_limit,omitempty" mapstructure:"memory_limit,omitempty"`
+
+	// MemoryReservation corresponds to the JSON schema field "memory_reservation".
+	MemoryReservation *string `json:"memory_reservation,omitempty" yaml:"memory_reservation,omitempty" mapstructure:"memory_reservation,omitempty"`
+
+	// PidsLimit corresponds to the JSON schema field "pids_limit".
+	PidsLimit *int `json:"pids_limit,omitempty" yaml:"pids_limit,omitempty" mapstructure:"pids_limit,omitempty"`
+}
+
+// Restarts the container in-process when it exits, with an exponential backoff.
+type Restart struct {
+	// Seconds before the first restart, doubled on each following restart.
+	InitialDelay int `json:"initial_delay,omitempty" yaml:"initial_delay,omitempty" mapstructure:"initial_delay,omitempty"`
+
+	// Fraction of the delay added at random to spread restarts.
+	Jitter float64 `json:"jitter,omitempty" yaml:"jitter,omitempty" mapstructure:"jitter,omitempty"`
+
+	// Maximum seconds between restarts.
+	MaxDelay int `json:"max_delay,omitempty" yaml:"max_delay,omitempty" mapstructure:"max_delay,omitempty"`
+
+	// Restarts before giving up, 0 for no limit.
+	MaxRetries int `json:"max_retries,omitempty" yaml:"max_retries,omitempty" mapstructure:"max_retries,omitempty"`
+
+	// When the container is restarted.
+	Policy RestartPolicy `json:"policy,omitempty" yaml:"policy,omitempty" mapstructure:"policy,omitempty"`
+
+	// Seconds the container must run for the restart count and delay to be reset.
+	ResetAfter int `json:"reset_after,omitempty" yaml:"reset_after,omitempty" mapstructure:"reset_after,omitempty"`
+}
+
+type RestartPolicy string
+
+const RestartPolicyAlways RestartPolicy = "always"
+const RestartPolicyNever RestartPolicy = "never"
+const RestartPolicyOnFailure RestartPolicy = "on-failure"
+
+var enumValues_RestartPolicy = []interface{}{
+	"never",
+	"on-failure",
+	"always",
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *RestartPolicy) UnmarshalYAML(value *yaml.Node) error {
+	var v string
+	if err := value.Decode(&v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_RestartPolicy {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_RestartPolicy, v)
+	}
+	*j = RestartPolicy(v)
+	return nil
 }
 
 // UnmarshalJSON implements json.Unmarshaler.
-func (j *ContainerState) UnmarshalJSON(b []byte) error {
+func (j *RestartPolicy) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_RestartPolicy {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_RestartPolicy, v)
+	}
+	*j = RestartPolicy(v)
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *Restart) UnmarshalYAML(value *yaml.Node) error {
 	var raw map[string]interface{}
-	if err := json.Unmarshal(b, &raw); err != nil {
+	if err := value.Decode(&raw); err != nil {
 		return err
 	}
-	if _, ok := raw["config_hash"]; raw != nil && !ok {
-		return fmt.Errorf("field config_hash in ContainerState: required")
+	type Plain Restart
+	var plain Plain
+	if err := value.Decode(&plain); err != nil {
+		return err
 	}
-	if _, ok := raw["id"]; raw != nil && !ok {
-		return fmt.Errorf("field id in ContainerState: required")
+	if v, ok := raw["initial_delay"]; !ok || v == nil {
+		plain.InitialDelay = 1.0
 	}
-	if _, ok := raw["status"]; raw != nil && !ok {
-		return fmt.Errorf("field status in ContainerState: required")
+	if v, ok := raw["jitter"]; !ok || v == nil {
+		plain.Jitter = 0.1
 	}
-	type Plain ContainerState
+	if v, ok := raw["max_delay"]; !ok || v == nil {
+		plain.MaxDelay = 60.0
+	}
+	if v, ok := raw["max_retries"]; !ok || v == nil {
+		plain.MaxRetries = 0.0
+	}
+	if v, ok := raw["policy"]; !ok || v == nil {
+		plain.Policy = "never"
+	}
+	if v, ok := raw["reset_after"]; !ok || v == nil {
+		plain.ResetAfter = 300.0
+	}
+	*j = Restart(plain)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *Restart) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	type Plain Restart
 	var plain Plain
 	if err := json.Unmarshal(b, &plain); err != nil {
 		return err
 	}
-	*j = ContainerState(plain)
+	if v, ok := raw["initial_delay"]; !ok || v == nil {
+		plain.InitialDelay = 1.0
+	}
+	if v, ok := raw["jitter"]; !ok || v == nil {
+		plain.Jitter = 0.1
+	}
+	if v, ok := raw["max_delay"]; !ok || v == nil {
+		plain.MaxDelay = 60.0
+	}
+	if v, ok := raw["max_retries"]; !ok || v == nil {
+		plain.MaxRetries = 0.0
+	}
+	if v, ok := raw["policy"]; !ok || v == nil {
+		plain.Policy = "never"
+	}
+	if v, ok := raw["reset_after"]; !ok || v == nil {
+		plain.ResetAfter = 300.0
+	}
+	*j = Restart(plain)
 	return nil
 }
 
+// A secret exposed to the container. Exactly one of credential, file and env must
+// be set as its source.
+type Secret struct {
+	// Name of a systemd credential, read from $CREDENTIALS_DIRECTORY.
+	Credential *string `json:"credential,omitempty" yaml:"credential,omitempty" mapstructure:"credential,omitempty"`
+
+	// Name of an environment variable of sysctr.
+	Env *string `json:"env,omitempty" yaml:"env,omitempty" mapstructure:"env,omitempty"`
+
+	// Path of a file on the host, relative to the spec.
+	File *string `json:"file,omitempty" yaml:"file,omitempty" mapstructure:"file,omitempty"`
+
+	// Name corresponds to the JSON schema field "name".
+	Name string `json:"name" yaml:"name" mapstructure:"name"`
+
+	// Target corresponds to the JSON schema field "target".
+	Target *SecretTarget `json:"target,omitempty" yaml:"target,omitempty" mapstructure:"target,omitempty"`
+}
+
+// Where the secret is exposed in the container, a read-only file at
+// /run/secrets/<name> when neither is set.
+type SecretTarget struct {
+	// Environment variable set to the secret.
+	Env *string `json:"env,omitempty" yaml:"env,omitempty" mapstructure:"env,omitempty"`
+
+	// Absolute path of a read-only file holding the secret.
+	Path *string `json:"path,omitempty" yaml:"path,omitempty" mapstructure:"path,omitempty"`
+}
+
 // UnmarshalYAML implements yaml.Unmarshaler.
-func (j *ContainerState) UnmarshalYAML(value *yaml.Node) error {
+func (j *Secret) UnmarshalYAML(value *yaml.Node) error {
 	var raw map[string]interface{}
 	if err := value.Decode(&raw); err != nil {
 		return err
 	}
-	if _, ok := raw["config_hash"]; raw != nil && !ok {
-		return fmt.Errorf("field config_hash in ContainerState: required")
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in Secret: required")
 	}
-	if _, ok := raw["id"]; raw != nil && !ok {
-		return fmt.Errorf("field id in ContainerState: required")
+	type Plain Secret
+	var plain Plain
+	if err := value.Decode(&plain); err != nil {
+		return err
 	}
-	if _, ok := raw["status"]; raw != nil && !ok {
-		return fmt.Errorf("field status in ContainerState: required")
+	*j = Secret(plain)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *Secret) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
 	}
-	type Plain ContainerState
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in Secret: required")
+	}
+	type Plain Secret
 	var plain Plain
-	if err := value.Decode(&plain); err != nil {
+	if err := json.Unmarshal(b, &plain); err != nil {
 		return err
 	}
-	*j = ContainerState(plain)
+	*j = Secret(plain)
 	return nil
 }
 
-type EnvVar struct {
-	// Name corresponds to the JSON schema field "name".
+// A container started after the primary one, sharing its network and IPC
+// namespaces.
+type Sidecar struct {
+	// Args corresponds to the JSON schema field "args".
+	Args []string `json:"args,omitempty" yaml:"args,omitempty" mapstructure:"args,omitempty"`
+
+	// Command corresponds to the JSON schema field "command".
+	Command []string `json:"command,omitempty" yaml:"command,omitempty" mapstructure:"command,omitempty"`
+
+	// Env corresponds to the JSON schema field "env".
+	Env []EnvVar `json:"env,omitempty" yaml:"env,omitempty" mapstructure:"env,omitempty"`
+
+	// Image corresponds to the JSON schema field "image".
+	Image string `json:"image" yaml:"image" mapstructure:"image"`
+
+	// Name of the sidecar, unique within the spec. Its container is named <spec
+	// name>-<name>.
 	Name string `json:"name" yaml:"name" mapstructure:"name"`
 
-	// Value corresponds to the JSON schema field "value".
-	Value string `json:"value" yaml:"value" mapstructure:"value"`
+	// Resources corresponds to the JSON schema field "resources".
+	Resources *Resources `json:"resources,omitempty" yaml:"resources,omitempty" mapstructure:"resources,omitempty"`
+
+	// VolumeMounts corresponds to the JSON schema field "volume_mounts".
+	VolumeMounts []VolumeMount `json:"volume_mounts,omitempty" yaml:"volume_mounts,omitempty" mapstructure:"volume_mounts,omitempty"`
 }
 
 // UnmarshalJSON implements json.Unmarshaler.
-func (j *EnvVar) UnmarshalJSON(b []byte) error {
+func (j *Sidecar) UnmarshalJSON(b []byte) error {
 	var raw map[string]interface{}
 	if err := json.Unmarshal(b, &raw); err != nil {
 		return err
 	}
-	if _, ok := raw["name"]; raw != nil && !ok {
-		return fmt.Errorf("field name in EnvVar: required")
+	if _, ok := raw["image"]; raw != nil && !ok {
+		return fmt.Errorf("field image in Sidecar: required")
 	}
-	if _, ok := raw["value"]; raw != nil && !ok {
-		return fmt.Errorf("field value in EnvVar: required")
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in Sidecar: required")
 	}
-	type Plain EnvVar
+	type Plain Sidecar
 	var plain Plain
 	if err := json.Unmarshal(b, &plain); err != nil {
 		return err
 	}
-	*j = EnvVar(plain)
+	if plain.Command != nil && len(plain.Command) < 1 {
+		return fmt.Errorf("field %s length: must be >= %d", "command", 1)
+	}
+	*j = Sidecar(plain)
 	return nil
 }
 
 // UnmarshalYAML implements yaml.Unmarshaler.
-func (j *EnvVar) UnmarshalYAML(value *yaml.Node) error {
+func (j *Sidecar) UnmarshalYAML(value *yaml.Node) error {
 	var raw map[string]interface{}
 	if err := value.Decode(&raw); err != nil {
 		return err
 	}
-	if _, ok := raw["name"]; raw != nil && !ok {
-		return fmt.Errorf("field name in EnvVar: required")
+	if _, ok := raw["image"]; raw != nil && !ok {
+		return fmt.Errorf("field image in Sidecar: required")
 	}
-	if _, ok := raw["value"]; raw != nil && !ok {
-		return fmt.Errorf("field value in EnvVar: required")
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in Sidecar: required")
 	}
-	type Plain EnvVar
+	type Plain Sidecar
 	var plain Plain
 	if err := value.Decode(&plain); err != nil {
 		return err
 	}
-	*j = EnvVar(plain)
+	if plain.Command != nil && len(plain.Command) < 1 {
+		return fmt.Errorf("field %s length: must be >= %d", "command", 1)
+	}
+	*j = Sidecar(plain)
 	return nil
 }
 
@@ -128,20 +1082,107 @@ type Spec struct {
 	// Env corresponds to the JSON schema field "env".
 	Env []EnvVar `json:"env,omitempty" yaml:"env,omitempty" mapstructure:"env,omitempty"`
 
-	// Image corresponds to the JSON schema field "image".
+	// Files of environment variables in dotenv format, relative to the spec.
+	// Variables set in env take precedence.
+	EnvFile []string `json:"env_file,omitempty" yaml:"env_file,omitempty" mapstructure:"env_file,omitempty"`
+
+	// Healthcheck corresponds to the JSON schema field "healthcheck".
+	Healthcheck *Healthcheck `json:"healthcheck,omitempty" yaml:"healthcheck,omitempty" mapstructure:"healthcheck,omitempty"`
+
+	// Image reference, optionally pinned to a digest with name@sha256:<digest>.
 	Image string `json:"image" yaml:"image" mapstructure:"image"`
 
 	// Name corresponds to the JSON schema field "name".
 	Name string `json:"name" yaml:"name" mapstructure:"name"`
 
+	// Network corresponds to the JSON schema field "network".
+	Network *Network `json:"network,omitempty" yaml:"network,omitempty" mapstructure:"network,omitempty"`
+
+	// When the image is pulled before the container is created, defaults to
+	// if-not-present.
+	PullPolicy *SpecPullPolicy `json:"pull_policy,omitempty" yaml:"pull_policy,omitempty" mapstructure:"pull_policy,omitempty"`
+
+	// Resources corresponds to the JSON schema field "resources".
+	Resources *Resources `json:"resources,omitempty" yaml:"resources,omitempty" mapstructure:"resources,omitempty"`
+
+	// Restart corresponds to the JSON schema field "restart".
+	Restart *Restart `json:"restart,omitempty" yaml:"restart,omitempty" mapstructure:"restart,omitempty"`
+
+	// Secrets corresponds to the JSON schema field "secrets".
+	Secrets []Secret `json:"secrets,omitempty" yaml:"secrets,omitempty" mapstructure:"secrets,omitempty"`
+
+	// Sidecars share the PID namespace of the primary container.
+	SharePid bool `json:"share_pid,omitempty" yaml:"share_pid,omitempty" mapstructure:"share_pid,omitempty"`
+
+	// Containers started in order after the primary one and stopped together with it.
+	Sidecars []Sidecar `json:"sidecars,omitempty" yaml:"sidecars,omitempty" mapstructure:"sidecars,omitempty"`
+
+	// StopSignal corresponds to the JSON schema field "stop_signal".
+	StopSignal *string `json:"stop_signal,omitempty" yaml:"stop_signal,omitempty" mapstructure:"stop_signal,omitempty"`
+
+	// StopTimeout corresponds to the JSON schema field "stop_timeout".
+	StopTimeout *int `json:"stop_timeout,omitempty" yaml:"stop_timeout,omitempty" mapstructure:"stop_timeout,omitempty"`
+
 	// VolumeMounts corresponds to the JSON schema field "volume_mounts".
 	VolumeMounts []VolumeMount `json:"volume_mounts,omitempty" yaml:"volume_mounts,omitempty" mapstructure:"volume_mounts,omitempty"`
 }
 
+type SpecPullPolicy string
+
+const SpecPullPolicyAlways SpecPullPolicy = "always"
+const SpecPullPolicyIfNotPresent SpecPullPolicy = "if-not-present"
+const SpecPullPolicyNever SpecPullPolicy = "never"
+
+var enumValues_SpecPullPolicy = []interface{}{
+	"always",
+	"if-not-present",
+	"never",
+}
+
 // UnmarshalJSON implements json.Unmarshaler.
-func (j *Spec) UnmarshalJSON(b []byte) error {
+func (j *SpecPullPolicy) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_SpecPullPolicy {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_SpecPullPolicy, v)
+	}
+	*j = SpecPullPolicy(v)
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *SpecPullPolicy) UnmarshalYAML(value *yaml.Node) error {
+	var v string
+	if err := value.Decode(&v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_SpecPullPolicy {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_SpecPullPolicy, v)
+	}
+	*j = SpecPullPolicy(v)
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *Spec) UnmarshalYAML(value *yaml.Node) error {
 	var raw map[string]interface{}
-	if err := json.Unmarshal(b, &raw); err != nil {
+	if err := value.Decode(&raw); err != nil {
 		return err
 	}
 	if _, ok := raw["image"]; raw != nil && !ok {
@@ -152,20 +1193,23 @@ func (j *Spec) UnmarshalJSON(b []byte) error {
 	}
 	type Plain Spec
 	var plain Plain
-	if err := json.Unmarshal(b, &plain); err != nil {
+	if err := value.Decode(&plain); err != nil {
 		return err
 	}
 	if plain.Command != nil && len(plain.Command) < 1 {
 		return fmt.Errorf("field %s length: must be >= %d", "command", 1)
 	}
+	if v, ok := raw["share_pid"]; !ok || v == nil {
+		plain.SharePid = false
+	}
 	*j = Spec(plain)
 	return nil
 }
 
-// UnmarshalYAML implements yaml.Unmarshaler.
-func (j *Spec) UnmarshalYAML(value *yaml.Node) error {
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *Spec) UnmarshalJSON(b []byte) error {
 	var raw map[string]interface{}
-	if err := value.Decode(&raw); err != nil {
+	if err := json.Unmarshal(b, &raw); err != nil {
 		return err
 	}
 	if _, ok := raw["image"]; raw != nil && !ok {
@@ -176,16 +1220,70 @@ func (j *Spec) UnmarshalYAML(value *yaml.Node) error {
 	}
 	type Plain Spec
 	var plain Plain
-	if err := value.Decode(&plain); err != nil {
+	if err := json.Unmarshal(b, &plain); err != nil {
 		return err
 	}
 	if plain.Command != nil && len(plain.Command) < 1 {
 		return fmt.Errorf("field %s length: must be >= %d", "command", 1)
 	}
+	if v, ok := raw["share_pid"]; !ok || v == nil {
+		plain.SharePid = false
+	}
 	*j = Spec(plain)
 	return nil
 }
 
+// Opens a TCP connection from the host, healthy if it is accepted.
+type TcpProbe struct {
+	// Host corresponds to the JSON schema field "host".
+	Host string `json:"host,omitempty" yaml:"host,omitempty" mapstructure:"host,omitempty"`
+
+	// Port corresponds to the JSON schema field "port".
+	Port int `json:"port" yaml:"port" mapstructure:"port"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *TcpProbe) UnmarshalYAML(value *yaml.Node) error {
+	var raw map[string]interface{}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	if _, ok := raw["port"]; raw != nil && !ok {
+		return fmt.Errorf("field port in TcpProbe: required")
+	}
+	type Plain TcpProbe
+	var plain Plain
+	if err := value.Decode(&plain); err != nil {
+		return err
+	}
+	if v, ok := raw["host"]; !ok || v == nil {
+		plain.Host = "127.0.0.1"
+	}
+	*j = TcpProbe(plain)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *TcpProbe) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["port"]; raw != nil && !ok {
+		return fmt.Errorf("field port in TcpProbe: required")
+	}
+	type Plain TcpProbe
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	if v, ok := raw["host"]; !ok || v == nil {
+		plain.Host = "127.0.0.1"
+	}
+	*j = TcpProbe(plain)
+	return nil
+}
+
 type VolumeMount struct {
 	// ReadOnly corresponds to the JSON schema field "read_only".
 	ReadOnly *bool `json:"read_only,omitempty" yaml:"read_only,omitempty" mapstructure:"read_only,omitempty"`
@@ -197,10 +1295,10 @@ type VolumeMount struct {
 	Target string `json:"target" yaml:"target" mapstructure:"target"`
 }
 
-// UnmarshalJSON implements json.Unmarshaler.
-func (j *VolumeMount) UnmarshalJSON(b []byte) error {
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (j *VolumeMount) UnmarshalYAML(value *yaml.Node) error {
 	var raw map[string]interface{}
-	if err := json.Unmarshal(b, &raw); err != nil {
+	if err := value.Decode(&raw); err != nil {
 		return err
 	}
 	if _, ok := raw["source"]; raw != nil && !ok {
@@ -211,17 +1309,17 @@ func (j *VolumeMount) UnmarshalJSON(b []byte) error {
 	}
 	type Plain VolumeMount
 	var plain Plain
-	if err := json.Unmarshal(b, &plain); err != nil {
+	if err := value.Decode(&plain); err != nil {
 		return err
 	}
 	*j = VolumeMount(plain)
 	return nil
 }
 
-// UnmarshalYAML implements yaml.Unmarshaler.
-func (j *VolumeMount) UnmarshalYAML(value *yaml.Node) error {
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *VolumeMount) UnmarshalJSON(b []byte) error {
 	var raw map[string]interface{}
-	if err := value.Decode(&raw); err != nil {
+	if err := json.Unmarshal(b, &raw); err != nil {
 		return err
 	}
 	if _, ok := raw["source"]; raw != nil && !ok {
@@ -232,7 +1330,7 @@ func (j *VolumeMount) UnmarshalYAML(value *yaml.Node) error {
 	}
 	type Plain VolumeMount
 	var plain Plain
-	if err := value.Decode(&plain); err != nil {
+	if err := json.Unmarshal(b, &plain); err != nil {
 		return err
 	}
 	*j = VolumeMount(plain)